@@ -1,12 +1,18 @@
 package main
 
 import (
+	"os"
+
 	"github.com/gofiber/fiber/v2/log"
 
 	app "github.com/muazwzxv/kafka-consumer-worker/internal"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		os.Exit(runReplay(os.Args[2:]))
+	}
+
 	application, err := app.Init()
 	if err != nil {
 		log.Fatalf("Failed to initialize application: %v", err)
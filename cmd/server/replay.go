@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	app "github.com/muazwzxv/kafka-consumer-worker/internal"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/consumer"
+)
+
+const replayUsage = `Usage: server replay -stream <name> [flags]
+
+Runs a stream's registered handler over a range of its topic, using a
+separate consumer group so the live group's offsets are untouched.
+Positions are offsets, applied to every partition, or RFC 3339 timestamps.
+
+Flags:
+`
+
+// runReplay runs the replay subcommand and returns the process exit code:
+// 0 when every message succeeded, 1 when any failed and 2 on bad usage.
+func runReplay(args []string) int {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), replayUsage)
+		fs.PrintDefaults()
+	}
+
+	stream := fs.String("stream", "", "stream to replay (required)")
+	from := fs.String("from", "", "first offset or timestamp to replay (default: oldest)")
+	to := fs.String("to", "", "offset or timestamp to stop before (default: high-water mark)")
+	partitions := fs.String("partitions", "", "comma-separated partitions to replay (default: all)")
+	dryRun := fs.Bool("dry-run", false, "count the messages in range without running the handler")
+	group := fs.String("group", "", "consumer group to commit replay progress under (default: <consumer_group>-replay)")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	opts, err := replayOptions(*stream, *from, *to, *partitions)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "replay: %v\n\n", err)
+		fs.Usage()
+		return 2
+	}
+	opts.DryRun = *dryRun
+	opts.Group = *group
+	opts.Progress = os.Stdout
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	summary, err := app.Replay(ctx, opts)
+	printReplaySummary(summary)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "replay: %v\n", err)
+		return 1
+	}
+	if summary.Failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+func replayOptions(stream, from, to, partitions string) (consumer.ReplayOptions, error) {
+	if stream == "" {
+		return consumer.ReplayOptions{}, errors.New("-stream is required")
+	}
+
+	opts := consumer.ReplayOptions{Stream: stream}
+
+	var err error
+	if opts.From, err = consumer.ParseReplayPosition(from); err != nil {
+		return consumer.ReplayOptions{}, fmt.Errorf("-from: %w", err)
+	}
+	if opts.To, err = consumer.ParseReplayPosition(to); err != nil {
+		return consumer.ReplayOptions{}, fmt.Errorf("-to: %w", err)
+	}
+
+	if partitions != "" {
+		for _, p := range strings.Split(partitions, ",") {
+			partition, err := strconv.ParseInt(strings.TrimSpace(p), 10, 32)
+			if err != nil || partition < 0 {
+				return consumer.ReplayOptions{}, fmt.Errorf("-partitions: invalid partition %q", p)
+			}
+			opts.Partitions = append(opts.Partitions, int32(partition))
+		}
+	}
+
+	return opts, nil
+}
+
+func printReplaySummary(s consumer.ReplaySummary) {
+	if s.Stream == "" {
+		return
+	}
+
+	mode := "replay"
+	if s.DryRun {
+		mode = "dry run"
+	}
+
+	fmt.Printf("\n%s of stream %s (topic %s, group %s) finished in %s\n",
+		mode, s.Stream, s.Topic, s.Group, s.Duration.Round(time.Millisecond))
+	for _, p := range s.Partitions {
+		fmt.Printf("  partition %d: offsets [%d, %d) read %d, succeeded %d, failed %d\n",
+			p.Partition, p.StartOffset, p.EndOffset, p.Read, p.Succeeded, p.Failed)
+	}
+	fmt.Printf("total: read %d, succeeded %d, failed %d\n", s.Read, s.Succeeded, s.Failed)
+
+	if len(s.Failures) > 0 {
+		fmt.Println("failures:")
+		for _, f := range s.Failures {
+			fmt.Printf("  partition %d offset %d uuid %s: %s\n", f.Partition, f.Offset, f.UUID, f.Error)
+		}
+		if int64(len(s.Failures)) < s.Failed {
+			fmt.Printf("  ... and %d more\n", s.Failed-int64(len(s.Failures)))
+		}
+	}
+}
@@ -2,10 +2,13 @@ package app
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/log"
@@ -16,10 +19,13 @@ import (
 	"github.com/muazwzxv/kafka-consumer-worker/internal/database"
 	"github.com/muazwzxv/kafka-consumer-worker/internal/database/store"
 	"github.com/muazwzxv/kafka-consumer-worker/internal/handler"
+	adminHandler "github.com/muazwzxv/kafka-consumer-worker/internal/handler/admin"
 	healthHandler "github.com/muazwzxv/kafka-consumer-worker/internal/handler/health"
 	userHandler "github.com/muazwzxv/kafka-consumer-worker/internal/handler/user"
 	"github.com/muazwzxv/kafka-consumer-worker/internal/publisher"
 	"github.com/muazwzxv/kafka-consumer-worker/internal/repository"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/schema"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/schemaregistry"
 	service "github.com/muazwzxv/kafka-consumer-worker/internal/service/user"
 	"github.com/samber/do/v2"
 )
@@ -48,19 +54,10 @@ func NewApplication(cfg *config.Config) (*Application, error) {
 	// Create DI container
 	injector := do.New()
 
-	// Provide configuration as a value (not lazy-loaded)
-	do.ProvideValue(injector, cfg)
+	// Provide configuration, database, repositories and publishers
+	provideCore(injector, cfg)
 
-	// Provide infrastructure components
-	do.Provide(injector, NewDatabase)
 	do.Provide(injector, NewFiberApp)
-	do.Provide(injector, NewQueries)
-
-	// Provide repositories
-	do.Provide(injector, repository.NewUserRepository)
-
-	// Provide publishers
-	do.Provide(injector, publisher.NewUserLifecyclePublisher)
 
 	// Provide services
 	do.Provide(injector, service.NewUserService)
@@ -68,6 +65,7 @@ func NewApplication(cfg *config.Config) (*Application, error) {
 	// Provide handlers
 	do.Provide(injector, healthHandler.NewHealthHandler)
 	do.Provide(injector, userHandler.NewUserHandler)
+	do.Provide(injector, adminHandler.NewAdminHandler)
 
 	do.Provide(injector, consumer.Init)
 
@@ -79,7 +77,7 @@ func NewApplication(cfg *config.Config) (*Application, error) {
 
 	log.Infow("application initialized successfully",
 		"di_enabled", true,
-		"providers_count", 9)
+		"providers_count", 11)
 
 	return &Application{
 		injector: injector,
@@ -88,6 +86,26 @@ func NewApplication(cfg *config.Config) (*Application, error) {
 	}, nil
 }
 
+// provideCore registers the dependencies stream handlers are built from,
+// shared by the server and the replay command.
+func provideCore(injector do.Injector, cfg *config.Config) {
+	// Provide configuration as a value (not lazy-loaded)
+	do.ProvideValue(injector, cfg)
+
+	// Provide infrastructure components
+	do.Provide(injector, NewDatabase)
+	do.Provide(injector, NewQueries)
+	do.Provide(injector, NewSchemaRegistry)
+	do.Provide(injector, NewSchemaRegistryClient)
+
+	// Provide repositories
+	do.Provide(injector, repository.NewUserRepository)
+	do.Provide(injector, repository.NewProcessedMessageRepository)
+
+	// Provide publishers
+	do.Provide(injector, publisher.NewUserLifecyclePublisher)
+}
+
 // setLogLevel configures the global log level from config string
 func setLogLevel(level string) error {
 	switch strings.ToLower(level) {
@@ -157,11 +175,25 @@ func NewQueries(i do.Injector) (*store.Queries, error) {
 	return store.New(), nil
 }
 
+// NewSchemaRegistry compiles the JSON schemas embedded in internal/schema
+func NewSchemaRegistry(i do.Injector) (*schema.Registry, error) {
+	return schema.NewRegistry()
+}
+
+// NewSchemaRegistryClient creates the client of the external schema
+// registry. It is only resolved by streams and publishers using avro or
+// protobuf, so the registry URL is optional otherwise.
+func NewSchemaRegistryClient(i do.Injector) (*schemaregistry.Client, error) {
+	cfg := do.MustInvoke[*config.Config](i)
+	return schemaregistry.NewClient(cfg.SchemaRegistry)
+}
+
 // RegisterRoutes registers all HTTP routes by invoking handlers from DI container
 func RegisterRoutes(app *fiber.App, injector do.Injector) {
 	// Invoke handlers from DI container and register their routes
 	do.MustInvoke[*healthHandler.HealthHandler](injector).RegisterRoutes(app)
 	do.MustInvoke[*userHandler.UserHandler](injector).RegisterRoutes(app)
+	do.MustInvoke[*adminHandler.AdminHandler](injector).RegisterRoutes(app)
 }
 
 // Start starts the HTTP server and handles graceful shutdown
@@ -172,8 +204,12 @@ func (a *Application) Start() error {
 		"host", a.config.Server.Host,
 		"port", a.config.Server.Port)
 
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(signals)
+
 	// Start server in goroutine
-	errChan := make(chan error, 1)
+	errChan := make(chan error, 2)
 	go func() {
 		if err := a.app.Listen(addr); err != nil {
 			errChan <- err
@@ -181,34 +217,129 @@ func (a *Application) Start() error {
 	}()
 
 	// Start consumer worker in goroutine
+	consumerCtx, cancelConsumer := context.WithCancel(context.Background())
+	defer cancelConsumer()
 	go func() {
-		consumerContext := context.Background()
 		consumer := do.MustInvoke[*consumer.Consumer](a.injector)
-		if err := consumer.Start(consumerContext); err != nil {
+		if err := consumer.Start(consumerCtx); err != nil {
 			errChan <- err
 		}
 	}()
 
-	// Handle graceful shutdown with DI container
-	go func() {
-		signal, _ := a.injector.RootScope().ShutdownOnSignals(syscall.SIGTERM, os.Interrupt)
-		log.Infow("application received shutdown signal", "signal", signal)
+	var runErr error
+	select {
+	case sig := <-signals:
+		log.Infow("application received shutdown signal", "signal", sig)
+	case runErr = <-errChan:
+		log.Errorw("application component failed, shutting down", "error", runErr)
+	}
+
+	a.shutdown(cancelConsumer)
+
+	return runErr
+}
+
+// shutdown stops the application in dependency order: HTTP first so no new
+// work arrives, then the consumer, then the publishers the remaining work
+// may still use, and finally the database. The publishers and database are
+// only closed once the consumer has stopped, even past its deadline.
+func (a *Application) shutdown(cancelConsumer context.CancelFunc) {
+	started := time.Now()
+	cfg := a.config.Shutdown
 
-		if pub, err := do.Invoke[*publisher.UserLifecyclePublisher](a.injector); err == nil {
-			if err := pub.Close(); err != nil {
-				log.Errorw("failed to close user lifecycle publisher", "error", err)
-			}
+	runShutdownPhase("http", cfg.HTTPTimeout, func(ctx context.Context) error {
+		return a.app.ShutdownWithContext(ctx)
+	})
+
+	consumerStopped := runShutdownPhase("consumer_drain", cfg.DrainTimeout, func(ctx context.Context) error {
+		cancelConsumer()
+		c, err := do.Invoke[*consumer.Consumer](a.injector)
+		if err != nil {
+			return nil
 		}
+		return c.Shutdown(ctx)
+	})
+
+	// Handlers cut off at the drain deadline may still be using the
+	// publishers and the database, so those stay open until the consumer
+	// has seen every handler return.
+	waitForShutdownPhase("consumer_drain", consumerStopped)
 
-		if err := a.app.Shutdown(); err != nil {
-			log.Errorw("application shutdown error", "error", err)
+	runShutdownPhase("publishers", cfg.CloseTimeout, func(ctx context.Context) error {
+		pub, err := do.Invoke[*publisher.UserLifecyclePublisher](a.injector)
+		if err != nil {
+			return nil
 		}
+		return pub.Close()
+	})
 
-		log.Info("application shutdown complete")
-		errChan <- nil
+	runShutdownPhase("database", cfg.CloseTimeout, func(ctx context.Context) error {
+		db, err := do.Invoke[*database.Database](a.injector)
+		if err != nil {
+			return nil
+		}
+		return db.Shutdown()
+	})
+
+	log.Infow("application shutdown complete",
+		"duration", time.Since(started))
+}
+
+// runShutdownPhase runs fn with its own deadline and logs how long it took
+// and whether it finished in time. It returns once fn has returned or the
+// deadline has passed, whichever is first; the returned channel is closed
+// when fn has returned.
+func runShutdownPhase(name string, timeout time.Duration, fn func(ctx context.Context) error) <-chan struct{} {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+
+	started := time.Now()
+	done := make(chan error, 1)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		defer cancel()
+		done <- fn(ctx)
 	}()
 
-	return <-errChan
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	timedOut := errors.Is(err, context.DeadlineExceeded)
+	if err != nil && !timedOut {
+		log.Errorw("application shutdown phase failed",
+			"phase", name,
+			"duration", time.Since(started),
+			"timed_out", false,
+			"error", err)
+		return stopped
+	}
+
+	log.Infow("application shutdown phase finished",
+		"phase", name,
+		"duration", time.Since(started),
+		"timed_out", timedOut)
+	return stopped
+}
+
+// waitForShutdownPhase blocks until a phase that outlived its deadline has
+// returned.
+func waitForShutdownPhase(name string, stopped <-chan struct{}) {
+	select {
+	case <-stopped:
+		return
+	default:
+	}
+
+	started := time.Now()
+	log.Warnw("application waiting for shutdown phase past its deadline", "phase", name)
+	<-stopped
+	log.Infow("application shutdown phase returned",
+		"phase", name,
+		"waited", time.Since(started))
 }
 
 // Init initializes the application with config loaded from default locations
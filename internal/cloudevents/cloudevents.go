@@ -0,0 +1,269 @@
+// Package cloudevents maps messages to and from CloudEvents 1.0 in the two
+// content modes of the Kafka protocol binding: binary mode, with the event
+// attributes in ce_ headers and the data as the payload, and structured
+// mode, with the whole event as a JSON envelope in the payload.
+package cloudevents
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+const SpecVersion = "1.0"
+
+// Content modes publishers select.
+const (
+	ModeBinary     = "binary"
+	ModeStructured = "structured"
+)
+
+const (
+	// HeaderPrefix prefixes the attribute headers of binary mode events.
+	HeaderPrefix = "ce_"
+	// ContentTypeKey is the header holding the datacontenttype of binary
+	// mode events and ContentTypeStructured for structured mode ones.
+	ContentTypeKey        = "content-type"
+	ContentTypeStructured = "application/cloudevents+json"
+	ContentTypeJSON       = "application/json"
+)
+
+// Event holds the context attributes of a CloudEvent.
+type Event struct {
+	ID          string
+	Source      string
+	Type        string
+	SpecVersion string
+	// Time is when the occurrence happened; zero when not set.
+	Time            time.Time
+	Subject         string
+	DataContentType string
+	DataSchema      string
+	// Extensions holds any other attributes, by name.
+	Extensions map[string]string
+}
+
+// Describer is implemented by payloads that know the type and subject of
+// the event they are published as.
+type Describer interface {
+	CloudEventType() string
+	CloudEventSubject() string
+}
+
+// Validate checks the attributes every event must have.
+func (e Event) Validate() error {
+	var missing []string
+	for _, attr := range []struct{ name, value string }{
+		{"id", e.ID},
+		{"source", e.Source},
+		{"type", e.Type},
+		{"specversion", e.SpecVersion},
+	} {
+		if attr.value == "" {
+			missing = append(missing, attr.name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("cloudevent is missing %s", strings.Join(missing, ", "))
+	}
+	if e.SpecVersion != SpecVersion {
+		return fmt.Errorf("unsupported cloudevents specversion %q", e.SpecVersion)
+	}
+	return nil
+}
+
+// SetHeaders writes e to md as binary mode headers.
+func SetHeaders(md message.Metadata, e Event) {
+	set := func(name, value string) {
+		if value != "" {
+			md.Set(HeaderPrefix+name, value)
+		}
+	}
+
+	set("specversion", e.SpecVersion)
+	set("id", e.ID)
+	set("source", e.Source)
+	set("type", e.Type)
+	if !e.Time.IsZero() {
+		set("time", e.Time.UTC().Format(time.RFC3339Nano))
+	}
+	set("subject", e.Subject)
+	set("dataschema", e.DataSchema)
+	for name, value := range e.Extensions {
+		set(name, value)
+	}
+	if e.DataContentType != "" {
+		md.Set(ContentTypeKey, e.DataContentType)
+	}
+}
+
+// FromHeaders reads a binary mode event from md. It reports false if md
+// carries no ce_specversion header.
+func FromHeaders(md message.Metadata) (Event, bool) {
+	specVersion := md.Get(HeaderPrefix + "specversion")
+	if specVersion == "" {
+		return Event{}, false
+	}
+
+	e := Event{
+		SpecVersion:     specVersion,
+		DataContentType: md.Get(ContentTypeKey),
+	}
+	for key, value := range md {
+		name, ok := strings.CutPrefix(key, HeaderPrefix)
+		if !ok {
+			continue
+		}
+		e.setAttribute(name, value)
+	}
+	return e, true
+}
+
+func (e *Event) setAttribute(name, value string) {
+	switch name {
+	case "specversion":
+		e.SpecVersion = value
+	case "id":
+		e.ID = value
+	case "source":
+		e.Source = value
+	case "type":
+		e.Type = value
+	case "time":
+		e.Time, _ = time.Parse(time.RFC3339Nano, value)
+	case "subject":
+		e.Subject = value
+	case "datacontenttype":
+		e.DataContentType = value
+	case "dataschema":
+		e.DataSchema = value
+	default:
+		if e.Extensions == nil {
+			e.Extensions = make(map[string]string)
+		}
+		e.Extensions[name] = value
+	}
+}
+
+// IsStructured reports whether md marks a structured mode event.
+func IsStructured(md message.Metadata) bool {
+	mediaType, _, err := mime.ParseMediaType(md.Get(ContentTypeKey))
+	return err == nil && mediaType == ContentTypeStructured
+}
+
+// IsJSON reports whether contentType is JSON. An empty content type is
+// JSON, the CloudEvents default.
+func IsJSON(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == ContentTypeJSON || strings.HasSuffix(mediaType, "+json"))
+}
+
+// Marshal returns the structured mode envelope of e with data. JSON data
+// is embedded as is; anything else is base64-encoded in data_base64.
+func Marshal(e Event, data []byte) ([]byte, error) {
+	envelope := map[string]any{
+		"specversion": e.SpecVersion,
+		"id":          e.ID,
+		"source":      e.Source,
+		"type":        e.Type,
+	}
+	for name, value := range e.Extensions {
+		envelope[name] = value
+	}
+	if !e.Time.IsZero() {
+		envelope["time"] = e.Time.UTC().Format(time.RFC3339Nano)
+	}
+	if e.Subject != "" {
+		envelope["subject"] = e.Subject
+	}
+	if e.DataContentType != "" {
+		envelope["datacontenttype"] = e.DataContentType
+	}
+	if e.DataSchema != "" {
+		envelope["dataschema"] = e.DataSchema
+	}
+
+	switch {
+	case data == nil:
+	case IsJSON(e.DataContentType):
+		if !json.Valid(data) {
+			return nil, errors.New("cloudevent data is not valid JSON")
+		}
+		envelope["data"] = json.RawMessage(data)
+	default:
+		envelope["data_base64"] = data
+	}
+
+	return json.Marshal(envelope)
+}
+
+// Unmarshal parses a structured mode envelope into the event and its data.
+func Unmarshal(payload []byte) (Event, []byte, error) {
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &envelope); err != nil {
+		return Event{}, nil, fmt.Errorf("decode cloudevent envelope: %w", err)
+	}
+
+	var (
+		e    Event
+		data []byte
+	)
+	for name, raw := range envelope {
+		switch name {
+		case "data":
+			data = raw
+		case "data_base64":
+			if err := json.Unmarshal(raw, &data); err != nil {
+				return Event{}, nil, fmt.Errorf("decode cloudevent data_base64: %w", err)
+			}
+		default:
+			var value string
+			if err := json.Unmarshal(raw, &value); err != nil {
+				// Extensions may be numbers or booleans.
+				value = string(raw)
+			}
+			e.setAttribute(name, value)
+		}
+	}
+
+	// String data of a non-JSON content type is the data itself.
+	if raw, ok := envelope["data"]; ok && !IsJSON(e.DataContentType) {
+		var text string
+		if json.Unmarshal(raw, &text) == nil {
+			data = []byte(text)
+		}
+	}
+
+	if err := e.Validate(); err != nil {
+		return Event{}, nil, err
+	}
+	return e, data, nil
+}
+
+// ToBinary turns a structured mode message into the equivalent binary
+// mode one in place, so everything downstream reads the data from the
+// payload and the attributes from headers. It reports whether msg was
+// structured.
+func ToBinary(msg *message.Message) (bool, error) {
+	if !IsStructured(msg.Metadata) {
+		return false, nil
+	}
+
+	e, data, err := Unmarshal(msg.Payload)
+	if err != nil {
+		return true, err
+	}
+
+	delete(msg.Metadata, ContentTypeKey)
+	SetHeaders(msg.Metadata, e)
+	msg.Payload = data
+	return true, nil
+}
@@ -0,0 +1,210 @@
+package cloudevents
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+func testEvent() Event {
+	return Event{
+		ID:              "9b2c3f4e-1a2b-4c3d-8e9f-0a1b2c3d4e5f",
+		Source:          "/kafka-consumer-worker/users",
+		Type:            "user.activated",
+		SpecVersion:     SpecVersion,
+		Time:            time.Date(2026, 3, 1, 12, 30, 0, 500, time.UTC),
+		Subject:         "user-42",
+		DataContentType: ContentTypeJSON,
+		Extensions:      map[string]string{"traceparent": "00-abc-def-01"},
+	}
+}
+
+func TestMarshalUnmarshalJSONData(t *testing.T) {
+	want := testEvent()
+	data := []byte(`{"uuid":"user-42","status":"active"}`)
+
+	payload, err := Marshal(want, data)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &envelope); err != nil {
+		t.Fatalf("envelope is not JSON: %v", err)
+	}
+	if string(envelope["data"]) != string(data) {
+		t.Errorf("data = %s, want it embedded as is", envelope["data"])
+	}
+
+	got, gotData, err := Unmarshal(payload)
+	if err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Unmarshal event = %+v, want %+v", got, want)
+	}
+	if string(gotData) != string(data) {
+		t.Errorf("Unmarshal data = %s, want %s", gotData, data)
+	}
+}
+
+func TestMarshalUnmarshalBinaryData(t *testing.T) {
+	want := testEvent()
+	want.DataContentType = "application/avro"
+	data := []byte{0, 0, 0, 0, 1, 0xff, 0x10}
+
+	payload, err := Marshal(want, data)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if !strings.Contains(string(payload), `"data_base64"`) {
+		t.Errorf("envelope %s has no data_base64", payload)
+	}
+
+	_, gotData, err := Unmarshal(payload)
+	if err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if string(gotData) != string(data) {
+		t.Errorf("Unmarshal data = %v, want %v", gotData, data)
+	}
+}
+
+func TestMarshalRejectsInvalidJSONData(t *testing.T) {
+	if _, err := Marshal(testEvent(), []byte(`{"uuid":`)); err == nil {
+		t.Fatal("Marshal of invalid JSON data succeeded, want an error")
+	}
+}
+
+func TestUnmarshalStringDataOfTextContentType(t *testing.T) {
+	payload := []byte(`{"specversion":"1.0","id":"1","source":"/s","type":"t","datacontenttype":"text/plain","data":"hello"}`)
+
+	_, data, err := Unmarshal(payload)
+	if err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if string(data) != "hello" {
+		t.Errorf("data = %q, want %q", data, "hello")
+	}
+}
+
+func TestUnmarshalNonStringExtensions(t *testing.T) {
+	payload := []byte(`{"specversion":"1.0","id":"1","source":"/s","type":"t","sequence":42,"sampled":true}`)
+
+	e, _, err := Unmarshal(payload)
+	if err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if e.Extensions["sequence"] != "42" || e.Extensions["sampled"] != "true" {
+		t.Errorf("Extensions = %v, want sequence 42 and sampled true", e.Extensions)
+	}
+}
+
+func TestUnmarshalRejectsInvalidEvents(t *testing.T) {
+	payloads := map[string]string{
+		"not JSON":            `{"specversion":`,
+		"missing id":          `{"specversion":"1.0","source":"/s","type":"t"}`,
+		"unknown specversion": `{"specversion":"0.3","id":"1","source":"/s","type":"t"}`,
+		"bad data_base64":     `{"specversion":"1.0","id":"1","source":"/s","type":"t","data_base64":"%%%"}`,
+	}
+	for name, payload := range payloads {
+		if _, _, err := Unmarshal([]byte(payload)); err == nil {
+			t.Errorf("%s: Unmarshal succeeded, want an error", name)
+		}
+	}
+}
+
+func TestHeadersRoundTrip(t *testing.T) {
+	want := testEvent()
+	md := message.Metadata{}
+	SetHeaders(md, want)
+
+	if md.Get(ContentTypeKey) != ContentTypeJSON {
+		t.Errorf("content-type = %q, want %q", md.Get(ContentTypeKey), ContentTypeJSON)
+	}
+
+	got, ok := FromHeaders(md)
+	if !ok {
+		t.Fatal("FromHeaders found no event")
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FromHeaders = %+v, want %+v", got, want)
+	}
+
+	if _, ok := FromHeaders(message.Metadata{"content-type": ContentTypeJSON}); ok {
+		t.Error("FromHeaders found an event without ce_specversion")
+	}
+}
+
+func TestToBinary(t *testing.T) {
+	e := testEvent()
+	data := []byte(`{"uuid":"user-42"}`)
+	payload, err := Marshal(e, data)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	msg := message.NewMessage(watermill.NewUUID(), payload)
+	msg.Metadata.Set(ContentTypeKey, ContentTypeStructured+"; charset=utf-8")
+	msg.Metadata.Set("correlation_id", "c-1")
+
+	structured, err := ToBinary(msg)
+	if err != nil || !structured {
+		t.Fatalf("ToBinary = %v, %v; want a converted structured event", structured, err)
+	}
+	if string(msg.Payload) != string(data) {
+		t.Errorf("payload = %s, want the event data %s", msg.Payload, data)
+	}
+	if got, ok := FromHeaders(msg.Metadata); !ok || !reflect.DeepEqual(got, e) {
+		t.Errorf("headers hold %+v, want %+v", got, e)
+	}
+	if msg.Metadata.Get("correlation_id") != "c-1" {
+		t.Error("ToBinary dropped unrelated headers")
+	}
+}
+
+func TestToBinaryLeavesOtherMessages(t *testing.T) {
+	payload := []byte(`{"uuid":"user-42"}`)
+	msg := message.NewMessage(watermill.NewUUID(), payload)
+	msg.Metadata.Set(ContentTypeKey, ContentTypeJSON)
+
+	structured, err := ToBinary(msg)
+	if err != nil || structured {
+		t.Fatalf("ToBinary = %v, %v; want the message left alone", structured, err)
+	}
+	if string(msg.Payload) != string(payload) {
+		t.Errorf("payload = %s, want it unchanged", msg.Payload)
+	}
+}
+
+func TestToBinaryReportsInvalidEnvelope(t *testing.T) {
+	msg := message.NewMessage(watermill.NewUUID(), []byte(`{"data":{}}`))
+	msg.Metadata.Set(ContentTypeKey, ContentTypeStructured)
+
+	structured, err := ToBinary(msg)
+	if !structured || err == nil {
+		t.Fatalf("ToBinary = %v, %v; want a structured event that fails to convert", structured, err)
+	}
+}
+
+func TestIsJSON(t *testing.T) {
+	tests := map[string]bool{
+		"":                                true,
+		"application/json":                true,
+		"application/json; charset=utf-8": true,
+		"application/cloudevents+json":    true,
+		"application/avro":                false,
+		"text/plain":                      false,
+		"not a media type;;":              false,
+	}
+	for contentType, want := range tests {
+		if got := IsJSON(contentType); got != want {
+			t.Errorf("IsJSON(%q) = %v, want %v", contentType, got, want)
+		}
+	}
+}
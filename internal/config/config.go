@@ -15,20 +15,280 @@ type Config struct {
 	Kafka      KafkaConfig      `mapstructure:"kafka"`
 	Streams    StreamConfigs    `mapstructure:"streams"`
 	Publishers PublisherConfigs `mapstructure:"publishers"`
+	Shutdown   ShutdownConfig   `mapstructure:"shutdown"`
+	// Idempotency controls retention of the processed-message records used
+	// by streams with idempotency enabled.
+	Idempotency IdempotencyConfig `mapstructure:"idempotency"`
+	// CircuitBreaker pauses the streams that opt in while the database is
+	// failing.
+	CircuitBreaker CircuitBreakerConfig `mapstructure:"circuit_breaker"`
+	Health         HealthConfig         `mapstructure:"health"`
+	Admin          AdminConfig          `mapstructure:"admin"`
+	// SchemaRegistry is used by streams and publishers with the avro or
+	// protobuf encoding.
+	SchemaRegistry SchemaRegistryConfig `mapstructure:"schema_registry"`
+}
+
+// SchemaRegistryConfig points at a Confluent-compatible schema registry
+type SchemaRegistryConfig struct {
+	URL string `mapstructure:"url"`
+	// Username and Password enable basic auth.
+	Username string        `mapstructure:"username"`
+	Password string        `mapstructure:"password"`
+	Timeout  time.Duration `mapstructure:"timeout"`
+	// CacheTTL is how long the latest schema of a subject is cached before
+	// the registry is asked again. Schemas looked up by ID never change and
+	// stay cached.
+	CacheTTL time.Duration `mapstructure:"cache_ttl"`
+}
+
+// AdminConfig protects the admin API routes that change stream state
+type AdminConfig struct {
+	// Token must be sent as "Authorization: Bearer <token>" to pause,
+	// resume or rate limit a stream. Empty disables those routes; the
+	// read-only routes stay open.
+	Token string `mapstructure:"token"`
+}
+
+// HealthConfig controls how health contributors affect /health and
+// /health/ready
+type HealthConfig struct {
+	// Critical lists the contributors whose failure marks /health degraded
+	// and fails readiness; the rest are informational. Names: database,
+	// consumer, consumer_lag, circuit_breaker, stream_publisher,
+	// publisher:<name>.
+	Critical []string `mapstructure:"critical"`
 }
 
 type KafkaConfig struct {
+	// Brokers lists the bootstrap brokers of the cluster.
+	Brokers []string `mapstructure:"brokers"`
+	// Broker is a single bootstrap broker, used when Brokers is empty.
+	//
+	// Deprecated: use Brokers.
 	Broker        string `mapstructure:"broker"`
 	ConsumerGroup string `mapstructure:"consumer_group"`
+	// ClientID identifies the service in broker logs and quotas.
+	ClientID string `mapstructure:"client_id"`
+	// Version is the Kafka protocol version to speak, e.g. 3.6.0. Empty
+	// keeps the client default.
+	Version      string          `mapstructure:"version"`
+	DialTimeout  time.Duration   `mapstructure:"dial_timeout"`
+	ReadTimeout  time.Duration   `mapstructure:"read_timeout"`
+	WriteTimeout time.Duration   `mapstructure:"write_timeout"`
+	TLS          KafkaTLSConfig  `mapstructure:"tls"`
+	SASL         KafkaSASLConfig `mapstructure:"sasl"`
+	// NackResendSleep is how long the subscriber waits before redelivering
+	// a nacked message.
+	NackResendSleep time.Duration `mapstructure:"nack_resend_sleep"`
+	// Group tunes how the service takes part in ConsumerGroup.
+	Group ConsumerGroupConfig `mapstructure:"group"`
+	Lag   LagConfig           `mapstructure:"lag"`
+}
+
+// BrokerAddrs returns Brokers, or Broker when no list is configured.
+func (c KafkaConfig) BrokerAddrs() []string {
+	if len(c.Brokers) > 0 {
+		return c.Brokers
+	}
+	if c.Broker != "" {
+		return []string{c.Broker}
+	}
+	return nil
+}
+
+// KafkaTLSConfig enables TLS to the brokers
+type KafkaTLSConfig struct {
+	Enable bool `mapstructure:"enable"`
+	// CAFile verifies the brokers' certificates; empty uses the system
+	// roots.
+	CAFile string `mapstructure:"ca_file"`
+	// CertFile and KeyFile hold the client certificate for mutual TLS.
+	CertFile string `mapstructure:"cert_file"`
+	KeyFile  string `mapstructure:"key_file"`
+	// InsecureSkipVerify disables certificate verification. Only for local
+	// clusters with self-signed certificates.
+	InsecureSkipVerify bool `mapstructure:"insecure_skip_verify"`
+}
+
+// KafkaSASLConfig enables SASL authentication to the brokers
+type KafkaSASLConfig struct {
+	Enable bool `mapstructure:"enable"`
+	// Mechanism options: PLAIN, SCRAM-SHA-256, SCRAM-SHA-512.
+	Mechanism string `mapstructure:"mechanism"`
+	Username  string `mapstructure:"username"`
+	Password  string `mapstructure:"password"`
+}
+
+// ConsumerGroupConfig holds the consumer group settings of the subscriber
+type ConsumerGroupConfig struct {
+	// InitialOffset is where the group starts on partitions it has no
+	// committed offset for. Options: oldest, newest.
+	InitialOffset string `mapstructure:"initial_offset"`
+	// AutoCommitInterval is how often acked offsets are committed.
+	AutoCommitInterval time.Duration `mapstructure:"auto_commit_interval"`
+	// SessionTimeout is how long the broker waits for a heartbeat before
+	// removing the member from the group. HeartbeatInterval must be lower,
+	// typically a third of it.
+	SessionTimeout    time.Duration `mapstructure:"session_timeout"`
+	HeartbeatInterval time.Duration `mapstructure:"heartbeat_interval"`
+	// RebalanceTimeout is how long members get to rejoin during a
+	// rebalance, flushing in-flight messages included.
+	RebalanceTimeout time.Duration `mapstructure:"rebalance_timeout"`
+	// RebalanceStrategy options: range, roundrobin, sticky.
+	RebalanceStrategy string `mapstructure:"rebalance_strategy"`
+	// RebalanceHooks logs partition assignment and revocation, and
+	// finishes the messages in flight on a partition before it is revoked
+	// so their offsets are committed instead of being redelivered to the
+	// next owner.
+	RebalanceHooks bool `mapstructure:"rebalance_hooks"`
 }
 
-type StreamConfigs struct {
-	UserLifecycle StreamConfig `mapstructure:"user_lifecycle"`
+// LagConfig controls consumer lag reporting
+type LagConfig struct {
+	CheckInterval time.Duration `mapstructure:"check_interval"`
+	// MaxLag is the total lag across all subscribed partitions above which
+	// the consumer_lag health contributor is unhealthy. 0 disables the
+	// check.
+	MaxLag int64 `mapstructure:"max_lag"`
 }
 
+// StreamConfigs maps each stream name to its config, one [streams.<name>]
+// table per stream.
+type StreamConfigs map[string]StreamConfig
+
 type StreamConfig struct {
 	Enable bool   `mapstructure:"enable"`
 	Topic  string `mapstructure:"topic"`
+	// Handler names the registered handler factory that builds the stream's
+	// handler. Defaults to the stream name.
+	Handler string `mapstructure:"handler"`
+	// Options holds handler-specific settings, decoded by the handler
+	// factory.
+	Options map[string]any `mapstructure:"options"`
+	// Decoder names the payload decoder of typed handlers. Options: json
+	// (ignores unknown fields), json_strict (rejects them), avro, protobuf.
+	// Avro and protobuf payloads are in the schema registry wire format and
+	// are decoded with the writer's schema from the registry; they cannot
+	// be combined with Schema or a payload idempotency key.
+	Decoder string `mapstructure:"decoder"`
+	// PublishTopic receives the messages produced by the stream's handler,
+	// which must implement streamHandler.ProducingHandler.
+	PublishTopic string `mapstructure:"publish_topic"`
+	// DeadLetterTopic receives messages the handler failed to process.
+	// Leave empty to drop failed messages after logging them.
+	DeadLetterTopic string `mapstructure:"dead_letter_topic"`
+	// Concurrency is the number of workers processing the stream. Messages
+	// with the same Kafka key always go to the same worker, so per-key order
+	// is preserved. The subscriber only hands out the next message of a
+	// partition once the previous one is acked, so at most one message per
+	// assigned partition is in flight: workers beyond the number of
+	// partitions assigned to this instance stay idle.
+	Concurrency int `mapstructure:"concurrency"`
+	// QueueDepth is the number of messages buffered per worker.
+	QueueDepth int `mapstructure:"queue_depth"`
+	// BatchSize enables batch processing when greater than 1. The stream's
+	// handler must implement streamHandler.BatchMessageHandler. A batch
+	// holds at most one message per assigned partition, so a BatchSize
+	// above the partition count never fills and every batch waits
+	// BatchLinger; startup warns when it exceeds the topic's partitions.
+	BatchSize int `mapstructure:"batch_size"`
+	// BatchLinger is how long a partial batch waits for more messages.
+	BatchLinger time.Duration `mapstructure:"batch_linger"`
+	// HandlerTimeout bounds each attempt of the handler through its
+	// context. An attempt failing after the deadline fails as transient
+	// with a timeout error. The handler must watch its context: the
+	// attempt is never abandoned, so the message is not retried while it
+	// still runs. 0 disables the deadline.
+	HandlerTimeout time.Duration `mapstructure:"handler_timeout"`
+	// CircuitBreaker places the stream under the consumer's circuit
+	// breaker: it is paused while the circuit is open. A message failing
+	// while the circuit is open is nacked for redelivery once, even if the
+	// retry classifier would not retry it; after that its failures are
+	// classified as usual.
+	CircuitBreaker bool                    `mapstructure:"circuit_breaker"`
+	Retry          RetryConfig             `mapstructure:"retry"`
+	RetryTopics    RetryTopicsConfig       `mapstructure:"retry_topics"`
+	Idempotency    StreamIdempotencyConfig `mapstructure:"idempotency"`
+	Middleware     MiddlewareConfig        `mapstructure:"middleware"`
+	RateLimit      RateLimitConfig         `mapstructure:"rate_limit"`
+	// Schema validates each message against a JSON Schema before it
+	// reaches the handler; messages that do not match are dead-lettered.
+	Schema SchemaConfig `mapstructure:"schema"`
+}
+
+// SchemaConfig selects the embedded JSON Schema payloads are validated
+// against.
+type SchemaConfig struct {
+	Enable bool `mapstructure:"enable"`
+	// Subject names the schemas to use. Streams default to the stream
+	// name. Each payload is checked against the schema of the version in
+	// its version field, v1 when it has none.
+	Subject string `mapstructure:"subject"`
+}
+
+// RateLimitConfig is a token bucket bounding how fast a stream takes new
+// messages from Kafka. It can be changed at runtime through the admin API.
+type RateLimitConfig struct {
+	// PerSecond is the sustained rate in messages per second; 0 disables
+	// the limit.
+	PerSecond float64 `mapstructure:"per_second"`
+	// Burst is how many messages can be taken at once after the stream has
+	// been idle. It must be at least 1 when PerSecond is set.
+	Burst int `mapstructure:"burst"`
+}
+
+// MiddlewareConfig configures the middleware chain wrapping a stream's
+// handler.
+type MiddlewareConfig struct {
+	// Chain lists the middleware applied to the handler, outermost first.
+	// Options: correlation_id, throttle, poison_queue, retry, recoverer,
+	// timeout.
+	Chain []string `mapstructure:"chain"`
+	// Timeout bounds everything inside the timeout middleware when it is
+	// in the chain, e.g. all attempts when listed before retry. Single
+	// attempts are bounded by StreamConfig.HandlerTimeout.
+	Timeout time.Duration `mapstructure:"timeout"`
+	// ThrottlePerSecond caps the messages handled per second when throttle
+	// is in the chain.
+	ThrottlePerSecond int64 `mapstructure:"throttle_per_second"`
+}
+
+// StreamIdempotencyConfig enables skipping messages that were already
+// processed, e.g. after a redelivery.
+type StreamIdempotencyConfig struct {
+	Enable bool `mapstructure:"enable"`
+	// Key selects the idempotency key. Options: message_uuid (default),
+	// kafka_key, metadata:<header>, payload:<json field>.
+	Key string `mapstructure:"key"`
+}
+
+// RetryTopicsConfig moves failed messages to delayed retry topics instead of
+// retrying them in place, so a failing message does not hold up the rest of
+// its partition. The poison_queue middleware does the routing: a failed
+// message goes to the next tier, and from the last tier to the dead-letter
+// topic. Permanent failures skip the tiers.
+type RetryTopicsConfig struct {
+	Enable bool `mapstructure:"enable"`
+	// Delays lists the tiers in order. Each tier's topic is
+	// <topic>.retry.<delay>, e.g. user-lifecycle-events.retry.5s, and its
+	// messages are held until the delay has passed since they failed.
+	Delays []time.Duration `mapstructure:"delays"`
+}
+
+// RetryConfig controls how often a failed message is re-run through its
+// handler before it is treated as failed.
+type RetryConfig struct {
+	// MaxAttempts includes the first attempt; 1 disables retries.
+	MaxAttempts     int           `mapstructure:"max_attempts"`
+	InitialInterval time.Duration `mapstructure:"initial_interval"`
+	Multiplier      float64       `mapstructure:"multiplier"`
+	MaxInterval     time.Duration `mapstructure:"max_interval"`
+	// Jitter randomizes each interval by up to this fraction (0.2 = ±20%).
+	Jitter float64 `mapstructure:"jitter"`
+	// Classifier names the rule deciding which errors are retried.
+	// Options: transient, all, none.
+	Classifier string `mapstructure:"classifier"`
 }
 
 type PublisherConfigs struct {
@@ -38,6 +298,33 @@ type PublisherConfigs struct {
 type PublisherConfig struct {
 	Enable bool   `mapstructure:"enable"`
 	Topic  string `mapstructure:"topic"`
+	// Encoding is the payload format. Options: json, avro, protobuf. Avro
+	// and protobuf payloads are encoded with the latest schema registered
+	// under RegistrySubject and written in the schema registry wire format.
+	Encoding string `mapstructure:"encoding"`
+	// RegistrySubject defaults to <topic>-value.
+	RegistrySubject string `mapstructure:"registry_subject"`
+	// EventVersion publishes versioned events at an older version while
+	// consumers migrate; 0 publishes the current version.
+	EventVersion int `mapstructure:"event_version"`
+	// Schema validates every payload before it is published. Only for the
+	// json encoding.
+	Schema SchemaConfig `mapstructure:"schema"`
+	// CloudEvents publishes payloads as CloudEvents 1.0.
+	CloudEvents CloudEventsConfig `mapstructure:"cloudevents"`
+}
+
+// CloudEventsConfig wraps published payloads as CloudEvents. The type and
+// subject attributes come from the payload, which must implement
+// cloudevents.Describer; the id is the message UUID.
+type CloudEventsConfig struct {
+	Enable bool `mapstructure:"enable"`
+	// Mode options: binary (attributes in ce_ headers, the payload is the
+	// data), structured (a JSON envelope holding attributes and data).
+	Mode string `mapstructure:"mode"`
+	// Source is the source attribute, a URI reference identifying the
+	// publisher.
+	Source string `mapstructure:"source"`
 }
 
 // ServerConfig holds Fiber server configuration
@@ -51,6 +338,40 @@ type ServerConfig struct {
 	Prefork      bool          `mapstructure:"prefork"`
 }
 
+// ShutdownConfig holds the deadlines for each graceful shutdown phase
+type ShutdownConfig struct {
+	HTTPTimeout  time.Duration `mapstructure:"http_timeout"`
+	DrainTimeout time.Duration `mapstructure:"drain_timeout"`
+	CloseTimeout time.Duration `mapstructure:"close_timeout"`
+}
+
+// IdempotencyConfig holds the processed-message cleanup settings
+type IdempotencyConfig struct {
+	// Retention is how long processed-message records are kept. A duplicate
+	// arriving after this window is processed again. 0 disables cleanup.
+	Retention        time.Duration `mapstructure:"retention"`
+	CleanupInterval  time.Duration `mapstructure:"cleanup_interval"`
+	CleanupBatchSize int           `mapstructure:"cleanup_batch_size"`
+}
+
+// CircuitBreakerConfig holds the consumer's circuit breaker settings
+type CircuitBreakerConfig struct {
+	Enable bool `mapstructure:"enable"`
+	// FailureThreshold is how many consecutive handler failures open the
+	// circuit. Permanent failures, such as undecodable payloads, are not
+	// counted.
+	FailureThreshold int `mapstructure:"failure_threshold"`
+	// HealthCheckInterval is how often the database health check runs.
+	// A failed check opens the circuit straight away.
+	HealthCheckInterval time.Duration `mapstructure:"health_check_interval"`
+	// OpenTimeout is how long the circuit stays open before probing the
+	// database again.
+	OpenTimeout time.Duration `mapstructure:"open_timeout"`
+	// HalfOpenSuccesses is how many messages must succeed after a passing
+	// probe before the circuit closes.
+	HalfOpenSuccesses int `mapstructure:"half_open_successes"`
+}
+
 // DatabaseConfig holds database configuration
 type DatabaseConfig struct {
 	Host            string        `mapstructure:"host"`
@@ -103,6 +424,11 @@ func LoadConfig() (*Config, error) {
 		// Config file not found; will use defaults + environment variables
 	}
 
+	// Streams declared in the config file get the shared stream defaults
+	for name := range v.GetStringMap("streams") {
+		setStreamDefaults(v, name)
+	}
+
 	// Enable automatic environment variable override
 	v.AutomaticEnv()
 	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
@@ -139,8 +465,108 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("database.retry_attempts", 3)
 	v.SetDefault("database.retry_backoff", "2s")
 
+	// Shutdown defaults
+	v.SetDefault("shutdown.http_timeout", "10s")
+	v.SetDefault("shutdown.drain_timeout", "30s")
+	v.SetDefault("shutdown.close_timeout", "5s")
+
+	v.SetDefault("kafka.brokers", []string{})
+	v.SetDefault("kafka.broker", "")
+	v.SetDefault("kafka.client_id", "kafka-consumer-worker")
+	v.SetDefault("kafka.version", "")
+	v.SetDefault("kafka.dial_timeout", "30s")
+	v.SetDefault("kafka.read_timeout", "30s")
+	v.SetDefault("kafka.write_timeout", "30s")
+	v.SetDefault("kafka.tls.enable", false)
+	v.SetDefault("kafka.tls.ca_file", "")
+	v.SetDefault("kafka.tls.cert_file", "")
+	v.SetDefault("kafka.tls.key_file", "")
+	v.SetDefault("kafka.tls.insecure_skip_verify", false)
+	v.SetDefault("kafka.sasl.enable", false)
+	v.SetDefault("kafka.sasl.mechanism", "PLAIN")
+	v.SetDefault("kafka.sasl.username", "")
+	v.SetDefault("kafka.sasl.password", "")
+	v.SetDefault("kafka.nack_resend_sleep", "1s")
+	v.SetDefault("kafka.group.initial_offset", "newest")
+	v.SetDefault("kafka.group.auto_commit_interval", "1s")
+	v.SetDefault("kafka.group.session_timeout", "10s")
+	v.SetDefault("kafka.group.heartbeat_interval", "3s")
+	v.SetDefault("kafka.group.rebalance_timeout", "60s")
+	v.SetDefault("kafka.group.rebalance_strategy", "range")
+	v.SetDefault("kafka.group.rebalance_hooks", false)
+	v.SetDefault("kafka.lag.check_interval", "15s")
+	v.SetDefault("kafka.lag.max_lag", 0)
+
+	// The user_lifecycle stream gets defaults up front so it can be
+	// configured from environment variables alone.
+	setStreamDefaults(v, "user_lifecycle")
+	v.SetDefault("streams.user_lifecycle.topic", "user-lifecycle-events")
+	v.SetDefault("streams.user_lifecycle.options.unknown_event", "log")
+
+	v.SetDefault("idempotency.retention", "168h")
+	v.SetDefault("idempotency.cleanup_interval", "1h")
+	v.SetDefault("idempotency.cleanup_batch_size", 1000)
+
+	v.SetDefault("health.critical", []string{"database", "consumer", "consumer_lag"})
+
+	v.SetDefault("admin.token", "")
+
+	v.SetDefault("schema_registry.url", "")
+	v.SetDefault("schema_registry.username", "")
+	v.SetDefault("schema_registry.password", "")
+	v.SetDefault("schema_registry.timeout", "10s")
+	v.SetDefault("schema_registry.cache_ttl", "5m")
+
+	v.SetDefault("circuit_breaker.enable", true)
+	v.SetDefault("circuit_breaker.failure_threshold", 5)
+	v.SetDefault("circuit_breaker.health_check_interval", "10s")
+	v.SetDefault("circuit_breaker.open_timeout", "30s")
+	v.SetDefault("circuit_breaker.half_open_successes", 3)
+
 	v.SetDefault("publishers.user_lifecycle.enable", false)
 	v.SetDefault("publishers.user_lifecycle.topic", "user-lifecycle-events")
+	v.SetDefault("publishers.user_lifecycle.encoding", "json")
+	v.SetDefault("publishers.user_lifecycle.registry_subject", "")
+	v.SetDefault("publishers.user_lifecycle.event_version", 0)
+	v.SetDefault("publishers.user_lifecycle.cloudevents.enable", false)
+	v.SetDefault("publishers.user_lifecycle.cloudevents.mode", "binary")
+	v.SetDefault("publishers.user_lifecycle.cloudevents.source", "/kafka-consumer-worker/users")
+	v.SetDefault("publishers.user_lifecycle.schema.enable", false)
+	v.SetDefault("publishers.user_lifecycle.schema.subject", "user_lifecycle")
+}
+
+// setStreamDefaults sets the defaults shared by every stream under
+// streams.<name>.
+func setStreamDefaults(v *viper.Viper, name string) {
+	prefix := "streams." + name + "."
+
+	v.SetDefault(prefix+"enable", false)
+	v.SetDefault(prefix+"dead_letter_topic", "")
+	v.SetDefault(prefix+"decoder", "json")
+	v.SetDefault(prefix+"publish_topic", "")
+	v.SetDefault(prefix+"concurrency", 1)
+	v.SetDefault(prefix+"queue_depth", 16)
+	v.SetDefault(prefix+"batch_size", 1)
+	v.SetDefault(prefix+"batch_linger", "100ms")
+	v.SetDefault(prefix+"handler_timeout", "30s")
+	v.SetDefault(prefix+"circuit_breaker", true)
+	v.SetDefault(prefix+"retry.max_attempts", 3)
+	v.SetDefault(prefix+"retry.initial_interval", "200ms")
+	v.SetDefault(prefix+"retry.multiplier", 2.0)
+	v.SetDefault(prefix+"retry.max_interval", "5s")
+	v.SetDefault(prefix+"retry.jitter", 0.2)
+	v.SetDefault(prefix+"retry.classifier", "transient")
+	v.SetDefault(prefix+"retry_topics.enable", false)
+	v.SetDefault(prefix+"retry_topics.delays", []string{"5s", "1m", "10m"})
+	v.SetDefault(prefix+"idempotency.enable", false)
+	v.SetDefault(prefix+"idempotency.key", "message_uuid")
+	v.SetDefault(prefix+"middleware.chain", []string{"correlation_id", "poison_queue", "retry"})
+	v.SetDefault(prefix+"middleware.timeout", "30s")
+	v.SetDefault(prefix+"middleware.throttle_per_second", 0)
+	v.SetDefault(prefix+"rate_limit.per_second", 0)
+	v.SetDefault(prefix+"rate_limit.burst", 1)
+	v.SetDefault(prefix+"schema.enable", false)
+	v.SetDefault(prefix+"schema.subject", "")
 }
 
 // Load reads configuration from a TOML file (backward compatibility).
@@ -153,6 +579,11 @@ func Load(path string) (*Config, error) {
 		return nil, fmt.Errorf("read config file: %w", err)
 	}
 
+	// Streams get the same defaults as with LoadConfig
+	for name := range v.GetStringMap("streams") {
+		setStreamDefaults(v, name)
+	}
+
 	// Unmarshal into struct
 	var cfg Config
 	if err := v.Unmarshal(&cfg); err != nil {
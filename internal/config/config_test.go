@@ -0,0 +1,65 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestLoadAppliesStreamDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	err := os.WriteFile(path, []byte(`
+[streams.orders]
+enable = true
+topic = "orders"
+concurrency = 8
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	stream, ok := cfg.Streams["orders"]
+	if !ok {
+		t.Fatal("stream orders not loaded")
+	}
+	if stream.Concurrency != 8 {
+		t.Errorf("Concurrency = %d, want the configured 8", stream.Concurrency)
+	}
+	if stream.QueueDepth != 16 {
+		t.Errorf("QueueDepth = %d, want default 16", stream.QueueDepth)
+	}
+	if stream.Retry.MaxAttempts != 3 || stream.Retry.Classifier != "transient" {
+		t.Errorf("Retry = %+v, want default retry policy", stream.Retry)
+	}
+	if stream.HandlerTimeout != 30*time.Second {
+		t.Errorf("HandlerTimeout = %s, want default 30s", stream.HandlerTimeout)
+	}
+	if !slices.Equal(stream.Middleware.Chain, []string{"correlation_id", "poison_queue", "retry"}) {
+		t.Errorf("Middleware.Chain = %v, want default chain", stream.Middleware.Chain)
+	}
+}
+
+func TestLoadShippedConfig(t *testing.T) {
+	cfg, err := Load(filepath.Join("..", "..", "config.toml"))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	stream, ok := cfg.Streams["user_lifecycle"]
+	if !ok {
+		t.Fatal("stream user_lifecycle not loaded")
+	}
+	if stream.Topic != "user-lifecycle-events" {
+		t.Errorf("Topic = %q, want user-lifecycle-events", stream.Topic)
+	}
+	if cfg.Admin.Token == "" {
+		t.Error("Admin.Token is empty, want the [admin] token")
+	}
+}
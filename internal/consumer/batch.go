@@ -0,0 +1,163 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/gofiber/fiber/v2/log"
+)
+
+const defaultBatchLinger = 100 * time.Millisecond
+
+// batcher groups the messages the router hands to a stream's handler into
+// batches of up to batch_size, flushing early once batch_linger has passed
+// since the first message of the batch arrived. Each router goroutine waits
+// for the outcome of its own message, so acking, retries and dead-lettering
+// stay per message.
+//
+// The Kafka subscriber only hands out the next message of a partition once
+// the previous one is settled, so a batch holds at most one message per
+// partition assigned to this instance; batch_linger bounds how long a
+// partial batch waits. warnUnfillableBatches flags batch sizes that can
+// never be reached.
+type batcher struct {
+	size   int
+	linger time.Duration
+	ctx    func() context.Context
+	handle func(ctx context.Context, msgs []*message.Message) []error
+
+	mu      sync.Mutex
+	pending []*batchItem
+	timer   *time.Timer
+}
+
+type batchItem struct {
+	msg  *message.Message
+	done chan error
+}
+
+func newBatcher(
+	topic string,
+	size int,
+	linger time.Duration,
+	ctx func() context.Context,
+	handle func(ctx context.Context, msgs []*message.Message) []error,
+) *batcher {
+	if linger <= 0 {
+		linger = defaultBatchLinger
+	}
+
+	log.Infof("consumer: processing message batches for topic: %s (batch_size=%d, batch_linger=%s)",
+		topic, size, linger)
+
+	return &batcher{
+		size:   size,
+		linger: linger,
+		ctx:    ctx,
+		handle: handle,
+	}
+}
+
+// Handle is the router handler function of a batch stream.
+func (b *batcher) Handle(msg *message.Message) ([]*message.Message, error) {
+	item := &batchItem{msg: msg, done: make(chan error, 1)}
+
+	b.mu.Lock()
+	b.pending = append(b.pending, item)
+	var batch []*batchItem
+	switch {
+	case len(b.pending) >= b.size:
+		batch = b.take()
+	case len(b.pending) == 1:
+		b.timer = time.AfterFunc(b.linger, b.flush)
+	}
+	b.mu.Unlock()
+
+	if batch != nil {
+		b.run(batch)
+	}
+
+	return nil, <-item.done
+}
+
+func (b *batcher) flush() {
+	b.mu.Lock()
+	batch := b.take()
+	b.mu.Unlock()
+
+	if len(batch) > 0 {
+		b.run(batch)
+	}
+}
+
+// take removes the pending batch. It must be called with mu held.
+func (b *batcher) take() []*batchItem {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	batch := b.pending
+	b.pending = nil
+	return batch
+}
+
+func (b *batcher) run(batch []*batchItem) {
+	msgs := make([]*message.Message, len(batch))
+	for i, item := range batch {
+		msgs[i] = item.msg
+	}
+
+	errs := b.handle(b.ctx(), msgs)
+	if len(errs) != len(msgs) {
+		err := fmt.Errorf("batch handler returned %d results for %d messages", len(errs), len(msgs))
+		errs = make([]error, len(msgs))
+		for i := range errs {
+			errs[i] = err
+		}
+	}
+
+	for i, item := range batch {
+		item.done <- errs[i]
+	}
+}
+
+// warnUnfillableBatches logs a warning for every batch stream whose
+// batch_size is above the partition count of its topic. An instance is
+// assigned at most every partition, so such a batch never fills and each
+// one waits out batch_linger.
+func (c *Consumer) warnUnfillableBatches() {
+	var batched []*subscription
+	for _, sub := range c.subscriptions {
+		if sub.batchHandler != nil {
+			batched = append(batched, sub)
+		}
+	}
+	if len(batched) == 0 {
+		return
+	}
+
+	client, err := sarama.NewClient(c.config.Kafka.BrokerAddrs(), c.saramaConfig)
+	if err != nil {
+		log.Warnf("consumer: cannot check batch sizes against partition counts: %v", err)
+		return
+	}
+	defer client.Close()
+
+	for _, sub := range batched {
+		partitions, err := client.Partitions(sub.config.Topic)
+		if err != nil {
+			log.Warnf("consumer: cannot check batch size of stream %s: list partitions of %s: %v",
+				sub.name, sub.config.Topic, err)
+			continue
+		}
+		if sub.config.BatchSize > len(partitions) {
+			log.Warnf("consumer: stream %s has batch_size=%d but topic %s has %d partitions; "+
+				"a batch holds at most one message per assigned partition, so every batch waits batch_linger=%s",
+				sub.name, sub.config.BatchSize, sub.config.Topic, len(partitions), sub.config.BatchLinger)
+		}
+	}
+}
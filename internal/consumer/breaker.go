@@ -0,0 +1,344 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/config"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/consumer/streamHandler"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/health"
+)
+
+const (
+	defaultBreakerFailureThreshold    = 5
+	defaultBreakerHealthCheckInterval = 10 * time.Second
+	defaultBreakerOpenTimeout         = 30 * time.Second
+	defaultBreakerHalfOpenSuccesses   = 3
+)
+
+// Circuit breaker states reported by Consumer.CircuitBreaker.
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half_open"
+)
+
+// CircuitBreakerStatus is a point-in-time view of the circuit breaker.
+type CircuitBreakerStatus struct {
+	Enabled bool
+	State   string
+	// Streams are the streams paused while the circuit is open.
+	Streams []string
+	// ConsecutiveFailures counts handler failures since the last success.
+	ConsecutiveFailures int
+	ChangedAt           time.Time
+	// LastError is the failure that last opened the circuit.
+	LastError string
+}
+
+// circuitBreaker pauses the streams under it while the database is failing.
+// It opens after FailureThreshold consecutive handler failures or a failed
+// health check. Once OpenTimeout has passed it probes the health check, and
+// if that passes it goes half-open: the streams resume, and the circuit
+// closes after HalfOpenSuccesses messages succeed or opens again on the
+// first failure.
+type circuitBreaker struct {
+	healthCheck         func() error
+	failureThreshold    int
+	healthCheckInterval time.Duration
+	openTimeout         time.Duration
+	halfOpenSuccesses   int
+	streams             []*subscription
+
+	mu        sync.Mutex
+	state     string
+	failures  int
+	successes int
+	changedAt time.Time
+	lastErr   error
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newCircuitBreaker(
+	cfg config.CircuitBreakerConfig,
+	healthCheck func() error,
+	subscriptions map[string]*subscription,
+) *circuitBreaker {
+	b := &circuitBreaker{
+		healthCheck:         healthCheck,
+		failureThreshold:    cfg.FailureThreshold,
+		healthCheckInterval: cfg.HealthCheckInterval,
+		openTimeout:         cfg.OpenTimeout,
+		halfOpenSuccesses:   cfg.HalfOpenSuccesses,
+		state:               CircuitClosed,
+		changedAt:           time.Now(),
+	}
+	if b.failureThreshold <= 0 {
+		b.failureThreshold = defaultBreakerFailureThreshold
+	}
+	if b.healthCheckInterval <= 0 {
+		b.healthCheckInterval = defaultBreakerHealthCheckInterval
+	}
+	if b.openTimeout <= 0 {
+		b.openTimeout = defaultBreakerOpenTimeout
+	}
+	if b.halfOpenSuccesses <= 0 {
+		b.halfOpenSuccesses = defaultBreakerHalfOpenSuccesses
+	}
+
+	for _, sub := range subscriptions {
+		if sub.config.CircuitBreaker {
+			b.streams = append(b.streams, sub)
+		}
+	}
+	sort.Slice(b.streams, func(i, j int) bool {
+		return b.streams[i].name < b.streams[j].name
+	})
+
+	return b
+}
+
+// Start runs the health check in the background until Stop is called.
+func (b *circuitBreaker) Start(ctx context.Context) {
+	ctx, b.cancel = context.WithCancel(ctx)
+	b.done = make(chan struct{})
+
+	go func() {
+		defer close(b.done)
+
+		ticker := time.NewTicker(b.healthCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				b.check()
+			}
+		}
+	}()
+}
+
+func (b *circuitBreaker) Stop() {
+	if b.cancel == nil {
+		return
+	}
+	b.cancel()
+	<-b.done
+}
+
+// check runs the health check. While the circuit is open it is the probe
+// deciding whether to go half-open, and only runs once OpenTimeout has
+// passed. The check blocks for at most the database's own ping timeout.
+func (b *circuitBreaker) check() {
+	b.mu.Lock()
+	state, changedAt := b.state, b.changedAt
+	b.mu.Unlock()
+
+	if state == CircuitOpen && time.Since(changedAt) < b.openTimeout {
+		return
+	}
+
+	err := b.healthCheck()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != state {
+		// A handler outcome moved the circuit while the check ran.
+		return
+	}
+
+	switch {
+	case err != nil:
+		b.open(err)
+	case b.state == CircuitOpen:
+		b.transition(CircuitHalfOpen)
+	case b.state == CircuitHalfOpen:
+		// Counts as a success so an idle stream does not keep the
+		// circuit half-open.
+		b.succeed()
+	}
+}
+
+// record feeds a handler outcome into the breaker. Permanent failures say
+// nothing about the database and cancellations are not failures, so
+// neither is counted.
+func (b *circuitBreaker) record(err error) {
+	if err != nil && (streamHandler.IsPermanent(err) || errors.Is(err, context.Canceled)) {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err == nil {
+		b.failures = 0
+		if b.state == CircuitHalfOpen {
+			b.succeed()
+		}
+		return
+	}
+
+	b.failures++
+	switch b.state {
+	case CircuitHalfOpen:
+		b.open(err)
+	case CircuitClosed:
+		if b.failures >= b.failureThreshold {
+			b.open(err)
+		}
+	}
+}
+
+// succeed counts a success while half-open. It must be called with mu held.
+func (b *circuitBreaker) succeed() {
+	b.successes++
+	if b.successes >= b.halfOpenSuccesses {
+		b.transition(CircuitClosed)
+	}
+}
+
+// open must be called with mu held.
+func (b *circuitBreaker) open(err error) {
+	b.lastErr = err
+	if b.state == CircuitOpen {
+		// A failed probe restarts the open timeout.
+		b.changedAt = time.Now()
+		log.Warnf("consumer: circuit breaker probe failed, staying open: %v", err)
+		return
+	}
+	b.transition(CircuitOpen)
+}
+
+// transition moves the circuit to state and pauses or resumes the streams
+// under it. It must be called with mu held.
+func (b *circuitBreaker) transition(state string) {
+	from := b.state
+	b.state = state
+	b.changedAt = time.Now()
+	b.successes = 0
+
+	switch state {
+	case CircuitOpen:
+		for _, sub := range b.streams {
+			sub.state.trip()
+		}
+		log.Warnf("consumer: circuit breaker %s -> %s, pausing %d streams: %v",
+			from, state, len(b.streams), b.lastErr)
+	case CircuitHalfOpen:
+		for _, sub := range b.streams {
+			sub.state.untrip()
+		}
+		log.Infof("consumer: circuit breaker %s -> %s, health check passed, resuming %d streams",
+			from, state, len(b.streams))
+	case CircuitClosed:
+		b.failures = 0
+		log.Infof("consumer: circuit breaker %s -> %s", from, state)
+	}
+}
+
+// circuitDeferredKey marks a message whose failure was turned transient
+// because the circuit was open, so it is only deferred once.
+const circuitDeferredKey = "_circuit_deferred"
+
+// Middleware feeds the outcome of every attempt of a stream's handler into
+// the breaker. A message failing while the circuit is open is marked
+// transient the first time, so the messages in flight when it opened are
+// redelivered once the stream resumes instead of being dead-lettered. A
+// redelivered message failing again is classified as usual, so the retry
+// classifier still bounds how often it is tried.
+func (b *circuitBreaker) Middleware(h message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		produced, err := h(msg)
+		b.record(err)
+		if err != nil && !streamHandler.IsPermanent(err) && b.isOpen() && msg.Metadata.Get(circuitDeferredKey) == "" {
+			msg.Metadata.Set(circuitDeferredKey, "true")
+			return produced, streamHandler.Transient(err)
+		}
+		return produced, err
+	}
+}
+
+func (b *circuitBreaker) isOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state == CircuitOpen
+}
+
+func (b *circuitBreaker) status() CircuitBreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := CircuitBreakerStatus{
+		Enabled:             true,
+		State:               b.state,
+		Streams:             make([]string, 0, len(b.streams)),
+		ConsecutiveFailures: b.failures,
+		ChangedAt:           b.changedAt,
+	}
+	for _, sub := range b.streams {
+		status.Streams = append(status.Streams, sub.name)
+	}
+	if b.lastErr != nil {
+		status.LastError = b.lastErr.Error()
+	}
+	return status
+}
+
+// CircuitBreakerHealth returns the health contributor reporting the
+// consumer's circuit breaker.
+func (c *Consumer) CircuitBreakerHealth() health.Contributor {
+	return circuitBreakerHealth{c}
+}
+
+// circuitBreakerHealth reports an open circuit as unhealthy, since its
+// streams are paused. A half-open circuit is healthy: it is consuming again
+// while it confirms the database has recovered.
+type circuitBreakerHealth struct {
+	c *Consumer
+}
+
+func (circuitBreakerHealth) HealthName() string {
+	return "circuit_breaker"
+}
+
+func (h circuitBreakerHealth) Health(context.Context) health.Report {
+	status := h.c.CircuitBreaker()
+	if !status.Enabled {
+		return health.Report{State: health.StateDisabled, Healthy: true}
+	}
+
+	report := health.Report{
+		State:   status.State,
+		Healthy: status.State != CircuitOpen,
+		Details: map[string]any{
+			"streams":              status.Streams,
+			"consecutive_failures": status.ConsecutiveFailures,
+			"changed_at":           status.ChangedAt,
+		},
+	}
+	if status.LastError != "" {
+		report.Details["last_error"] = status.LastError
+	}
+	if !report.Healthy {
+		report.Error = "streams paused: " + status.LastError
+	}
+	return report
+}
+
+// CircuitBreaker returns the state of the consumer's circuit breaker.
+func (c *Consumer) CircuitBreaker() CircuitBreakerStatus {
+	if c.breaker == nil {
+		return CircuitBreakerStatus{State: CircuitClosed}
+	}
+	return c.breaker.status()
+}
@@ -0,0 +1,206 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/config"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/consumer/streamHandler"
+)
+
+var errDatabaseDown = errors.New("database down")
+
+// newTestBreaker returns a breaker over one stream whose health check
+// returns *checkErr.
+func newTestBreaker(t *testing.T, checkErr *error) (*circuitBreaker, *subscription) {
+	t.Helper()
+
+	newState := func() *streamState {
+		state, err := newStreamState(config.RateLimitConfig{})
+		if err != nil {
+			t.Fatalf("newStreamState: %v", err)
+		}
+		return state
+	}
+	sub := &subscription{name: "orders", state: newState(), config: config.StreamConfig{CircuitBreaker: true}}
+
+	b := newCircuitBreaker(config.CircuitBreakerConfig{
+		FailureThreshold:  3,
+		OpenTimeout:       time.Hour,
+		HalfOpenSuccesses: 2,
+	}, func() error { return *checkErr }, map[string]*subscription{
+		"orders":   sub,
+		"payments": {name: "payments", state: newState()},
+	})
+	return b, sub
+}
+
+func TestCircuitBreakerOpensAfterConsecutiveFailures(t *testing.T) {
+	var checkErr error
+	b, sub := newTestBreaker(t, &checkErr)
+
+	b.record(errDatabaseDown)
+	b.record(errDatabaseDown)
+	b.record(nil)
+	b.record(errDatabaseDown)
+	b.record(errDatabaseDown)
+	if got := b.status().State; got != CircuitClosed {
+		t.Fatalf("state = %s, want closed while failures are not consecutive", got)
+	}
+
+	b.record(errDatabaseDown)
+	status := b.status()
+	if status.State != CircuitOpen {
+		t.Fatalf("state = %s, want open", status.State)
+	}
+	if status.LastError != errDatabaseDown.Error() {
+		t.Errorf("LastError = %q, want %q", status.LastError, errDatabaseDown)
+	}
+	if len(status.Streams) != 1 || status.Streams[0] != "orders" {
+		t.Errorf("Streams = %v, want only the stream with the breaker enabled", status.Streams)
+	}
+	if !sub.state.isTripped() {
+		t.Error("stream not paused while the circuit is open")
+	}
+}
+
+func TestCircuitBreakerIgnoresPermanentFailuresAndCancellations(t *testing.T) {
+	var checkErr error
+	b, _ := newTestBreaker(t, &checkErr)
+
+	for range 10 {
+		b.record(streamHandler.Permanent(errDatabaseDown))
+		b.record(context.Canceled)
+	}
+	if status := b.status(); status.State != CircuitClosed || status.ConsecutiveFailures != 0 {
+		t.Fatalf("status = %+v, want closed with no failures", status)
+	}
+}
+
+func TestCircuitBreakerOpensOnFailedHealthCheck(t *testing.T) {
+	checkErr := errDatabaseDown
+	b, sub := newTestBreaker(t, &checkErr)
+
+	b.check()
+	if got := b.status().State; got != CircuitOpen {
+		t.Fatalf("state = %s, want open", got)
+	}
+	if !sub.state.isTripped() {
+		t.Error("stream not paused while the circuit is open")
+	}
+}
+
+func TestCircuitBreakerProbesAfterOpenTimeout(t *testing.T) {
+	checkErr := errDatabaseDown
+	b, sub := newTestBreaker(t, &checkErr)
+	b.check()
+
+	// Within the open timeout the health check is not probed.
+	checkErr = nil
+	b.check()
+	if got := b.status().State; got != CircuitOpen {
+		t.Fatalf("state = %s within the open timeout, want open", got)
+	}
+
+	b.openTimeout = 0
+	b.check()
+	if got := b.status().State; got != CircuitHalfOpen {
+		t.Fatalf("state = %s after a passing probe, want half_open", got)
+	}
+	if sub.state.isTripped() {
+		t.Error("stream still paused while half-open")
+	}
+}
+
+func TestCircuitBreakerFailedProbeStaysOpen(t *testing.T) {
+	checkErr := errDatabaseDown
+	b, _ := newTestBreaker(t, &checkErr)
+	b.check()
+	opened := b.status().ChangedAt
+
+	b.openTimeout = 0
+	time.Sleep(time.Millisecond)
+	b.check()
+
+	status := b.status()
+	if status.State != CircuitOpen {
+		t.Fatalf("state = %s after a failed probe, want open", status.State)
+	}
+	if !status.ChangedAt.After(opened) {
+		t.Error("a failed probe did not restart the open timeout")
+	}
+}
+
+func TestCircuitBreakerHalfOpenCloses(t *testing.T) {
+	checkErr := errDatabaseDown
+	b, sub := newTestBreaker(t, &checkErr)
+	b.check()
+	checkErr, b.openTimeout = nil, 0
+	b.check()
+
+	b.record(nil)
+	if got := b.status().State; got != CircuitHalfOpen {
+		t.Fatalf("state = %s after one success, want half_open", got)
+	}
+	b.record(nil)
+	if got := b.status().State; got != CircuitClosed {
+		t.Fatalf("state = %s after two successes, want closed", got)
+	}
+	if sub.state.isTripped() {
+		t.Error("stream paused after the circuit closed")
+	}
+}
+
+func TestCircuitBreakerHalfOpenReopensOnFailure(t *testing.T) {
+	checkErr := errDatabaseDown
+	b, sub := newTestBreaker(t, &checkErr)
+	b.check()
+	checkErr, b.openTimeout = nil, 0
+	b.check()
+
+	b.record(errDatabaseDown)
+	if got := b.status().State; got != CircuitOpen {
+		t.Fatalf("state = %s after a half-open failure, want open", got)
+	}
+	if !sub.state.isTripped() {
+		t.Error("stream not paused after the circuit reopened")
+	}
+}
+
+func TestCircuitBreakerMiddlewareDefersOnce(t *testing.T) {
+	checkErr := errDatabaseDown
+	b, _ := newTestBreaker(t, &checkErr)
+	b.check()
+
+	handler := b.Middleware(func(*message.Message) ([]*message.Message, error) {
+		return nil, errDatabaseDown
+	})
+	msg := message.NewMessage(watermill.NewUUID(), nil)
+
+	_, err := handler(msg)
+	if !streamHandler.IsTransient(err) {
+		t.Fatalf("err = %v, want it marked transient while the circuit is open", err)
+	}
+
+	_, err = handler(msg)
+	if streamHandler.IsTransient(err) {
+		t.Fatalf("err = %v, want a redelivered message classified as usual", err)
+	}
+}
+
+func TestCircuitBreakerMiddlewareKeepsPermanentFailures(t *testing.T) {
+	checkErr := errDatabaseDown
+	b, _ := newTestBreaker(t, &checkErr)
+	b.check()
+
+	handler := b.Middleware(func(*message.Message) ([]*message.Message, error) {
+		return nil, streamHandler.Permanent(errDatabaseDown)
+	})
+	if _, err := handler(message.NewMessage(watermill.NewUUID(), nil)); !streamHandler.IsPermanent(err) {
+		t.Fatalf("err = %v, want it to stay permanent", err)
+	}
+}
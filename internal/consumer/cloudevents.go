@@ -0,0 +1,39 @@
+package consumer
+
+import (
+	"github.com/IBM/sarama"
+	"github.com/ThreeDotsLabs/watermill-kafka/v3/pkg/kafka"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/cloudevents"
+)
+
+// unmarshaler is kafka.DefaultMarshaler that also accepts CloudEvents in
+// either content mode. Structured mode events are turned into binary mode
+// ones as they are consumed, so handlers, schema validation and idempotency
+// keys see the event data as the payload, and a dead-lettered event is
+// still a CloudEvent. Events from producers other than watermill take the
+// event id as their message UUID.
+type unmarshaler struct {
+	kafka.DefaultMarshaler
+}
+
+func (u unmarshaler) Unmarshal(kafkaMsg *sarama.ConsumerMessage) (*message.Message, error) {
+	msg, err := u.DefaultMarshaler.Unmarshal(kafkaMsg)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := cloudevents.ToBinary(msg); err != nil {
+		// Left as is; the handler fails to decode it and it is
+		// dead-lettered rather than blocking the partition here.
+		log.Warnf("consumer: invalid structured cloudevent at %s/%d offset %d: %v",
+			kafkaMsg.Topic, kafkaMsg.Partition, kafkaMsg.Offset, err)
+		return msg, nil
+	}
+
+	if msg.UUID == "" {
+		msg.UUID = msg.Metadata.Get(cloudevents.HeaderPrefix + "id")
+	}
+	return msg, nil
+}
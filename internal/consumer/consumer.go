@@ -2,157 +2,662 @@ package consumer
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
 
+	"github.com/IBM/sarama"
 	"github.com/ThreeDotsLabs/watermill"
 	"github.com/ThreeDotsLabs/watermill-kafka/v3/pkg/kafka"
 	"github.com/ThreeDotsLabs/watermill/message"
 	"github.com/gofiber/fiber/v2/log"
 	"github.com/muazwzxv/kafka-consumer-worker/internal/config"
 	"github.com/muazwzxv/kafka-consumer-worker/internal/consumer/streamHandler"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/database"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/kafkaclient"
 	"github.com/muazwzxv/kafka-consumer-worker/internal/repository"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/schema"
 	"github.com/samber/do/v2"
 )
 
+// Consumer runs every registered stream as a handler on a Watermill
+// message.Router, each wrapped in its configured middleware chain.
 type Consumer struct {
-	subscriber  *kafka.Subscriber
-	handlers    map[string]streamHandler.MessageHandler
-	config      *config.Config
-	wg          sync.WaitGroup
-	cancelFuncs []context.CancelFunc
+	router     *message.Router
+	subscriber *kafka.Subscriber
+	// saramaConfig is the subscriber's client config, reused for metadata
+	// lookups.
+	saramaConfig *sarama.Config
+	// publisher backs dead-lettering, retry tiers and the output of
+	// producing handlers.
+	publisher     *streamPublisher
+	deadLetter    *deadLetterPublisher
+	lag           *lagMonitor
+	sessions      *groupSessions
+	janitor       *processedMessageJanitor
+	breaker       *circuitBreaker
+	subscriptions map[string]*subscription
+	config        *config.Config
+	// pools are the keyed worker pools of the router handlers, closed once
+	// the router has stopped.
+	pools []*keyedWorkerPool
+	// inFlight counts the messages inside a router handler, so Shutdown can
+	// wait for handlers the router stopped waiting for.
+	inFlight inFlightCounter
+
+	mu sync.Mutex
+	// handlerCtx is what messages are consumed with, so it is what handlers
+	// see. It is detached from the Start context so that stopping fetching
+	// lets in-flight messages finish and be acked; abortHandlers cancels it
+	// once the shutdown drain deadline has passed.
+	handlerCtx    context.Context
+	abortHandlers context.CancelFunc
+	// fetchCtx is cancelled to stop every stream taking new messages.
+	fetchCtx     context.Context
+	stopFetching context.CancelFunc
+	routerDone   chan struct{}
+}
+
+// subscription binds a topic handler to the stream config it was built from.
+type subscription struct {
+	name         string
+	state        *streamState
+	handler      streamHandler.MessageHandler
+	batchHandler streamHandler.BatchMessageHandler
+	producer     streamHandler.ProducingHandler
+	config       config.StreamConfig
+	retry        *retryPolicy
+	dedup        *deduplicator
+	// retryTiers are the stream's delayed retry topics, in order.
+	retryTiers []retryTier
+	// schema validates payloads before they reach the handler.
+	schema *schema.Validator
+
+	// handleBatch is the batch handler wrapped with deduplication when the
+	// stream enables it.
+	handleBatch func(ctx context.Context, msgs []*message.Message) []error
+	// middlewares is the configured middleware chain, outermost first.
+	middlewares []message.HandlerMiddleware
+}
+
+// subscriptionDeps are the shared dependencies subscriptions build their
+// handler layers from.
+type subscriptionDeps struct {
+	processed repository.ProcessedMessageRepository
+	tx        txRunner
+	schemas   *schema.Registry
+}
+
+func newSubscription(
+	name string,
+	handler streamHandler.MessageHandler,
+	cfg config.StreamConfig,
+	deps subscriptionDeps,
+) (*subscription, error) {
+	retry, err := newRetryPolicy(cfg.Retry)
+	if err != nil {
+		return nil, fmt.Errorf("stream %s: %w", name, err)
+	}
+
+	state, err := newStreamState(cfg.RateLimit)
+	if err != nil {
+		return nil, fmt.Errorf("stream %s: %w", name, err)
+	}
+
+	sub := &subscription{
+		name:    name,
+		state:   state,
+		handler: handler,
+		config:  cfg,
+		retry:   retry,
+	}
+
+	if cfg.PublishTopic != "" {
+		producer, ok := handler.(streamHandler.ProducingHandler)
+		if !ok {
+			return nil, fmt.Errorf("stream %s: publish_topic is set but handler %T does not produce messages", name, handler)
+		}
+		sub.producer = producer
+	}
+
+	if cfg.BatchSize > 1 {
+		if sub.producer != nil {
+			return nil, fmt.Errorf("stream %s: batch_size cannot be combined with publish_topic", name)
+		}
+		batchHandler, ok := handler.(streamHandler.BatchMessageHandler)
+		if !ok {
+			return nil, fmt.Errorf("stream %s: batch_size is set but handler %T does not support batches", name, handler)
+		}
+		sub.batchHandler = batchHandler
+		sub.handleBatch = batchHandler.HandleBatch
+	}
+
+	if cfg.RetryTopics.Enable {
+		if !slices.Contains(cfg.Middleware.Chain, "poison_queue") {
+			return nil, fmt.Errorf("stream %s: retry_topics requires poison_queue in the middleware chain", name)
+		}
+		if sub.retryTiers, err = newRetryTiers(cfg.Topic, cfg.RetryTopics); err != nil {
+			return nil, fmt.Errorf("stream %s: %w", name, err)
+		}
+	}
+
+	if streamHandler.BinaryDecoder(cfg.Decoder) {
+		if cfg.Schema.Enable {
+			return nil, fmt.Errorf("stream %s: schema validation cannot be used with the %s decoder", name, cfg.Decoder)
+		}
+		if cfg.Idempotency.Enable && strings.HasPrefix(cfg.Idempotency.Key, "payload:") {
+			return nil, fmt.Errorf("stream %s: idempotency key %s cannot be used with the %s decoder",
+				name, cfg.Idempotency.Key, cfg.Decoder)
+		}
+	}
+
+	if cfg.Schema.Enable {
+		subject := cfg.Schema.Subject
+		if subject == "" {
+			subject = name
+		}
+		if sub.schema, err = deps.schemas.Validator(subject); err != nil {
+			return nil, fmt.Errorf("stream %s: %w", name, err)
+		}
+	}
+
+	if cfg.Idempotency.Enable {
+		dedup, err := newDeduplicator(name, cfg.Idempotency, deps.processed, deps.tx)
+		if err != nil {
+			return nil, fmt.Errorf("stream %s: %w", name, err)
+		}
+		sub.dedup = dedup
+		if sub.handleBatch != nil {
+			sub.handleBatch = dedup.WrapBatch(sub.handleBatch)
+		}
+	}
+
+	return sub, nil
 }
 
-// Init creates a consumer with handlers built from config and dependencies
+// Init creates a consumer with a subscription for every enabled stream in
+// config. Each stream's handler is built by the factory registered under
+// its handler name; an unknown handler or invalid stream config fails
+// startup.
 func Init(i do.Injector) (*Consumer, error) {
 	cfg := do.MustInvoke[*config.Config](i)
-	userRepo := do.MustInvoke[repository.UserRepository](i)
+	db := do.MustInvoke[*database.Database](i)
+	deps := subscriptionDeps{
+		processed: do.MustInvoke[repository.ProcessedMessageRepository](i),
+		tx:        db,
+		schemas:   do.MustInvoke[*schema.Registry](i),
+	}
 
-	handlers := make(map[string]streamHandler.MessageHandler)
+	subscriptions, err := buildSubscriptions(i, cfg.Streams, deps)
+	if err != nil {
+		return nil, err
+	}
 
-	if cfg.Streams.UserLifecycle.Enable {
-		handler := streamHandler.NewUserLifecycleHandler(
-			userRepo,
-			cfg.Streams.UserLifecycle.Topic,
-		)
-		handlers[cfg.Streams.UserLifecycle.Topic] = handler
-		log.Infof("consumer: registered handler for topic: %s", cfg.Streams.UserLifecycle.Topic)
+	var janitor *processedMessageJanitor
+	if needsIdempotency(subscriptions) {
+		janitor = newProcessedMessageJanitor(deps.processed, cfg.Idempotency)
+	}
+
+	c, err := new(cfg, subscriptions, janitor)
+	if err != nil {
+		return nil, err
 	}
 
-	// if cfg.Streams.OrderEvents.Enable {
-	//     handler := streamHandler.NewOrderEventsHandler(deps.OrderRepo, cfg.Streams.OrderEvents.Topic)
-	//     handlers[cfg.Streams.OrderEvents.Topic] = handler
-	//     log.Infof("consumer: registered handler for topic: %s", cfg.Streams.OrderEvents.Topic)
-	// }
+	if cfg.CircuitBreaker.Enable {
+		c.breaker = newCircuitBreaker(cfg.CircuitBreaker, db.HealthCheck, subscriptions)
+	}
 
-	return new(cfg, handlers)
+	return c, nil
 }
 
-func new(cfg *config.Config, handlers map[string]streamHandler.MessageHandler) (*Consumer, error) {
-	subscriber, err := kafka.NewSubscriber(
-		kafka.SubscriberConfig{
-			Brokers:       []string{cfg.Kafka.Broker},
-			Unmarshaler:   kafka.DefaultMarshaler{},
-			ConsumerGroup: cfg.Kafka.ConsumerGroup,
+// buildSubscriptions validates every configured stream and builds the
+// enabled ones.
+func buildSubscriptions(
+	i do.Injector,
+	streams config.StreamConfigs,
+	deps subscriptionDeps,
+) (map[string]*subscription, error) {
+	names := make([]string, 0, len(streams))
+	for name := range streams {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	subscriptions := make(map[string]*subscription)
+	topics := make(map[string]string)
+
+	for _, name := range names {
+		streamCfg := streams[name]
+
+		handlerName := streamCfg.Handler
+		if handlerName == "" {
+			handlerName = name
+		}
+		factory, ok := streamHandler.Lookup(handlerName)
+		if !ok {
+			return nil, fmt.Errorf("stream %s: unknown handler %q (registered: %s)",
+				name, handlerName, strings.Join(streamHandler.Registered(), ", "))
+		}
+
+		if !streamCfg.Enable {
+			continue
+		}
+
+		if streamCfg.Topic == "" {
+			return nil, fmt.Errorf("stream %s: topic is required", name)
+		}
+		if other, ok := topics[streamCfg.Topic]; ok {
+			return nil, fmt.Errorf("stream %s: topic %s is already consumed by stream %s", name, streamCfg.Topic, other)
+		}
+		topics[streamCfg.Topic] = name
+
+		handler, err := factory(i, name, streamCfg)
+		if err != nil {
+			return nil, fmt.Errorf("stream %s: build %s handler: %w", name, handlerName, err)
+		}
+
+		sub, err := newSubscription(name, handler, streamCfg, deps)
+		if err != nil {
+			return nil, err
+		}
+		subscriptions[name] = sub
+		log.Infof("consumer: registered %s handler for stream %s (topic: %s)", handlerName, name, streamCfg.Topic)
+	}
+
+	return subscriptions, nil
+}
+
+func new(cfg *config.Config, subscriptions map[string]*subscription, janitor *processedMessageJanitor) (*Consumer, error) {
+	subscriberConfig, err := kafkaclient.SubscriberConfig(cfg.Kafka)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := &groupSessions{}
+	gates := make(map[string]claimGate)
+	for _, sub := range subscriptions {
+		gates[sub.config.Topic] = sub.admit
+		for _, tier := range sub.retryTiers {
+			gates[tier.topic] = sub.admitWhenDue
+		}
+	}
+	kafkaSubscriberConfig := kafka.SubscriberConfig{
+		Brokers:               cfg.Kafka.BrokerAddrs(),
+		Unmarshaler:           unmarshaler{},
+		OverwriteSaramaConfig: subscriberConfig,
+		ConsumerGroup:         cfg.Kafka.ConsumerGroup,
+		NackResendSleep:       cfg.Kafka.NackResendSleep,
+		Tracer: rebalanceHooks{
+			group:    cfg.Kafka.ConsumerGroup,
+			sessions: sessions,
+			enabled:  cfg.Kafka.Group.RebalanceHooks,
+			gates:    gates,
 		},
-		watermill.NewStdLogger(false, false),
+	}
+
+	subscriber, err := kafka.NewSubscriber(
+		kafkaSubscriberConfig,
+		sessionErrorLogger{LoggerAdapter: watermill.NewStdLogger(false, false), sessions: sessions},
 	)
 	if err != nil {
 		return nil, fmt.Errorf("create kafka subscriber: %w", err)
 	}
 
-	return &Consumer{
-		subscriber:  subscriber,
-		handlers:    handlers,
-		config:      cfg,
-		cancelFuncs: make([]context.CancelFunc, 0),
-	}, nil
+	router, err := message.NewRouter(
+		message.RouterConfig{CloseTimeout: cfg.Shutdown.DrainTimeout},
+		watermill.NewStdLogger(false, false),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("create router: %w", err)
+	}
+
+	c := &Consumer{
+		router:        router,
+		subscriber:    subscriber,
+		saramaConfig:  subscriberConfig,
+		sessions:      sessions,
+		janitor:       janitor,
+		subscriptions: subscriptions,
+		config:        cfg,
+	}
+
+	if needsPublisher(subscriptions) {
+		publisherConfig, err := kafkaclient.PublisherConfig(cfg.Kafka)
+		if err != nil {
+			return nil, err
+		}
+
+		publisher, err := kafka.NewPublisher(
+			kafka.PublisherConfig{
+				Brokers:               cfg.Kafka.BrokerAddrs(),
+				Marshaler:             kafka.DefaultMarshaler{},
+				OverwriteSaramaConfig: publisherConfig,
+			},
+			watermill.NewStdLogger(false, false),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("create stream publisher: %w", err)
+		}
+		c.publisher = &streamPublisher{Publisher: publisher}
+		c.deadLetter = newDeadLetterPublisher(c.publisher)
+	}
+
+	for _, sub := range subscriptions {
+		if sub.middlewares, err = c.buildMiddlewareChain(sub); err != nil {
+			return nil, fmt.Errorf("stream %s: %w", sub.name, err)
+		}
+		if sub.producer != nil && sub.dedup != nil {
+			topic := sub.config.PublishTopic
+			sub.dedup.publish = func(msgs ...*message.Message) error {
+				return c.publisher.Publish(topic, msgs...)
+			}
+		}
+	}
+
+	if len(subscriptions) > 0 {
+		topics := make([]string, 0, len(subscriptions))
+		for _, sub := range subscriptions {
+			topics = append(topics, sub.config.Topic)
+			for _, tier := range sub.retryTiers {
+				topics = append(topics, tier.topic)
+			}
+		}
+		c.lag = newLagMonitor(
+			cfg.Kafka.BrokerAddrs(),
+			subscriberConfig,
+			cfg.Kafka.ConsumerGroup,
+			topics,
+			cfg.Kafka.Lag.CheckInterval,
+			cfg.Kafka.Lag.MaxLag,
+		)
+	}
+
+	return c, nil
+}
+
+func needsPublisher(subscriptions map[string]*subscription) bool {
+	for _, sub := range subscriptions {
+		if sub.config.DeadLetterTopic != "" || sub.config.PublishTopic != "" || len(sub.retryTiers) > 0 {
+			return true
+		}
+	}
+	return false
 }
 
+func needsIdempotency(subscriptions map[string]*subscription) bool {
+	for _, sub := range subscriptions {
+		if sub.config.Idempotency.Enable {
+			return true
+		}
+	}
+	return false
+}
+
+// Start adds a router handler for every registered stream and runs the
+// router until Shutdown. Cancelling ctx only stops fetching new messages;
+// call Shutdown to drain in-flight messages and close the subscriber.
 func (c *Consumer) Start(ctx context.Context) error {
-	if len(c.handlers) == 0 {
+	if len(c.subscriptions) == 0 {
 		log.Info("consumer: no handlers registered, skipping consumer start")
 		return nil
 	}
 
-	log.Infof("consumer: starting with %d handlers", len(c.handlers))
+	log.Infof("consumer: starting with %d handlers", len(c.subscriptions))
 
-	for topic, handler := range c.handlers {
-		log.Infof("consumer: subscribing to topic: %s", topic)
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-		messages, err := c.subscriber.Subscribe(ctx, topic)
-		if err != nil {
-			return fmt.Errorf("subscribe to topic %s: %w", topic, err)
+	c.handlerCtx, c.abortHandlers = context.WithCancel(context.WithoutCancel(ctx))
+	c.fetchCtx, c.stopFetching = context.WithCancel(c.handlerCtx)
+
+	topics := 0
+	for _, sub := range c.subscriptions {
+		topics += 1 + len(sub.retryTiers)
+	}
+	c.sessions.start(topics)
+
+	for _, sub := range c.subscriptions {
+		log.Infof("consumer: subscribing to topic: %s (stream: %s, concurrency=%d, queue_depth=%d)",
+			sub.config.Topic, sub.name, sub.config.Concurrency, sub.config.QueueDepth)
+		c.addHandler(sub, sub.name, sub.config.Topic)
+
+		for _, tier := range sub.retryTiers {
+			log.Infof("consumer: subscribing to retry topic: %s (stream: %s, delay: %s)", tier.topic, sub.name, tier.delay)
+			c.addHandler(sub, sub.name+strings.TrimPrefix(tier.topic, sub.config.Topic), tier.topic)
 		}
+	}
 
-		// Start a goroutine for each topic
-		c.wg.Add(1)
-		topicCtx, cancel := context.WithCancel(ctx)
-		c.cancelFuncs = append(c.cancelFuncs, cancel)
+	runErr := make(chan error, 1)
+	c.routerDone = make(chan struct{})
+	go func() {
+		defer close(c.routerDone)
+		if err := c.router.Run(c.handlerCtx); err != nil {
+			runErr <- err
+		}
+	}()
 
-		go c.processMessages(topicCtx, topic, messages, handler)
+	select {
+	case <-c.router.Running():
+	case <-c.routerDone:
+		select {
+		case err := <-runErr:
+			return fmt.Errorf("run router: %w", err)
+		default:
+			return errors.New("router stopped before running")
+		}
+	}
+
+	routerDone, stopFetching := c.routerDone, c.stopFetching
+	go func() {
+		select {
+		case <-ctx.Done():
+			stopFetching()
+		case <-routerDone:
+		}
+	}()
+
+	go c.warnUnfillableBatches()
+	c.lag.Start(c.handlerCtx)
+	if c.janitor != nil {
+		c.janitor.Start(c.handlerCtx)
+	}
+	if c.breaker != nil {
+		c.breaker.Start(c.handlerCtx)
 	}
 
 	log.Info("consumer: started successfully")
 	return nil
 }
 
-func (c *Consumer) processMessages(
-	ctx context.Context,
-	topic string,
-	messages <-chan *message.Message,
-	handler streamHandler.MessageHandler,
-) {
-	defer c.wg.Done()
+// addHandler registers a router handler running sub's handler on topic:
+// the stream's own topic or one of its retry tiers.
+// Around the configured middleware chain sit the stream's status tracking
+// and keyed worker pool; inside it, the attempt counter, schema validation,
+// circuit breaker, handler isolation and deduplication run closest to the
+// handler, so the breaker sees every attempt, including timed out and
+// panicking ones.
+func (c *Consumer) addHandler(sub *subscription, name, topic string) {
+	source := newStreamSubscriber(c.subscriber, c.handlerCtx, c.fetchCtx, c.stopFetching, sub)
 
-	log.Infof("consumer: processing messages for topic: %s", topic)
+	var handler *message.Handler
+	switch {
+	case sub.producer != nil:
+		handler = c.router.AddHandler(
+			name,
+			topic,
+			source,
+			sub.config.PublishTopic,
+			nopClosePublisher{c.publisher},
+			func(msg *message.Message) ([]*message.Message, error) {
+				return sub.producer.HandleAndProduce(msg.Context(), msg)
+			},
+		)
+	case sub.batchHandler != nil:
+		batches := newBatcher(topic, sub.config.BatchSize, sub.config.BatchLinger,
+			func() context.Context { return c.handlerCtx }, sub.isolateBatch)
+		handler = c.router.AddConsumerHandler(name, topic, source, func(msg *message.Message) error {
+			_, err := batches.Handle(msg)
+			return err
+		})
+	default:
+		handler = c.router.AddConsumerHandler(name, topic, source, func(msg *message.Message) error {
+			return sub.handler.Handle(msg.Context(), msg)
+		})
+	}
 
-	for {
-		select {
-		case <-ctx.Done():
-			log.Infof("consumer: stopping message processing for topic: %s", topic)
-			return
-		case msg, ok := <-messages:
-			if !ok {
-				log.Warnf("consumer: message channel closed for topic: %s", topic)
-				return
-			}
+	handler.AddMiddleware(c.inFlight.Middleware, sub.trackStatus)
+	if sub.batchHandler == nil {
+		// Batches need several messages in flight to fill up.
+		pool := newKeyedWorkerPool(sub.config.Concurrency, sub.config.QueueDepth)
+		c.pools = append(c.pools, pool)
+		handler.AddMiddleware(pool.Middleware)
+	}
+	handler.AddMiddleware(sub.middlewares...)
+	handler.AddMiddleware(countAttempts)
+	if sub.schema != nil {
+		handler.AddMiddleware(sub.validateSchema)
+	}
+	if c.breaker != nil && sub.config.CircuitBreaker {
+		handler.AddMiddleware(c.breaker.Middleware)
+	}
+	if sub.batchHandler == nil {
+		// Batches are isolated as a whole by the batcher.
+		handler.AddMiddleware(sub.isolateHandler)
+	}
+	if sub.dedup != nil && sub.batchHandler == nil {
+		handler.AddMiddleware(sub.dedup.Middleware)
+	}
+}
 
-			if err := handler.Handle(ctx, msg); err != nil {
-				log.Errorf("consumer: error processing message %s from topic %s: %v",
-					msg.UUID, topic, err)
-				// Drop message silently - no Nack
-			}
-		}
+// Lag returns the latest consumer lag snapshot for every subscribed topic.
+func (c *Consumer) Lag() (LagReport, error) {
+	if c.lag == nil {
+		return LagReport{ConsumerGroup: c.config.Kafka.ConsumerGroup}, nil
 	}
+	return c.lag.Report()
 }
 
+// Shutdown stops fetching new messages and closes the router, which waits
+// for in-flight messages to finish until ctx is done. If ctx expires first
+// the remaining handlers are cancelled, their messages are left unacked for
+// redelivery and an error wrapping ctx.Err() is returned. Either way
+// Shutdown only returns once every handler has returned, so the database
+// and publishers they use can be closed after it; the subscriber and
+// stream publisher are closed in both cases.
 func (c *Consumer) Shutdown(ctx context.Context) error {
 	log.Info("consumer: shutting down...")
 
-	// Cancel all topic processing goroutines
-	for _, cancel := range c.cancelFuncs {
-		cancel()
+	c.mu.Lock()
+	abortHandlers := c.abortHandlers
+	routerDone := c.routerDone
+	c.mu.Unlock()
+
+	var drainErr error
+	if routerDone != nil {
+		go func() {
+			if err := c.router.Close(); err != nil {
+				log.Warnf("consumer: router close: %v", err)
+			}
+		}()
+
+		select {
+		case <-routerDone:
+		case <-ctx.Done():
+			log.Warn("consumer: shutdown timeout exceeded, cancelling in-flight handlers")
+			drainErr = fmt.Errorf("drain in-flight messages: %w", ctx.Err())
+		}
 	}
 
-	// Wait for all goroutines to finish with timeout
-	done := make(chan struct{})
-	go func() {
-		c.wg.Wait()
-		close(done)
-	}()
+	if abortHandlers != nil {
+		abortHandlers()
+	}
+	if n := c.inFlight.count(); n > 0 {
+		log.Warnf("consumer: waiting for %d cancelled handlers to return", n)
+	}
+	c.inFlight.wait()
+	log.Info("consumer: all handlers stopped")
 
-	select {
-	case <-done:
-		log.Info("consumer: all goroutines stopped")
-	case <-ctx.Done():
-		log.Warn("consumer: shutdown timeout exceeded")
+	for _, pool := range c.pools {
+		pool.Close()
+	}
+
+	if c.lag != nil {
+		c.lag.Stop()
+	}
+	if c.janitor != nil {
+		c.janitor.Stop()
+	}
+	if c.breaker != nil {
+		c.breaker.Stop()
 	}
 
 	if err := c.subscriber.Close(); err != nil {
 		return fmt.Errorf("close subscriber: %w", err)
 	}
 
+	if c.publisher != nil {
+		if err := c.publisher.Close(); err != nil {
+			return fmt.Errorf("close stream publisher: %w", err)
+		}
+	}
+
+	if drainErr != nil {
+		return drainErr
+	}
+
 	log.Info("consumer: shutdown complete")
 	return nil
 }
+
+// inFlightCounter counts the messages being handled and lets Shutdown wait
+// until there are none.
+type inFlightCounter struct {
+	mu   sync.Mutex
+	n    int
+	idle chan struct{}
+}
+
+func (c *inFlightCounter) Middleware(h message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		c.mu.Lock()
+		c.n++
+		c.mu.Unlock()
+
+		defer func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			c.n--
+			if c.n == 0 && c.idle != nil {
+				close(c.idle)
+				c.idle = nil
+			}
+		}()
+
+		return h(msg)
+	}
+}
+
+func (c *inFlightCounter) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.n
+}
+
+// wait blocks until no message is being handled.
+func (c *inFlightCounter) wait() {
+	c.mu.Lock()
+	if c.n == 0 {
+		c.mu.Unlock()
+		return
+	}
+	if c.idle == nil {
+		c.idle = make(chan struct{})
+	}
+	idle := c.idle
+	c.mu.Unlock()
+
+	<-idle
+}
@@ -0,0 +1,134 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill-kafka/v3/pkg/kafka"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/consumer/streamHandler"
+)
+
+// Metadata keys describing why and where a message was dead-lettered.
+const (
+	DeadLetterErrorKey       = "dlq_error"
+	DeadLetterSourceTopicKey = "dlq_source_topic"
+	DeadLetterPartitionKey   = "dlq_partition"
+	DeadLetterOffsetKey      = "dlq_offset"
+	DeadLetterAttemptsKey    = "dlq_attempts"
+	DeadLetterFailedAtKey    = "dlq_failed_at"
+	// DeadLetterSchemaErrorsKey holds the JSON array of schema validation
+	// errors of a message that did not match its stream's schema.
+	DeadLetterSchemaErrorsKey = "dlq_schema_errors"
+)
+
+// deadLetterPublisher is the publisher behind the poison_queue middleware.
+// It republishes the original payload and metadata of each message, adding
+// headers that describe the failure.
+type deadLetterPublisher struct {
+	publisher message.Publisher
+}
+
+func newDeadLetterPublisher(publisher message.Publisher) *deadLetterPublisher {
+	return &deadLetterPublisher{publisher: publisher}
+}
+
+// Publish implements message.Publisher. The failure details are read from
+// the metadata Watermill's poison queue middleware sets before publishing.
+func (d *deadLetterPublisher) Publish(topic string, msgs ...*message.Message) error {
+	for _, msg := range msgs {
+		dlqMsg := message.NewMessage(msg.UUID, msg.Payload)
+		for key, value := range msg.Metadata {
+			dlqMsg.Metadata.Set(key, value)
+		}
+
+		sourceTopic := msg.Metadata.Get(middleware.PoisonedTopicKey)
+		attempts := msg.Metadata.Get(streamHandler.AttemptKey)
+		cause := msg.Metadata.Get(middleware.ReasonForPoisonedKey)
+
+		dlqMsg.Metadata.Set(DeadLetterErrorKey, cause)
+		dlqMsg.Metadata.Set(DeadLetterSourceTopicKey, sourceTopic)
+		dlqMsg.Metadata.Set(DeadLetterAttemptsKey, attempts)
+		dlqMsg.Metadata.Set(DeadLetterFailedAtKey, time.Now().UTC().Format(time.RFC3339Nano))
+
+		if partition, ok := kafka.MessagePartitionFromCtx(msg.Context()); ok {
+			dlqMsg.Metadata.Set(DeadLetterPartitionKey, strconv.FormatInt(int64(partition), 10))
+		}
+		if offset, ok := kafka.MessagePartitionOffsetFromCtx(msg.Context()); ok {
+			dlqMsg.Metadata.Set(DeadLetterOffsetKey, strconv.FormatInt(offset, 10))
+		}
+
+		if err := d.publisher.Publish(topic, dlqMsg); err != nil {
+			log.WithContext(msg.Context()).Errorf("consumer: failed to dead-letter message %s from topic %s: %v",
+				msg.UUID, sourceTopic, err)
+			return fmt.Errorf("publish to dead-letter topic %s: %w", topic, err)
+		}
+
+		log.WithContext(msg.Context()).Warnw("consumer: message dead-lettered",
+			"uuid", msg.UUID,
+			"source_topic", sourceTopic,
+			"dead_letter_topic", topic,
+			"attempts", attempts,
+			"error", cause)
+	}
+
+	return nil
+}
+
+// Close is a no-op: the underlying publisher is shared and closed by the
+// consumer.
+func (d *deadLetterPublisher) Close() error {
+	return nil
+}
+
+// shouldDeadLetter reports whether a failed message is routed aside. Transient
+// failures are nacked for redelivery instead, and cancelled handlers are left
+// for redelivery after a restart.
+func shouldDeadLetter(err error) bool {
+	return !streamHandler.IsTransient(err) && !errors.Is(err, context.Canceled)
+}
+
+// poisonQueue returns the poison_queue middleware of sub: Watermill's poison
+// queue publishing to the stream's dead-letter topic, or, without a
+// dead-letter topic, a middleware that logs and drops failed messages.
+// Either way the failed message is acked. With retry topics, failed
+// messages first go through the stream's retry tiers.
+func (c *Consumer) poisonQueue(sub *subscription) (message.HandlerMiddleware, error) {
+	deadLetter := dropFailed(sub.config.Topic)
+	if sub.config.DeadLetterTopic != "" {
+		var err error
+		deadLetter, err = middleware.PoisonQueueWithFilter(c.deadLetter, sub.config.DeadLetterTopic, shouldDeadLetter)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(sub.retryTiers) == 0 {
+		return deadLetter, nil
+	}
+
+	retryTopics := c.retryTopics(sub)
+	return func(h message.HandlerFunc) message.HandlerFunc {
+		return deadLetter(retryTopics(h))
+	}, nil
+}
+
+func dropFailed(topic string) message.HandlerMiddleware {
+	return func(h message.HandlerFunc) message.HandlerFunc {
+		return func(msg *message.Message) ([]*message.Message, error) {
+			produced, err := h(msg)
+			if err == nil || !shouldDeadLetter(err) {
+				return produced, err
+			}
+
+			log.Warnf("consumer: no dead-letter topic for %s, dropping message %s: %v", topic, msg.UUID, err)
+			msg.Metadata.Set(middleware.ReasonForPoisonedKey, err.Error())
+			return nil, nil
+		}
+	}
+}
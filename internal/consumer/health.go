@@ -0,0 +1,157 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/muazwzxv/kafka-consumer-worker/internal/health"
+)
+
+// HealthName implements health.Contributor.
+func (c *Consumer) HealthName() string {
+	return "consumer"
+}
+
+// Health implements health.Contributor. It is based on the subscriber's
+// consumer group sessions, one per subscribed topic: the consumer is
+// connected while every topic has one, and disconnected once a topic has
+// been without one for longer than a session timeout and rebalance timeout
+// allow, which is when the last subscriber error is reported. The last
+// success is the later of the last session setup and the last message
+// received on any stream.
+func (c *Consumer) Health(context.Context) health.Report {
+	if len(c.subscriptions) == 0 {
+		return health.Report{
+			State:   health.StateIdle,
+			Healthy: true,
+			Details: map[string]any{"streams": 0},
+		}
+	}
+
+	sessions := c.sessions.status()
+	report := health.Report{
+		State:       health.StateConnected,
+		Healthy:     true,
+		LastSuccess: sessions.LastSetup,
+		Details: map[string]any{
+			"streams":         len(c.subscriptions),
+			"consumer_group":  c.config.Kafka.ConsumerGroup,
+			"active_sessions": sessions.Active,
+			"topics":          sessions.Expected,
+		},
+	}
+
+	var paused []string
+	for _, status := range c.Streams() {
+		if status.LastMessageAt.After(report.LastSuccess) {
+			report.LastSuccess = status.LastMessageAt
+		}
+		if status.State != StreamStateRunning {
+			paused = append(paused, status.Name)
+		}
+	}
+	if len(paused) > 0 {
+		report.Details["paused_streams"] = paused
+	}
+	if sessions.LastErr != nil {
+		report.Details["last_error"] = sessions.LastErr.Error()
+		report.Details["last_error_at"] = sessions.LastErrAt
+	}
+
+	grace := c.config.Kafka.Group.SessionTimeout + c.config.Kafka.Group.RebalanceTimeout
+
+	switch {
+	case c.router.IsClosed():
+		report.State = health.StateStopped
+		report.Healthy = false
+		report.Error = "router closed"
+	case !c.router.IsRunning():
+		report.State = health.StateConnecting
+	case sessions.MissingSince.IsZero():
+	case time.Since(sessions.MissingSince) <= grace:
+		report.State = health.StateConnecting
+	default:
+		report.State = health.StateDisconnected
+		report.Healthy = false
+		report.Error = fmt.Sprintf("%d of %d topics without a consumer group session since %s",
+			sessions.Expected-sessions.Active, sessions.Expected, sessions.MissingSince.Format(time.RFC3339))
+		if sessions.LastErr != nil {
+			report.Error += ": " + sessions.LastErr.Error()
+		}
+	}
+
+	return report
+}
+
+// LagHealth returns the health contributor reporting consumer lag.
+func (c *Consumer) LagHealth() health.Contributor {
+	return lagHealth{c}
+}
+
+// Lag states reported by the consumer_lag health contributor.
+const (
+	LagStateWithinThreshold = "within_threshold"
+	LagStateAboveThreshold  = "above_threshold"
+	// LagStateUnknown is a lag check that is pending or failed.
+	LagStateUnknown = "unknown"
+)
+
+// lagHealth reports a total lag above the configured threshold as
+// unhealthy. A pending lag check, or one that has only just started
+// failing, is reported as unknown since it says nothing about whether
+// messages are being processed; once maxFailedLagChecks checks in a row
+// have failed the lag is unhealthy.
+type lagHealth struct {
+	c *Consumer
+}
+
+func (lagHealth) HealthName() string {
+	return "consumer_lag"
+}
+
+func (h lagHealth) Health(context.Context) health.Report {
+	report, err := h.c.Lag()
+	if err != nil && report.CheckFailing() {
+		return health.Report{
+			State:       LagStateUnknown,
+			Healthy:     false,
+			LastSuccess: report.CheckedAt,
+			Error:       fmt.Sprintf("lag check failed %d times in a row: %v", report.FailedChecks, err),
+		}
+	}
+	if err != nil && report.CheckedAt.IsZero() {
+		return health.Report{
+			State:   LagStateUnknown,
+			Healthy: true,
+			Error:   err.Error(),
+		}
+	}
+
+	topics := make(map[string]int64, len(report.Topics))
+	for _, topic := range report.Topics {
+		topics[topic.Topic] = topic.TotalLag
+	}
+
+	lag := health.Report{
+		State:       LagStateWithinThreshold,
+		Healthy:     true,
+		LastSuccess: report.CheckedAt,
+		Details: map[string]any{
+			"consumer_group": report.ConsumerGroup,
+			"total_lag":      report.TotalLag,
+			"threshold":      report.Threshold,
+			"topics":         topics,
+		},
+	}
+	if err != nil {
+		lag.Details["check_error"] = err.Error()
+	}
+	if report.ThresholdExceeded() {
+		lag.State = LagStateAboveThreshold
+		lag.Healthy = false
+		lag.Error = fmt.Sprintf("total lag %d above threshold %d", report.TotalLag, report.Threshold)
+	}
+
+	return lag
+}
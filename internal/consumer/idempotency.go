@@ -0,0 +1,346 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill-kafka/v3/pkg/kafka"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/config"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/consumer/streamHandler"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/database"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/repository"
+)
+
+const (
+	defaultDedupCleanupInterval  = time.Hour
+	defaultDedupCleanupBatchSize = 1000
+)
+
+var errDuplicateMessage = errors.New("message already processed")
+
+// txRunner runs fn in a transaction carried by the context it is given.
+type txRunner interface {
+	WithTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// deduplicator skips messages whose idempotency key was already recorded
+// for the stream. The key is recorded in the same transaction as the
+// handler's side effects, so a message is marked processed if and only if
+// those side effects were committed.
+type deduplicator struct {
+	stream    string
+	keyOf     func(msg *message.Message) (string, error)
+	processed repository.ProcessedMessageRepository
+	tx        txRunner
+	// publish, set for producing streams, publishes the produced messages
+	// before the transaction commits.
+	publish func(msgs ...*message.Message) error
+}
+
+func newDeduplicator(
+	stream string,
+	cfg config.StreamIdempotencyConfig,
+	processed repository.ProcessedMessageRepository,
+	tx txRunner,
+) (*deduplicator, error) {
+	keyOf, err := idempotencyKeyFunc(cfg.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &deduplicator{
+		stream:    stream,
+		keyOf:     keyOf,
+		processed: processed,
+		tx:        tx,
+	}, nil
+}
+
+// Middleware runs the handler inside a transaction that also records the
+// message as processed; the handler sees the transaction through the
+// message context. Duplicates are skipped and acked. Messages a producing
+// handler returns are published before the commit, so a failed publish
+// rolls the mark back and the message is redelivered. Delivery of produced
+// messages is at least once: if the commit fails after they were
+// published, the redelivered message publishes them again.
+func (d *deduplicator) Middleware(h message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		key, err := d.keyOf(msg)
+		if err != nil {
+			return nil, streamHandler.Permanent(fmt.Errorf("idempotency key: %w", err))
+		}
+
+		msgCtx := msg.Context()
+		defer msg.SetContext(msgCtx)
+
+		var produced []*message.Message
+		err = d.tx.WithTx(msgCtx, func(ctx context.Context) error {
+			marked, err := d.processed.MarkProcessed(ctx, d.stream, key)
+			if err != nil {
+				return classifyDedupError(fmt.Errorf("mark message processed: %w", err))
+			}
+			if !marked {
+				return errDuplicateMessage
+			}
+
+			msg.SetContext(ctx)
+			produced, err = h(msg)
+			if err != nil || d.publish == nil || len(produced) == 0 {
+				return err
+			}
+
+			// Nothing is returned for the correlation_id middleware to
+			// stamp, so the correlation ID is carried over here.
+			if id := middleware.MessageCorrelationID(msg); id != "" {
+				for _, out := range produced {
+					middleware.SetCorrelationID(id, out)
+				}
+			}
+			if err := d.publish(produced...); err != nil {
+				return streamHandler.Transient(fmt.Errorf("publish produced messages: %w", err))
+			}
+			produced = nil
+			return nil
+		})
+		if errors.Is(err, errDuplicateMessage) {
+			log.Infof("consumer: skipping duplicate message %s on stream %s (key: %s)", msg.UUID, d.stream, key)
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return produced, nil
+	}
+}
+
+// WrapBatch is Middleware for batch handlers. The whole batch runs in one
+// transaction; the processed marks of messages that failed are removed
+// again before commit so they can be reprocessed.
+func (d *deduplicator) WrapBatch(
+	handle func(ctx context.Context, msgs []*message.Message) []error,
+) func(ctx context.Context, msgs []*message.Message) []error {
+	return func(ctx context.Context, msgs []*message.Message) []error {
+		errs := make([]error, len(msgs))
+		keys := make([]string, len(msgs))
+
+		txErr := d.tx.WithTx(ctx, func(ctx context.Context) error {
+			fresh := make([]*message.Message, 0, len(msgs))
+			freshIdx := make([]int, 0, len(msgs))
+
+			for i, msg := range msgs {
+				key, err := d.keyOf(msg)
+				if err != nil {
+					errs[i] = streamHandler.Permanent(fmt.Errorf("idempotency key: %w", err))
+					continue
+				}
+				keys[i] = key
+
+				marked, err := d.processed.MarkProcessed(ctx, d.stream, key)
+				if err != nil {
+					return classifyDedupError(fmt.Errorf("mark message processed: %w", err))
+				}
+				if !marked {
+					log.Infof("consumer: skipping duplicate message %s on stream %s (key: %s)", msg.UUID, d.stream, key)
+					continue
+				}
+
+				fresh = append(fresh, msg)
+				freshIdx = append(freshIdx, i)
+			}
+
+			if len(fresh) == 0 {
+				return nil
+			}
+
+			results := handle(ctx, fresh)
+			if len(results) != len(fresh) {
+				return fmt.Errorf("batch handler returned %d results for %d messages", len(results), len(fresh))
+			}
+
+			for j, err := range results {
+				i := freshIdx[j]
+				errs[i] = err
+				if err == nil {
+					continue
+				}
+				if err := d.processed.Unmark(ctx, d.stream, keys[i]); err != nil {
+					return classifyDedupError(fmt.Errorf("unmark failed message: %w", err))
+				}
+			}
+
+			return nil
+		})
+
+		if txErr != nil {
+			for i := range errs {
+				errs[i] = txErr
+			}
+		}
+
+		return errs
+	}
+}
+
+func classifyDedupError(err error) error {
+	if database.IsTransientError(err) {
+		return streamHandler.Transient(err)
+	}
+	return err
+}
+
+// idempotencyKeyFunc returns the function extracting the idempotency key
+// described by source:
+//   - "" or "message_uuid": the Watermill message UUID
+//   - "kafka_key": the Kafka message key
+//   - "metadata:<name>": the value of a message header
+//   - "payload:<field>": a top-level field of the JSON payload
+func idempotencyKeyFunc(source string) (func(msg *message.Message) (string, error), error) {
+	switch {
+	case source == "" || source == "message_uuid":
+		return func(msg *message.Message) (string, error) {
+			if msg.UUID == "" {
+				return "", errors.New("message has no UUID")
+			}
+			return msg.UUID, nil
+		}, nil
+
+	case source == "kafka_key":
+		return func(msg *message.Message) (string, error) {
+			key, ok := kafka.MessageKeyFromCtx(msg.Context())
+			if !ok || len(key) == 0 {
+				return "", errors.New("message has no kafka key")
+			}
+			return string(key), nil
+		}, nil
+
+	case strings.HasPrefix(source, "metadata:"):
+		name := strings.TrimPrefix(source, "metadata:")
+		return func(msg *message.Message) (string, error) {
+			value := msg.Metadata.Get(name)
+			if value == "" {
+				return "", fmt.Errorf("message has no %s metadata", name)
+			}
+			return value, nil
+		}, nil
+
+	case strings.HasPrefix(source, "payload:"):
+		field := strings.TrimPrefix(source, "payload:")
+		return func(msg *message.Message) (string, error) {
+			var payload map[string]json.RawMessage
+			if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+				return "", fmt.Errorf("decode payload: %w", err)
+			}
+			raw, ok := payload[field]
+			if !ok {
+				return "", fmt.Errorf("payload has no %s field", field)
+			}
+
+			var value string
+			if err := json.Unmarshal(raw, &value); err != nil {
+				// Not a string: use the raw JSON, e.g. for numeric IDs.
+				value = string(raw)
+			}
+			if value == "" || value == "null" {
+				return "", fmt.Errorf("payload field %s is empty", field)
+			}
+			return value, nil
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unknown idempotency key source: %s (valid: message_uuid, kafka_key, metadata:<name>, payload:<field>)", source)
+}
+
+// processedMessageJanitor periodically deletes processed-message records
+// older than the retention period.
+type processedMessageJanitor struct {
+	processed repository.ProcessedMessageRepository
+	retention time.Duration
+	interval  time.Duration
+	batchSize int
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newProcessedMessageJanitor(
+	processed repository.ProcessedMessageRepository,
+	cfg config.IdempotencyConfig,
+) *processedMessageJanitor {
+	j := &processedMessageJanitor{
+		processed: processed,
+		retention: cfg.Retention,
+		interval:  cfg.CleanupInterval,
+		batchSize: cfg.CleanupBatchSize,
+	}
+	if j.interval <= 0 {
+		j.interval = defaultDedupCleanupInterval
+	}
+	if j.batchSize <= 0 {
+		j.batchSize = defaultDedupCleanupBatchSize
+	}
+	return j
+}
+
+func (j *processedMessageJanitor) Start(ctx context.Context) {
+	if j.retention <= 0 {
+		log.Info("consumer: processed-message retention disabled, skipping cleanup")
+		return
+	}
+
+	ctx, j.cancel = context.WithCancel(ctx)
+	j.done = make(chan struct{})
+
+	go func() {
+		defer close(j.done)
+
+		ticker := time.NewTicker(j.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				j.cleanup(ctx)
+			}
+		}
+	}()
+}
+
+func (j *processedMessageJanitor) Stop() {
+	if j.cancel == nil {
+		return
+	}
+	j.cancel()
+	<-j.done
+}
+
+// cleanup deletes expired records in batches to keep each DELETE short.
+func (j *processedMessageJanitor) cleanup(ctx context.Context) {
+	cutoff := time.Now().Add(-j.retention)
+
+	var total int64
+	for {
+		deleted, err := j.processed.DeleteProcessedBefore(ctx, cutoff, j.batchSize)
+		if err != nil {
+			log.Errorf("consumer: failed to clean up processed messages: %v", err)
+			return
+		}
+		total += deleted
+		if deleted < int64(j.batchSize) || ctx.Err() != nil {
+			break
+		}
+	}
+
+	if total > 0 {
+		log.Infof("consumer: cleaned up %d processed messages older than %s", total, cutoff.Format(time.RFC3339))
+	}
+}
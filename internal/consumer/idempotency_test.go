@@ -0,0 +1,179 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/config"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/consumer/streamHandler"
+)
+
+// memoryProcessed records processed keys in a map; testTx commits or
+// rolls back its marks.
+type memoryProcessed struct {
+	keys map[string]bool
+}
+
+func (m *memoryProcessed) MarkProcessed(_ context.Context, stream, key string) (bool, error) {
+	if m.keys[stream+"/"+key] {
+		return false, nil
+	}
+	m.keys[stream+"/"+key] = true
+	return true, nil
+}
+
+func (m *memoryProcessed) Unmark(_ context.Context, stream, key string) error {
+	delete(m.keys, stream+"/"+key)
+	return nil
+}
+
+func (m *memoryProcessed) DeleteProcessedBefore(context.Context, time.Time, int) (int64, error) {
+	return 0, nil
+}
+
+type testTx struct {
+	processed *memoryProcessed
+}
+
+func (tx testTx) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	saved := make(map[string]bool, len(tx.processed.keys))
+	for k, v := range tx.processed.keys {
+		saved[k] = v
+	}
+	if err := fn(ctx); err != nil {
+		tx.processed.keys = saved
+		return err
+	}
+	return nil
+}
+
+func newTestDeduplicator(t *testing.T, publish func(msgs ...*message.Message) error) *deduplicator {
+	t.Helper()
+
+	processed := &memoryProcessed{keys: map[string]bool{}}
+	d, err := newDeduplicator("orders", config.StreamIdempotencyConfig{}, processed, testTx{processed})
+	if err != nil {
+		t.Fatalf("newDeduplicator: %v", err)
+	}
+	d.publish = publish
+	return d
+}
+
+func TestDeduplicatorPublishesBeforeMarking(t *testing.T) {
+	errBroker := errors.New("broker down")
+	publishErr := errBroker
+	var published []*message.Message
+	d := newTestDeduplicator(t, func(msgs ...*message.Message) error {
+		if publishErr != nil {
+			return publishErr
+		}
+		published = append(published, msgs...)
+		return nil
+	})
+
+	handler := d.Middleware(func(*message.Message) ([]*message.Message, error) {
+		return []*message.Message{message.NewMessage(watermill.NewUUID(), nil)}, nil
+	})
+	msg := message.NewMessage(watermill.NewUUID(), nil)
+	middleware.SetCorrelationID("c-1", msg)
+
+	if _, err := handler(msg); !errors.Is(err, errBroker) || !streamHandler.IsTransient(err) {
+		t.Fatalf("err = %v, want the transient publish failure", err)
+	}
+
+	// Redelivered after the failed publish: not a duplicate.
+	publishErr = nil
+	produced, err := handler(msg)
+	if err != nil {
+		t.Fatalf("redelivery: %v", err)
+	}
+	if len(produced) != 0 {
+		t.Errorf("returned %d messages, want them published by the deduplicator", len(produced))
+	}
+	if len(published) != 1 {
+		t.Fatalf("published %d messages, want 1", len(published))
+	}
+	if got := middleware.MessageCorrelationID(published[0]); got != "c-1" {
+		t.Errorf("correlation ID = %q, want it carried over", got)
+	}
+
+	if _, err := handler(msg); err != nil || len(published) != 1 {
+		t.Fatalf("duplicate = %v with %d published, want it skipped", err, len(published))
+	}
+}
+
+func TestIdempotencyKeyFunc(t *testing.T) {
+	msg := message.NewMessage("9b2c3f4e-1a2b-4c3d-8e9f-0a1b2c3d4e5f",
+		[]byte(`{"event_id":"evt-7","order_id":1042,"empty":"","missing":null}`))
+	msg.Metadata.Set("x-request-id", "req-1")
+
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"", "9b2c3f4e-1a2b-4c3d-8e9f-0a1b2c3d4e5f"},
+		{"message_uuid", "9b2c3f4e-1a2b-4c3d-8e9f-0a1b2c3d4e5f"},
+		{"metadata:x-request-id", "req-1"},
+		{"payload:event_id", "evt-7"},
+		{"payload:order_id", "1042"},
+	}
+
+	for _, tt := range tests {
+		keyFunc, err := idempotencyKeyFunc(tt.source)
+		if err != nil {
+			t.Fatalf("idempotencyKeyFunc(%q): %v", tt.source, err)
+		}
+		got, err := keyFunc(msg)
+		if err != nil {
+			t.Errorf("key from %q: %v", tt.source, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("key from %q = %q, want %q", tt.source, got, tt.want)
+		}
+	}
+}
+
+func TestIdempotencyKeyFuncMissingKey(t *testing.T) {
+	msg := message.NewMessage("", []byte(`{"empty":"","missing":null}`))
+
+	for _, source := range []string{
+		"message_uuid",
+		"kafka_key",
+		"metadata:x-request-id",
+		"payload:event_id",
+		"payload:empty",
+		"payload:missing",
+	} {
+		keyFunc, err := idempotencyKeyFunc(source)
+		if err != nil {
+			t.Fatalf("idempotencyKeyFunc(%q): %v", source, err)
+		}
+		if key, err := keyFunc(msg); err == nil {
+			t.Errorf("key from %q = %q, want an error", source, key)
+		}
+	}
+}
+
+func TestIdempotencyKeyFuncPayloadNotJSON(t *testing.T) {
+	keyFunc, err := idempotencyKeyFunc("payload:event_id")
+	if err != nil {
+		t.Fatalf("idempotencyKeyFunc: %v", err)
+	}
+	if _, err := keyFunc(message.NewMessage("1", []byte("not json"))); err == nil {
+		t.Error("key from a non-JSON payload succeeded, want an error")
+	}
+}
+
+func TestIdempotencyKeyFuncUnknownSource(t *testing.T) {
+	for _, source := range []string{"uuid", "header:x-request-id", "kafka_offset"} {
+		if _, err := idempotencyKeyFunc(source); err == nil {
+			t.Errorf("idempotencyKeyFunc(%q) succeeded, want an error", source)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/consumer/streamHandler"
+)
+
+var (
+	// ErrHandlerPanic is wrapped by the permanent failure a panicking
+	// handler attempt is turned into.
+	ErrHandlerPanic = errors.New("handler panicked")
+	// ErrHandlerTimeout is wrapped by the transient failure of an attempt
+	// that failed past the stream's handler_timeout.
+	ErrHandlerTimeout = errors.New("handler timed out")
+)
+
+// handlerPanic carries a recovered panic and the stack it was raised on.
+type handlerPanic struct {
+	value any
+	stack []byte
+}
+
+func (p *handlerPanic) Error() string {
+	return fmt.Sprintf("%v: %v", ErrHandlerPanic, p.value)
+}
+
+func (p *handlerPanic) Unwrap() error {
+	return ErrHandlerPanic
+}
+
+// isolate runs fn, one handler attempt of the stream, with a context
+// bounded by the stream's handler_timeout. fn runs on the caller's
+// goroutine, so an attempt always finishes before the message is retried
+// or settled; if it fails after the deadline has passed, the failure is
+// reported as a timeout. A handler must watch its context for the timeout
+// to take effect. A panic in fn is recovered, logged with its stack and
+// returned as a permanent failure, so the message is dead-lettered rather
+// than retried or taking the process down.
+func isolate[T any](
+	ctx context.Context,
+	sub *subscription,
+	fn func(ctx context.Context) (T, error),
+) (T, error) {
+	timeout := sub.config.HandlerTimeout
+	if timeout <= 0 {
+		return recoverPanic(ctx, sub, fn)
+	}
+
+	attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	value, err := recoverPanic(attemptCtx, sub, fn)
+	if err != nil && !streamHandler.IsPermanent(err) && pastDeadline(ctx, attemptCtx) {
+		sub.timedOut(ctx, timeout)
+		return value, timeoutError(timeout, err)
+	}
+	return value, err
+}
+
+// pastDeadline reports whether attemptCtx ended on its own deadline while
+// its parent ctx is still live.
+func pastDeadline(ctx, attemptCtx context.Context) bool {
+	return errors.Is(attemptCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil
+}
+
+func recoverPanic[T any](
+	ctx context.Context,
+	sub *subscription,
+	fn func(ctx context.Context) (T, error),
+) (value T, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			sub.state.recordPanic()
+			panicErr := &handlerPanic{value: p, stack: debug.Stack()}
+			log.WithContext(ctx).Errorw("consumer: handler panicked",
+				"stream", sub.name,
+				"panic", p,
+				"stack", string(panicErr.stack))
+			err = streamHandler.Permanent(panicErr)
+		}
+	}()
+
+	return fn(ctx)
+}
+
+func (s *subscription) timedOut(ctx context.Context, timeout time.Duration) {
+	s.state.recordTimedOut()
+	log.WithContext(ctx).Warnw("consumer: handler timed out",
+		"stream", s.name,
+		"timeout", timeout)
+}
+
+func timeoutError(timeout time.Duration, cause error) error {
+	return streamHandler.Transient(fmt.Errorf("%w after %s: %w", ErrHandlerTimeout, timeout, cause))
+}
+
+// isolateHandler is the router middleware running each attempt of a
+// message stream's handler through isolate.
+func (s *subscription) isolateHandler(h message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		return isolate(msg.Context(), s, func(ctx context.Context) ([]*message.Message, error) {
+			parent := msg.Context()
+			msg.SetContext(ctx)
+			defer msg.SetContext(parent)
+			return h(msg)
+		})
+	}
+}
+
+// isolateBatch runs a batch through isolate as one attempt. A panic fails
+// every message of the batch; past the deadline, each message that failed
+// is reported as a timeout the way isolate reports a single message.
+func (s *subscription) isolateBatch(ctx context.Context, msgs []*message.Message) []error {
+	timeout := s.config.HandlerTimeout
+	errs, err := isolate(ctx, s, func(attemptCtx context.Context) ([]error, error) {
+		errs := s.handleBatch(attemptCtx, msgs)
+		if timeout <= 0 || !pastDeadline(ctx, attemptCtx) {
+			return errs, nil
+		}
+
+		timedOut := false
+		for i, err := range errs {
+			if err != nil && !streamHandler.IsPermanent(err) {
+				errs[i] = timeoutError(timeout, err)
+				timedOut = true
+			}
+		}
+		if timedOut {
+			s.timedOut(ctx, timeout)
+		}
+		return errs, nil
+	})
+	if err != nil {
+		errs = make([]error, len(msgs))
+		for i := range errs {
+			errs[i] = err
+		}
+	}
+	return errs
+}
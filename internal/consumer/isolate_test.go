@@ -0,0 +1,128 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/config"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/consumer/streamHandler"
+)
+
+func newIsolateSubscription(t *testing.T, timeout time.Duration) *subscription {
+	t.Helper()
+
+	state, err := newStreamState(config.RateLimitConfig{})
+	if err != nil {
+		t.Fatalf("newStreamState: %v", err)
+	}
+	return &subscription{name: "orders", state: state, config: config.StreamConfig{HandlerTimeout: timeout}}
+}
+
+func TestIsolateTimeoutWaitsForAttempt(t *testing.T) {
+	sub := newIsolateSubscription(t, 10*time.Millisecond)
+
+	finished := false
+	_, err := isolate(context.Background(), sub, func(ctx context.Context) (struct{}, error) {
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		finished = true
+		return struct{}{}, ctx.Err()
+	})
+
+	if !finished {
+		t.Fatal("isolate returned before the attempt finished")
+	}
+	if !errors.Is(err, ErrHandlerTimeout) || !streamHandler.IsTransient(err) {
+		t.Fatalf("err = %v, want a transient ErrHandlerTimeout", err)
+	}
+}
+
+func TestIsolateBatchTimeout(t *testing.T) {
+	sub := newIsolateSubscription(t, 10*time.Millisecond)
+	errDone := errors.New("already failed")
+	sub.handleBatch = func(ctx context.Context, msgs []*message.Message) []error {
+		<-ctx.Done()
+		return []error{nil, ctx.Err(), streamHandler.Permanent(errDone)}
+	}
+
+	msgs := make([]*message.Message, 3)
+	for i := range msgs {
+		msgs[i] = message.NewMessage(watermill.NewUUID(), nil)
+	}
+	errs := sub.isolateBatch(context.Background(), msgs)
+
+	if errs[0] != nil {
+		t.Errorf("errs[0] = %v, want the success kept", errs[0])
+	}
+	if !errors.Is(errs[1], ErrHandlerTimeout) || !streamHandler.IsTransient(errs[1]) {
+		t.Errorf("errs[1] = %v, want a transient ErrHandlerTimeout", errs[1])
+	}
+	if errors.Is(errs[2], ErrHandlerTimeout) || !streamHandler.IsPermanent(errs[2]) {
+		t.Errorf("errs[2] = %v, want the permanent failure kept", errs[2])
+	}
+	if got := sub.state.timedOut.Load(); got != 1 {
+		t.Errorf("TimedOut = %d, want the batch counted as one attempt", got)
+	}
+}
+
+func TestIsolateSuccessAfterDeadlineIsKept(t *testing.T) {
+	sub := newIsolateSubscription(t, time.Millisecond)
+
+	value, err := isolate(context.Background(), sub, func(ctx context.Context) (int, error) {
+		<-ctx.Done()
+		return 42, nil
+	})
+	if err != nil || value != 42 {
+		t.Fatalf("isolate = %d, %v; want the attempt's result", value, err)
+	}
+}
+
+func TestIsolateCancelledParentIsNotATimeout(t *testing.T) {
+	sub := newIsolateSubscription(t, time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := isolate(ctx, sub, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, ctx.Err()
+	})
+	if !errors.Is(err, context.Canceled) || errors.Is(err, ErrHandlerTimeout) {
+		t.Fatalf("err = %v, want the cancellation", err)
+	}
+}
+
+func TestIsolateRecoversPanic(t *testing.T) {
+	for _, timeout := range []time.Duration{0, time.Minute} {
+		sub := newIsolateSubscription(t, timeout)
+
+		_, err := isolate(context.Background(), sub, func(context.Context) (struct{}, error) {
+			panic("boom")
+		})
+		if !errors.Is(err, ErrHandlerPanic) || !streamHandler.IsPermanent(err) {
+			t.Errorf("timeout %s: err = %v, want a permanent ErrHandlerPanic", timeout, err)
+		}
+	}
+}
+
+func TestIsolateHandlerRestoresMessageContext(t *testing.T) {
+	sub := newIsolateSubscription(t, time.Minute)
+
+	msg := message.NewMessage(watermill.NewUUID(), nil)
+	parent := msg.Context()
+
+	handler := sub.isolateHandler(func(msg *message.Message) ([]*message.Message, error) {
+		if _, ok := msg.Context().Deadline(); !ok {
+			t.Error("handler context has no deadline")
+		}
+		return nil, nil
+	})
+	if _, err := handler(msg); err != nil {
+		t.Fatalf("handler: %v", err)
+	}
+	if msg.Context() != parent {
+		t.Error("message context not restored after the attempt")
+	}
+}
@@ -0,0 +1,272 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/gofiber/fiber/v2/log"
+)
+
+const defaultLagCheckInterval = 15 * time.Second
+
+// maxFailedLagChecks is how many lag checks in a row may fail before the
+// lag is reported unhealthy.
+const maxFailedLagChecks = 3
+
+var ErrLagNotAvailable = errors.New("consumer lag not available yet")
+
+// PartitionLag compares the consumer group's committed offset on a
+// partition with the partition's high-water mark.
+type PartitionLag struct {
+	Partition int32
+	// CommittedOffset is -1 when the group has not committed on the partition.
+	CommittedOffset int64
+	HighWaterMark   int64
+	Lag             int64
+}
+
+type TopicLag struct {
+	Topic      string
+	Partitions []PartitionLag
+	TotalLag   int64
+}
+
+// LagReport is the latest lag snapshot for every subscribed topic.
+type LagReport struct {
+	ConsumerGroup string
+	Topics        []TopicLag
+	TotalLag      int64
+	// Threshold is the configured maximum total lag; 0 means unlimited.
+	Threshold int64
+	CheckedAt time.Time
+	// FailedChecks counts the lag checks that failed since CheckedAt.
+	FailedChecks int
+}
+
+// CheckFailing reports whether the lag check has failed too many times in a
+// row for the snapshot to be trusted.
+func (r LagReport) CheckFailing() bool {
+	return r.FailedChecks >= maxFailedLagChecks
+}
+
+// ThresholdExceeded reports whether the total lag is above the configured
+// threshold.
+func (r LagReport) ThresholdExceeded() bool {
+	return r.Threshold > 0 && r.TotalLag > r.Threshold
+}
+
+// lagMonitor periodically polls committed offsets and high-water marks so
+// lag can be served to health checks without a broker round trip.
+type lagMonitor struct {
+	brokers   []string
+	config    *sarama.Config
+	group     string
+	topics    []string
+	interval  time.Duration
+	threshold int64
+
+	mu       sync.RWMutex
+	report   LagReport
+	lastErr  error
+	checked  bool
+	failures int
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newLagMonitor(
+	brokers []string,
+	saramaConfig *sarama.Config,
+	group string,
+	topics []string,
+	interval time.Duration,
+	threshold int64,
+) *lagMonitor {
+	if interval <= 0 {
+		interval = defaultLagCheckInterval
+	}
+
+	return &lagMonitor{
+		brokers:   brokers,
+		config:    saramaConfig,
+		group:     group,
+		topics:    topics,
+		interval:  interval,
+		threshold: threshold,
+	}
+}
+
+// Start polls lag in the background until Stop is called.
+func (m *lagMonitor) Start(ctx context.Context) {
+	ctx, m.cancel = context.WithCancel(ctx)
+	m.done = make(chan struct{})
+
+	go func() {
+		defer close(m.done)
+
+		var (
+			client sarama.Client
+			admin  sarama.ClusterAdmin
+		)
+		defer func() {
+			if client != nil {
+				client.Close()
+			}
+		}()
+
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+
+		for {
+			var err error
+			if client == nil {
+				// Retried every interval, so a broker that is down at
+				// startup counts as a failing check until it is back.
+				client, admin, err = m.connect()
+			}
+
+			var report LagReport
+			if err == nil {
+				report, err = m.check(client, admin)
+			}
+			if err != nil {
+				log.Warnf("consumer: lag check failed: %v", err)
+			}
+			m.store(report, err)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (m *lagMonitor) connect() (sarama.Client, sarama.ClusterAdmin, error) {
+	client, err := sarama.NewClient(m.brokers, m.config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("create kafka client: %w", err)
+	}
+
+	admin, err := sarama.NewClusterAdminFromClient(client)
+	if err != nil {
+		client.Close()
+		return nil, nil, fmt.Errorf("create cluster admin: %w", err)
+	}
+
+	return client, admin, nil
+}
+
+func (m *lagMonitor) Stop() {
+	if m.cancel == nil {
+		return
+	}
+	m.cancel()
+	<-m.done
+}
+
+// Report returns the latest lag snapshot. When the latest check failed,
+// the previous snapshot is returned together with the error and the number
+// of checks that failed since.
+func (m *lagMonitor) Report() (LagReport, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if !m.checked {
+		return LagReport{}, ErrLagNotAvailable
+	}
+	report := m.report
+	report.FailedChecks = m.failures
+	return report, m.lastErr
+}
+
+func (m *lagMonitor) store(report LagReport, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.checked = true
+	m.lastErr = err
+	if err != nil {
+		m.failures++
+		return
+	}
+	m.failures = 0
+	m.report = report
+}
+
+func (m *lagMonitor) check(client sarama.Client, admin sarama.ClusterAdmin) (LagReport, error) {
+	if err := client.RefreshMetadata(m.topics...); err != nil {
+		return LagReport{}, fmt.Errorf("refresh metadata: %w", err)
+	}
+
+	topicPartitions := make(map[string][]int32, len(m.topics))
+	for _, topic := range m.topics {
+		partitions, err := client.Partitions(topic)
+		if err != nil {
+			return LagReport{}, fmt.Errorf("list partitions of %s: %w", topic, err)
+		}
+		topicPartitions[topic] = partitions
+	}
+
+	committed, err := admin.ListConsumerGroupOffsets(m.group, topicPartitions)
+	if err != nil {
+		return LagReport{}, fmt.Errorf("list offsets of group %s: %w", m.group, err)
+	}
+
+	report := LagReport{
+		ConsumerGroup: m.group,
+		Threshold:     m.threshold,
+		CheckedAt:     time.Now(),
+	}
+
+	for _, topic := range m.topics {
+		topicLag := TopicLag{Topic: topic}
+
+		for _, partition := range topicPartitions[topic] {
+			highWaterMark, err := client.GetOffset(topic, partition, sarama.OffsetNewest)
+			if err != nil {
+				return LagReport{}, fmt.Errorf("get high-water mark of %s/%d: %w", topic, partition, err)
+			}
+
+			partitionLag := PartitionLag{
+				Partition:       partition,
+				CommittedOffset: -1,
+				HighWaterMark:   highWaterMark,
+			}
+
+			start := int64(-1)
+			if block := committed.GetBlock(topic, partition); block != nil && block.Offset >= 0 {
+				partitionLag.CommittedOffset = block.Offset
+				start = block.Offset
+			}
+			if start < 0 {
+				// Nothing committed yet: everything still retained is pending.
+				oldest, err := client.GetOffset(topic, partition, sarama.OffsetOldest)
+				if err != nil {
+					return LagReport{}, fmt.Errorf("get oldest offset of %s/%d: %w", topic, partition, err)
+				}
+				start = oldest
+			}
+
+			partitionLag.Lag = max(highWaterMark-start, 0)
+			topicLag.Partitions = append(topicLag.Partitions, partitionLag)
+			topicLag.TotalLag += partitionLag.Lag
+		}
+
+		sort.Slice(topicLag.Partitions, func(i, j int) bool {
+			return topicLag.Partitions[i].Partition < topicLag.Partitions[j].Partition
+		})
+
+		report.Topics = append(report.Topics, topicLag)
+		report.TotalLag += topicLag.TotalLag
+	}
+
+	return report, nil
+}
@@ -0,0 +1,78 @@
+package consumer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
+)
+
+// middlewareFactories build the middleware a stream's chain can list.
+var middlewareFactories = map[string]func(c *Consumer, sub *subscription) (message.HandlerMiddleware, error){
+	"correlation_id": func(*Consumer, *subscription) (message.HandlerMiddleware, error) {
+		return middleware.CorrelationID, nil
+	},
+	"recoverer": func(*Consumer, *subscription) (message.HandlerMiddleware, error) {
+		return middleware.Recoverer, nil
+	},
+	"retry": func(_ *Consumer, sub *subscription) (message.HandlerMiddleware, error) {
+		return sub.retry.middleware(), nil
+	},
+	"poison_queue": func(c *Consumer, sub *subscription) (message.HandlerMiddleware, error) {
+		return c.poisonQueue(sub)
+	},
+	"timeout": func(_ *Consumer, sub *subscription) (message.HandlerMiddleware, error) {
+		if sub.config.Middleware.Timeout <= 0 {
+			return nil, errors.New("middleware timeout requires middleware.timeout > 0")
+		}
+		return middleware.Timeout(sub.config.Middleware.Timeout), nil
+	},
+	"throttle": func(_ *Consumer, sub *subscription) (message.HandlerMiddleware, error) {
+		if sub.config.Middleware.ThrottlePerSecond <= 0 {
+			return nil, errors.New("middleware throttle requires middleware.throttle_per_second > 0")
+		}
+		return middleware.NewThrottle(sub.config.Middleware.ThrottlePerSecond, time.Second).Middleware, nil
+	},
+}
+
+// buildMiddlewareChain builds the middleware listed in the stream's chain,
+// outermost first.
+func (c *Consumer) buildMiddlewareChain(sub *subscription) ([]message.HandlerMiddleware, error) {
+	chain := make([]message.HandlerMiddleware, 0, len(sub.config.Middleware.Chain))
+	seen := make(map[string]bool, len(sub.config.Middleware.Chain))
+
+	for _, name := range sub.config.Middleware.Chain {
+		name = strings.TrimSpace(name)
+
+		factory, ok := middlewareFactories[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown middleware: %s (valid: correlation_id, throttle, poison_queue, retry, recoverer, timeout)", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("middleware %s listed twice", name)
+		}
+		seen[name] = true
+
+		m, err := factory(c, sub)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, m)
+	}
+
+	return chain, nil
+}
+
+// nopClosePublisher keeps the router from closing the shared stream
+// publisher when a handler stops; the consumer closes it once every
+// in-flight message has been published.
+type nopClosePublisher struct {
+	message.Publisher
+}
+
+func (nopClosePublisher) Close() error {
+	return nil
+}
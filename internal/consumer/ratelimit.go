@@ -0,0 +1,157 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/config"
+)
+
+var ErrInvalidRateLimit = errors.New("invalid rate limit")
+
+// rateLimiter is a token bucket holding back a stream's fetch loop. Tokens
+// refill at limit.PerSecond up to limit.Burst, and each message takes one.
+// The limit can be replaced while the stream runs; a fetch loop waiting for
+// a token picks up the new limit straight away.
+type rateLimiter struct {
+	mu      sync.Mutex
+	limit   config.RateLimitConfig
+	tokens  float64
+	last    time.Time
+	changed chan struct{}
+}
+
+func newRateLimiter(limit config.RateLimitConfig) (*rateLimiter, error) {
+	if err := validateRateLimit(limit); err != nil {
+		return nil, err
+	}
+
+	return &rateLimiter{
+		limit:   limit,
+		tokens:  float64(limit.Burst),
+		last:    time.Now(),
+		changed: make(chan struct{}),
+	}, nil
+}
+
+func validateRateLimit(limit config.RateLimitConfig) error {
+	if limit.PerSecond < 0 || math.IsNaN(limit.PerSecond) || math.IsInf(limit.PerSecond, 0) {
+		return fmt.Errorf("%w: per_second must be a non-negative number, got %v", ErrInvalidRateLimit, limit.PerSecond)
+	}
+	if limit.PerSecond > 0 && limit.Burst < 1 {
+		return fmt.Errorf("%w: burst must be at least 1, got %d", ErrInvalidRateLimit, limit.Burst)
+	}
+	return nil
+}
+
+// Limit returns the current limit.
+func (l *rateLimiter) Limit() config.RateLimitConfig {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// SetLimit replaces the limit. Tokens saved up under the old limit are kept
+// up to the new burst; lifting a limit and setting a new one starts from a
+// full bucket.
+func (l *rateLimiter) SetLimit(limit config.RateLimitConfig) error {
+	if err := validateRateLimit(limit); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if l.limit.PerSecond > 0 {
+		l.refill(now)
+	} else {
+		l.tokens = float64(limit.Burst)
+	}
+	l.tokens = math.Min(l.tokens, float64(limit.Burst))
+	l.last = now
+	l.limit = limit
+
+	close(l.changed)
+	l.changed = make(chan struct{})
+	return nil
+}
+
+// Wait blocks until a token is available and takes it, returning how long
+// it was held back; zero means a token was available straight away. It
+// returns ctx.Err() if ctx is cancelled first.
+func (l *rateLimiter) Wait(ctx context.Context) (time.Duration, error) {
+	var start time.Time
+
+	for {
+		l.mu.Lock()
+		if l.limit.PerSecond <= 0 {
+			l.mu.Unlock()
+			return since(start), nil
+		}
+
+		now := time.Now()
+		l.refill(now)
+		if l.tokens >= 1 {
+			l.tokens--
+			l.mu.Unlock()
+			return since(start), nil
+		}
+		if start.IsZero() {
+			start = now
+		}
+
+		delay := time.Duration((1 - l.tokens) / l.limit.PerSecond * float64(time.Second))
+		changed := l.changed
+		l.mu.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-changed:
+			timer.Stop()
+		case <-ctx.Done():
+			timer.Stop()
+			return since(start), ctx.Err()
+		}
+	}
+}
+
+func since(start time.Time) time.Duration {
+	if start.IsZero() {
+		return 0
+	}
+	return time.Since(start)
+}
+
+// refill adds the tokens earned since the last refill. It must be called
+// with mu held.
+func (l *rateLimiter) refill(now time.Time) {
+	elapsed := now.Sub(l.last).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+	l.tokens = math.Min(l.tokens+elapsed*l.limit.PerSecond, float64(l.limit.Burst))
+	l.last = now
+}
+
+// SetStreamRateLimit replaces the rate limit of the named stream while it
+// runs. A zero PerSecond removes the limit.
+func (c *Consumer) SetStreamRateLimit(name string, limit config.RateLimitConfig) (StreamStatus, error) {
+	sub, ok := c.subscriptions[name]
+	if !ok {
+		return StreamStatus{}, ErrStreamNotFound
+	}
+
+	if err := sub.state.limiter.SetLimit(limit); err != nil {
+		return StreamStatus{}, err
+	}
+
+	log.Infof("consumer: set rate limit of stream %s to %v/s (burst %d)", name, limit.PerSecond, limit.Burst)
+	return sub.state.status(name, sub.config.Topic), nil
+}
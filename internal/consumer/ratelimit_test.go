@@ -0,0 +1,182 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/muazwzxv/kafka-consumer-worker/internal/config"
+)
+
+func TestRateLimiterRejectsInvalidLimits(t *testing.T) {
+	limits := []config.RateLimitConfig{
+		{PerSecond: -1, Burst: 1},
+		{PerSecond: math.NaN(), Burst: 1},
+		{PerSecond: math.Inf(1), Burst: 1},
+		{PerSecond: 10, Burst: 0},
+	}
+	for _, limit := range limits {
+		if _, err := newRateLimiter(limit); !errors.Is(err, ErrInvalidRateLimit) {
+			t.Errorf("newRateLimiter(%+v) err = %v, want ErrInvalidRateLimit", limit, err)
+		}
+	}
+
+	l, err := newRateLimiter(config.RateLimitConfig{})
+	if err != nil {
+		t.Fatalf("newRateLimiter: %v", err)
+	}
+	if err := l.SetLimit(config.RateLimitConfig{PerSecond: 5}); !errors.Is(err, ErrInvalidRateLimit) {
+		t.Errorf("SetLimit err = %v, want ErrInvalidRateLimit", err)
+	}
+	if got := l.Limit(); got != (config.RateLimitConfig{}) {
+		t.Errorf("Limit = %+v after a rejected SetLimit, want it unchanged", got)
+	}
+}
+
+func TestRateLimiterUnlimited(t *testing.T) {
+	l, err := newRateLimiter(config.RateLimitConfig{})
+	if err != nil {
+		t.Fatalf("newRateLimiter: %v", err)
+	}
+
+	for range 1000 {
+		if waited, err := l.Wait(context.Background()); err != nil || waited != 0 {
+			t.Fatalf("Wait = %s, %v; want no wait", waited, err)
+		}
+	}
+}
+
+func TestRateLimiterSpendsBurstThenWaits(t *testing.T) {
+	l, err := newRateLimiter(config.RateLimitConfig{PerSecond: 20, Burst: 3})
+	if err != nil {
+		t.Fatalf("newRateLimiter: %v", err)
+	}
+
+	for i := range 3 {
+		if waited, err := l.Wait(context.Background()); err != nil || waited != 0 {
+			t.Fatalf("Wait %d = %s, %v; want a token from the burst", i, waited, err)
+		}
+	}
+
+	// The next token takes 1/20s to refill.
+	waited, err := l.Wait(context.Background())
+	if err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if waited < 30*time.Millisecond {
+		t.Errorf("Wait = %s with the bucket empty, want about 50ms", waited)
+	}
+}
+
+func TestRateLimiterWaitHonoursContext(t *testing.T) {
+	l, err := newRateLimiter(config.RateLimitConfig{PerSecond: 0.1, Burst: 1})
+	if err != nil {
+		t.Fatalf("newRateLimiter: %v", err)
+	}
+	if _, err := l.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := l.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Wait err = %v, want DeadlineExceeded", err)
+	}
+}
+
+func TestRateLimiterSetLimitWakesWaiters(t *testing.T) {
+	l, err := newRateLimiter(config.RateLimitConfig{PerSecond: 0.1, Burst: 1})
+	if err != nil {
+		t.Fatalf("newRateLimiter: %v", err)
+	}
+	if _, err := l.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := l.Wait(context.Background())
+		done <- err
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	if err := l.SetLimit(config.RateLimitConfig{}); err != nil {
+		t.Fatalf("SetLimit: %v", err)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Wait: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Wait still blocked after the limit was lifted")
+	}
+}
+
+func TestRateLimiterSetLimitCapsSavedTokens(t *testing.T) {
+	l, err := newRateLimiter(config.RateLimitConfig{PerSecond: 1, Burst: 10})
+	if err != nil {
+		t.Fatalf("newRateLimiter: %v", err)
+	}
+	if err := l.SetLimit(config.RateLimitConfig{PerSecond: 0.1, Burst: 2}); err != nil {
+		t.Fatalf("SetLimit: %v", err)
+	}
+
+	for range 2 {
+		if waited, err := l.Wait(context.Background()); err != nil || waited != 0 {
+			t.Fatalf("Wait = %s, %v; want a saved token", waited, err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := l.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Wait err = %v, want the bucket capped at the new burst", err)
+	}
+}
+
+func TestThroughputMeterRate(t *testing.T) {
+	var m throughputMeter
+	now := time.Unix(1_700_000_000, 0)
+
+	// 5 messages a second for the last 10 full seconds.
+	for age := 1; age <= 10; age++ {
+		for range 5 {
+			m.record(now.Add(-time.Duration(age) * time.Second))
+		}
+	}
+	// The current second is left out.
+	for range 100 {
+		m.record(now)
+	}
+
+	if got := m.rate(now); got != 5 {
+		t.Errorf("rate = %v, want 5", got)
+	}
+}
+
+func TestThroughputMeterForgetsOldSeconds(t *testing.T) {
+	var m throughputMeter
+	now := time.Unix(1_700_000_000, 0)
+
+	for range 50 {
+		m.record(now.Add(-2 * time.Second))
+	}
+	if got := m.rate(now); got != 5 {
+		t.Fatalf("rate = %v, want 5", got)
+	}
+
+	later := now.Add(throughputWindow + time.Second)
+	if got := m.rate(later); got != 0 {
+		t.Errorf("rate = %v once the window has passed, want 0", got)
+	}
+
+	// A bucket reused for a new second starts from zero.
+	m.record(later.Add(-time.Second))
+	if got := m.rate(later); got != 0.1 {
+		t.Errorf("rate = %v, want 0.1", got)
+	}
+}
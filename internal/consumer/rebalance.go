@@ -0,0 +1,191 @@
+package consumer
+
+import (
+	"context"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/gofiber/fiber/v2/log"
+)
+
+// rebalanceHooks wraps the consumer group handler of every topic the Kafka
+// subscriber consumes. The subscriber offers no rebalance callbacks of its
+// own, so the hooks are passed in as its tracer, which is the one place it
+// hands out the group handler; the other tracer methods pass through.
+// Sessions are always tracked for health and messages always pass their
+// topic's gate; logging and flushing on rebalance only run when enabled.
+type rebalanceHooks struct {
+	group    string
+	sessions *groupSessions
+	enabled  bool
+	// gates holds back each topic's messages until its stream takes them.
+	gates map[string]claimGate
+}
+
+// claimGate blocks until msg may be handed to the Kafka subscriber. It
+// returns ctx.Err() if the group session ends first.
+type claimGate func(ctx context.Context, msg *sarama.ConsumerMessage) error
+
+func (rebalanceHooks) WrapConsumer(c sarama.Consumer) sarama.Consumer {
+	return c
+}
+
+func (rebalanceHooks) WrapPartitionConsumer(pc sarama.PartitionConsumer) sarama.PartitionConsumer {
+	return pc
+}
+
+func (rebalanceHooks) WrapSyncProducer(_ *sarama.Config, p sarama.SyncProducer) sarama.SyncProducer {
+	return p
+}
+
+func (r rebalanceHooks) WrapConsumerGroupHandler(h sarama.ConsumerGroupHandler) sarama.ConsumerGroupHandler {
+	return &rebalanceHandler{
+		ConsumerGroupHandler: h,
+		group:                r.group,
+		sessions:             r.sessions,
+		enabled:              r.enabled,
+		gates:                r.gates,
+	}
+}
+
+// rebalanceHandler gates each claim's messages, logs each group session's
+// assignment and revocation and flushes in-flight messages before a
+// partition is given up.
+//
+// The Kafka subscriber waits for each message it hands out to be acked or
+// nacked, whatever the session, so a message must only reach it once its
+// stream will take it. Messages wait at their topic's gate first, and one
+// still waiting when the session ends is dropped unmarked for the
+// partition's next owner, so a rebalance never waits on a paused stream.
+//
+// When a rebalance starts, sarama cancels the session and waits for every
+// ConsumeClaim to return before committing offsets and leaving. The Kafka
+// subscriber checks the session context before marking an acked message,
+// so a message finishing after the cancel would be processed here and
+// again by the partition's next owner. When enabled, rebalanceHandler
+// gives the subscriber a session context that stays open until its
+// ConsumeClaim has returned: no new messages are handed over once the
+// rebalance starts, but the one in flight finishes and its offset is
+// committed with the rest.
+type rebalanceHandler struct {
+	sarama.ConsumerGroupHandler
+	group    string
+	sessions *groupSessions
+	enabled  bool
+	gates    map[string]claimGate
+}
+
+func (h *rebalanceHandler) Setup(sess sarama.ConsumerGroupSession) error {
+	h.sessions.setup()
+	if !h.enabled {
+		return h.ConsumerGroupHandler.Setup(sess)
+	}
+
+	log.Infow("consumer: partitions assigned",
+		"group", h.group,
+		"member_id", sess.MemberID(),
+		"generation", sess.GenerationID(),
+		"partitions", sess.Claims())
+	return h.ConsumerGroupHandler.Setup(sess)
+}
+
+func (h *rebalanceHandler) Cleanup(sess sarama.ConsumerGroupSession) error {
+	h.sessions.cleanup()
+	if !h.enabled {
+		return h.ConsumerGroupHandler.Cleanup(sess)
+	}
+
+	log.Infow("consumer: partitions revoked",
+		"group", h.group,
+		"member_id", sess.MemberID(),
+		"generation", sess.GenerationID(),
+		"partitions", sess.Claims())
+	return h.ConsumerGroupHandler.Cleanup(sess)
+}
+
+func (h *rebalanceHandler) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	// claimCtx ends once this claim has returned, so the goroutine feeding
+	// it stops with it.
+	claimCtx, cancel := context.WithCancel(context.WithoutCancel(sess.Context()))
+	defer cancel()
+	gateCtx, cancelGate := context.WithCancel(sess.Context())
+	defer cancelGate()
+	gate := h.gates[claim.Topic()]
+
+	messages := make(chan *sarama.ConsumerMessage)
+	revokedAt := make(chan time.Time, 1)
+	go func() {
+		defer close(messages)
+		for {
+			select {
+			case <-sess.Context().Done():
+				revokedAt <- time.Now()
+				return
+			case <-claimCtx.Done():
+				return
+			case msg, ok := <-claim.Messages():
+				if !ok {
+					return
+				}
+				if gate != nil {
+					if err := gate(gateCtx, msg); err != nil {
+						// Not handed over, so the next owner consumes it.
+						if sess.Context().Err() != nil {
+							revokedAt <- time.Now()
+						}
+						return
+					}
+				}
+				select {
+				case messages <- msg:
+				case <-sess.Context().Done():
+					revokedAt <- time.Now()
+					return
+				case <-claimCtx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	var session sarama.ConsumerGroupSession = sess
+	if h.enabled {
+		session = flushingSession{ConsumerGroupSession: sess, ctx: claimCtx}
+	}
+	err := h.ConsumerGroupHandler.ConsumeClaim(session, flushingClaim{ConsumerGroupClaim: claim, messages: messages})
+
+	select {
+	case at := <-revokedAt:
+		if h.enabled {
+			log.Infow("consumer: flushed in-flight messages before revocation",
+				"group", h.group,
+				"topic", claim.Topic(),
+				"partition", claim.Partition(),
+				"took", time.Since(at))
+		}
+	default:
+	}
+	return err
+}
+
+// flushingSession is a group session whose context ends only once the
+// claim it was handed to has finished.
+type flushingSession struct {
+	sarama.ConsumerGroupSession
+	ctx context.Context
+}
+
+func (s flushingSession) Context() context.Context {
+	return s.ctx
+}
+
+// flushingClaim is a claim whose messages pass their gate and stop when
+// the rebalance starts.
+type flushingClaim struct {
+	sarama.ConsumerGroupClaim
+	messages chan *sarama.ConsumerMessage
+}
+
+func (c flushingClaim) Messages() <-chan *sarama.ConsumerMessage {
+	return c.messages
+}
@@ -0,0 +1,174 @@
+package consumer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/config"
+)
+
+type testSession struct {
+	sarama.ConsumerGroupSession
+	ctx context.Context
+}
+
+func (s testSession) Context() context.Context {
+	return s.ctx
+}
+
+type testClaim struct {
+	sarama.ConsumerGroupClaim
+	messages chan *sarama.ConsumerMessage
+}
+
+func (c testClaim) Topic() string {
+	return "orders"
+}
+
+func (c testClaim) Partition() int32 {
+	return 0
+}
+
+func (c testClaim) Messages() <-chan *sarama.ConsumerMessage {
+	return c.messages
+}
+
+// recordingHandler stands in for the Kafka subscriber's group handler.
+type recordingHandler struct {
+	sarama.ConsumerGroupHandler
+	received chan *sarama.ConsumerMessage
+}
+
+func (h recordingHandler) ConsumeClaim(_ sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for msg := range claim.Messages() {
+		h.received <- msg
+	}
+	return nil
+}
+
+func newGatedHandler(t *testing.T, enabled bool) (*rebalanceHandler, *subscription, chan *sarama.ConsumerMessage) {
+	t.Helper()
+
+	state, err := newStreamState(config.RateLimitConfig{})
+	if err != nil {
+		t.Fatalf("newStreamState: %v", err)
+	}
+	sub := &subscription{name: "orders", state: state}
+	received := make(chan *sarama.ConsumerMessage, 1)
+
+	hooks := rebalanceHooks{
+		group:    "workers",
+		sessions: &groupSessions{},
+		enabled:  enabled,
+		gates:    map[string]claimGate{"orders": sub.admit},
+	}
+	return hooks.WrapConsumerGroupHandler(recordingHandler{received: received}).(*rebalanceHandler), sub, received
+}
+
+func TestRebalanceHandlerHoldsPausedStreamOutsideSubscriber(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		h, sub, received := newGatedHandler(t, enabled)
+		sub.state.pause()
+
+		sessCtx, endSession := context.WithCancel(context.Background())
+		claim := testClaim{messages: make(chan *sarama.ConsumerMessage, 1)}
+		claim.messages <- &sarama.ConsumerMessage{Topic: "orders", Offset: 7}
+
+		done := make(chan error, 1)
+		go func() { done <- h.ConsumeClaim(testSession{ctx: sessCtx}, claim) }()
+
+		select {
+		case <-received:
+			t.Fatalf("enabled=%v: message of a paused stream handed to the subscriber", enabled)
+		case <-time.After(20 * time.Millisecond):
+		}
+
+		// A rebalance ends the session: the held message is given up.
+		endSession()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("enabled=%v: ConsumeClaim: %v", enabled, err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("enabled=%v: ConsumeClaim still blocked after the session ended", enabled)
+		}
+		if len(received) != 0 {
+			t.Errorf("enabled=%v: held message handed over after the session ended", enabled)
+		}
+	}
+}
+
+func TestRebalanceHandlerReleasesOnResume(t *testing.T) {
+	h, sub, received := newGatedHandler(t, true)
+	sub.state.pause()
+
+	sessCtx, endSession := context.WithCancel(context.Background())
+	defer endSession()
+	claim := testClaim{messages: make(chan *sarama.ConsumerMessage, 1)}
+	claim.messages <- &sarama.ConsumerMessage{Topic: "orders", Offset: 7}
+
+	go func() { _ = h.ConsumeClaim(testSession{ctx: sessCtx}, claim) }()
+
+	time.Sleep(10 * time.Millisecond)
+	sub.state.resume()
+
+	select {
+	case msg := <-received:
+		if msg.Offset != 7 {
+			t.Errorf("offset = %d, want 7", msg.Offset)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("message not handed over after the stream resumed")
+	}
+}
+
+func TestRebalanceHandlerReleasesRetryHoldWhenSessionEnds(t *testing.T) {
+	h, sub, received := newGatedHandler(t, true)
+	h.gates["orders"] = sub.admitWhenDue
+
+	sessCtx, endSession := context.WithCancel(context.Background())
+	claim := testClaim{messages: make(chan *sarama.ConsumerMessage, 1)}
+	claim.messages <- &sarama.ConsumerMessage{Topic: "orders", Headers: []*sarama.RecordHeader{{
+		Key:   []byte(RetryNotBeforeKey),
+		Value: []byte(time.Now().Add(10 * time.Minute).Format(time.RFC3339Nano)),
+	}}}
+
+	done := make(chan error, 1)
+	go func() { done <- h.ConsumeClaim(testSession{ctx: sessCtx}, claim) }()
+
+	time.Sleep(10 * time.Millisecond)
+	endSession()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("ConsumeClaim still holding a retry message after the session ended")
+	}
+	if len(received) != 0 {
+		t.Error("retry message handed over before it was due")
+	}
+}
+
+func TestRebalanceHandlerHandsOverDueRetry(t *testing.T) {
+	h, sub, received := newGatedHandler(t, false)
+	h.gates["orders"] = sub.admitWhenDue
+
+	sessCtx, endSession := context.WithCancel(context.Background())
+	defer endSession()
+	claim := testClaim{messages: make(chan *sarama.ConsumerMessage, 1)}
+	claim.messages <- &sarama.ConsumerMessage{Topic: "orders", Headers: []*sarama.RecordHeader{{
+		Key:   []byte(RetryNotBeforeKey),
+		Value: []byte(time.Now().Add(20 * time.Millisecond).Format(time.RFC3339Nano)),
+	}}}
+
+	go func() { _ = h.ConsumeClaim(testSession{ctx: sessCtx}, claim) }()
+
+	select {
+	case <-received:
+	case <-time.After(time.Second):
+		t.Fatal("retry message not handed over once due")
+	}
+}
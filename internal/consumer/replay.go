@@ -0,0 +1,530 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/ThreeDotsLabs/watermill-kafka/v3/pkg/kafka"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/config"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/consumer/streamHandler"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/database"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/kafkaclient"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/repository"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/schema"
+	"github.com/samber/do/v2"
+)
+
+const (
+	replayProgressInterval = 5 * time.Second
+	// replayIdleTimeout ends a partition whose remaining offsets never
+	// arrive, such as transaction markers or compacted records at the end
+	// of the range.
+	replayIdleTimeout = 10 * time.Second
+	// replayMaxFailures caps the failures kept for the summary.
+	replayMaxFailures = 50
+)
+
+// ReplayPosition is one end of a replay range: an offset, applied to every
+// partition, or a timestamp, resolved per partition to the first message at
+// or after it. The zero value is the start or end of the partition.
+type ReplayPosition struct {
+	Offset int64
+	Time   time.Time
+	set    bool
+}
+
+// ParseReplayPosition parses an offset or an RFC 3339 timestamp. An empty
+// string is the zero position.
+func ParseReplayPosition(s string) (ReplayPosition, error) {
+	if s == "" {
+		return ReplayPosition{}, nil
+	}
+	if offset, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if offset < 0 {
+			return ReplayPosition{}, fmt.Errorf("offset %d is negative", offset)
+		}
+		return ReplayPosition{Offset: offset, set: true}, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return ReplayPosition{}, fmt.Errorf("%q is neither an offset nor an RFC 3339 timestamp", s)
+	}
+	return ReplayPosition{Time: t, set: true}, nil
+}
+
+func (p ReplayPosition) String() string {
+	switch {
+	case !p.set:
+		return ""
+	case !p.Time.IsZero():
+		return p.Time.Format(time.RFC3339)
+	default:
+		return strconv.FormatInt(p.Offset, 10)
+	}
+}
+
+// ReplayOptions selects what Replay reprocesses.
+type ReplayOptions struct {
+	Stream string
+	// From is the first position replayed; To is exclusive and defaults to
+	// each partition's high-water mark when the replay starts.
+	From ReplayPosition
+	To   ReplayPosition
+	// Partitions limits the replay to these partitions; empty means all.
+	Partitions []int32
+	// DryRun reads and counts the range without running the handler or
+	// committing offsets.
+	DryRun bool
+	// Group is the consumer group replay progress is committed under. It
+	// must differ from the live consumer group.
+	Group string
+	// Progress receives a progress line every few seconds; nil disables it.
+	Progress io.Writer
+}
+
+// PartitionReplay is the range replayed on one partition.
+type PartitionReplay struct {
+	Partition int32
+	// StartOffset is inclusive and EndOffset exclusive.
+	StartOffset int64
+	EndOffset   int64
+	Read        int64
+	Succeeded   int64
+	Failed      int64
+}
+
+// ReplayFailure describes a message the handler failed to reprocess.
+type ReplayFailure struct {
+	Partition int32
+	Offset    int64
+	UUID      string
+	Error     string
+}
+
+// ReplaySummary is the outcome of a replay.
+type ReplaySummary struct {
+	Stream     string
+	Topic      string
+	Group      string
+	DryRun     bool
+	Partitions []PartitionReplay
+	Read       int64
+	Succeeded  int64
+	Failed     int64
+	// Failures holds the first replayMaxFailures failures.
+	Failures []ReplayFailure
+	Duration time.Duration
+}
+
+// Replay runs a stream's registered handler over a range of its topic. It
+// reads with a plain partition consumer, so the live consumer group is never
+// joined, and commits its progress under opts.Group. Deduplication is
+// skipped so already processed messages run again, and failed messages are
+// reported in the summary instead of being dead-lettered. Produced messages
+// of producing handlers are not published.
+//
+// Replay resolves the stream's handler from the injector the same way Init
+// does, so the same dependencies must be provided.
+func Replay(ctx context.Context, i do.Injector, opts ReplayOptions) (ReplaySummary, error) {
+	cfg := do.MustInvoke[*config.Config](i)
+
+	streamCfg, ok := cfg.Streams[opts.Stream]
+	if !ok {
+		return ReplaySummary{}, fmt.Errorf("%w: %s", ErrStreamNotFound, opts.Stream)
+	}
+	if streamCfg.Topic == "" {
+		return ReplaySummary{}, fmt.Errorf("stream %s: topic is required", opts.Stream)
+	}
+	if opts.Group == "" {
+		opts.Group = cfg.Kafka.ConsumerGroup + "-replay"
+	}
+	if opts.Group == cfg.Kafka.ConsumerGroup {
+		return ReplaySummary{}, fmt.Errorf("replay group must differ from the live consumer group %s", opts.Group)
+	}
+
+	r := &replayer{
+		opts:  opts,
+		topic: streamCfg.Topic,
+		summary: ReplaySummary{
+			Stream: opts.Stream,
+			Topic:  streamCfg.Topic,
+			Group:  opts.Group,
+			DryRun: opts.DryRun,
+		},
+	}
+
+	if !opts.DryRun {
+		handle, err := replayHandler(i, opts.Stream, streamCfg)
+		if err != nil {
+			return ReplaySummary{}, err
+		}
+		r.handle = handle
+		if r.limiter, err = newRateLimiter(streamCfg.RateLimit); err != nil {
+			return ReplaySummary{}, fmt.Errorf("stream %s: %w", opts.Stream, err)
+		}
+	}
+
+	saramaConfig, err := kafkaclient.SubscriberConfig(cfg.Kafka)
+	if err != nil {
+		return ReplaySummary{}, err
+	}
+
+	client, err := sarama.NewClient(cfg.Kafka.BrokerAddrs(), saramaConfig)
+	if err != nil {
+		return ReplaySummary{}, fmt.Errorf("create kafka client: %w", err)
+	}
+	defer client.Close()
+
+	ranges, err := r.resolveRanges(client)
+	if err != nil {
+		return ReplaySummary{}, err
+	}
+	r.summary.Partitions = ranges
+
+	started := time.Now()
+	err = r.run(ctx, client, streamCfg.Concurrency)
+	r.summary.Duration = time.Since(started)
+
+	return r.summary, err
+}
+
+// replayHandler builds the stream's handler wrapped in its retry policy.
+func replayHandler(i do.Injector, name string, cfg config.StreamConfig) (message.HandlerFunc, error) {
+	handlerName := cfg.Handler
+	if handlerName == "" {
+		handlerName = name
+	}
+	factory, ok := streamHandler.Lookup(handlerName)
+	if !ok {
+		return nil, fmt.Errorf("stream %s: unknown handler %q", name, handlerName)
+	}
+
+	handler, err := factory(i, name, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("stream %s: build %s handler: %w", name, handlerName, err)
+	}
+
+	cfg.Idempotency.Enable = false
+	sub, err := newSubscription(name, handler, cfg, subscriptionDeps{
+		processed: do.MustInvoke[repository.ProcessedMessageRepository](i),
+		tx:        do.MustInvoke[*database.Database](i),
+		schemas:   do.MustInvoke[*schema.Registry](i),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	h := sub.isolateHandler(func(msg *message.Message) ([]*message.Message, error) {
+		return nil, sub.handler.Handle(msg.Context(), msg)
+	})
+	if sub.schema != nil {
+		h = sub.validateSchema(h)
+	}
+	return sub.retry.middleware()(countAttempts(h)), nil
+}
+
+type replayer struct {
+	opts    ReplayOptions
+	topic   string
+	handle  message.HandlerFunc
+	limiter *rateLimiter
+
+	mu      sync.Mutex
+	summary ReplaySummary
+}
+
+// resolveRanges turns the replay positions into an offset range on every
+// selected partition.
+func (r *replayer) resolveRanges(client sarama.Client) ([]PartitionReplay, error) {
+	partitions, err := client.Partitions(r.topic)
+	if err != nil {
+		return nil, fmt.Errorf("list partitions of %s: %w", r.topic, err)
+	}
+
+	if len(r.opts.Partitions) > 0 {
+		known := make(map[int32]bool, len(partitions))
+		for _, p := range partitions {
+			known[p] = true
+		}
+		for _, p := range r.opts.Partitions {
+			if !known[p] {
+				return nil, fmt.Errorf("topic %s has no partition %d", r.topic, p)
+			}
+		}
+		partitions = r.opts.Partitions
+	}
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i] < partitions[j] })
+
+	ranges := make([]PartitionReplay, 0, len(partitions))
+	for _, partition := range partitions {
+		oldest, err := client.GetOffset(r.topic, partition, sarama.OffsetOldest)
+		if err != nil {
+			return nil, fmt.Errorf("get oldest offset of %s/%d: %w", r.topic, partition, err)
+		}
+		newest, err := client.GetOffset(r.topic, partition, sarama.OffsetNewest)
+		if err != nil {
+			return nil, fmt.Errorf("get high-water mark of %s/%d: %w", r.topic, partition, err)
+		}
+
+		start, err := r.resolve(client, partition, r.opts.From, oldest, newest)
+		if err != nil {
+			return nil, err
+		}
+		end, err := r.resolve(client, partition, r.opts.To, newest, newest)
+		if err != nil {
+			return nil, err
+		}
+		start = max(start, oldest)
+		end = min(end, newest)
+		if end < start {
+			end = start
+		}
+
+		ranges = append(ranges, PartitionReplay{
+			Partition:   partition,
+			StartOffset: start,
+			EndOffset:   end,
+		})
+	}
+
+	return ranges, nil
+}
+
+func (r *replayer) resolve(
+	client sarama.Client,
+	partition int32,
+	pos ReplayPosition,
+	unset int64,
+	newest int64,
+) (int64, error) {
+	switch {
+	case !pos.set:
+		return unset, nil
+	case pos.Time.IsZero():
+		return pos.Offset, nil
+	}
+
+	offset, err := client.GetOffset(r.topic, partition, pos.Time.UnixMilli())
+	if err != nil {
+		return 0, fmt.Errorf("find offset of %s/%d at %s: %w", r.topic, partition, pos, err)
+	}
+	if offset < 0 {
+		// No message at or after the timestamp.
+		return newest, nil
+	}
+	return offset, nil
+}
+
+// run replays every partition range, up to concurrency partitions at a time.
+func (r *replayer) run(ctx context.Context, client sarama.Client, concurrency int) error {
+	consumer, err := sarama.NewConsumerFromClient(client)
+	if err != nil {
+		return fmt.Errorf("create kafka consumer: %w", err)
+	}
+	defer consumer.Close()
+
+	var offsets sarama.OffsetManager
+	if !r.opts.DryRun {
+		offsets, err = sarama.NewOffsetManagerFromClient(r.opts.Group, client)
+		if err != nil {
+			return fmt.Errorf("create offset manager for group %s: %w", r.opts.Group, err)
+		}
+		defer offsets.Close()
+	}
+
+	stopProgress := r.reportProgress()
+	defer stopProgress()
+
+	sem := make(chan struct{}, max(concurrency, 1))
+	errs := make([]error, len(r.summary.Partitions))
+	var wg sync.WaitGroup
+
+	for idx := range r.summary.Partitions {
+		if r.summary.Partitions[idx].StartOffset >= r.summary.Partitions[idx].EndOffset {
+			continue
+		}
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return ctx.Err()
+		}
+
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			errs[idx] = r.replayPartition(ctx, consumer, offsets, idx)
+		}(idx)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+func (r *replayer) replayPartition(
+	ctx context.Context,
+	consumer sarama.Consumer,
+	offsets sarama.OffsetManager,
+	idx int,
+) error {
+	r.mu.Lock()
+	partition := r.summary.Partitions[idx]
+	r.mu.Unlock()
+
+	pc, err := consumer.ConsumePartition(r.topic, partition.Partition, partition.StartOffset)
+	if err != nil {
+		return fmt.Errorf("consume %s/%d from offset %d: %w", r.topic, partition.Partition, partition.StartOffset, err)
+	}
+	defer pc.Close()
+
+	var pom sarama.PartitionOffsetManager
+	if offsets != nil {
+		pom, err = offsets.ManagePartition(r.topic, partition.Partition)
+		if err != nil {
+			return fmt.Errorf("manage offsets of %s/%d: %w", r.topic, partition.Partition, err)
+		}
+		defer pom.Close()
+	}
+
+	idle := time.NewTimer(replayIdleTimeout)
+	defer idle.Stop()
+
+	next := partition.StartOffset
+	for next < partition.EndOffset {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-pc.Errors():
+			return fmt.Errorf("consume %s/%d: %w", r.topic, partition.Partition, err)
+		case <-idle.C:
+			if pc.HighWaterMarkOffset() <= next {
+				return nil
+			}
+			idle.Reset(replayIdleTimeout)
+		case kafkaMsg := <-pc.Messages():
+			if kafkaMsg.Offset >= partition.EndOffset {
+				return nil
+			}
+			if err := r.process(ctx, idx, kafkaMsg); err != nil {
+				return err
+			}
+			next = kafkaMsg.Offset + 1
+			if pom != nil {
+				pom.MarkOffset(next, "")
+			}
+			idle.Reset(replayIdleTimeout)
+		}
+	}
+
+	return nil
+}
+
+// process runs the handler on one message and records the outcome. It only
+// returns an error if the replay itself should stop.
+func (r *replayer) process(ctx context.Context, idx int, kafkaMsg *sarama.ConsumerMessage) error {
+	var handleErr error
+	if r.handle != nil {
+		if _, err := r.limiter.Wait(ctx); err != nil {
+			return err
+		}
+
+		msg, err := unmarshaler{}.Unmarshal(kafkaMsg)
+		if err != nil {
+			handleErr = fmt.Errorf("unmarshal message: %w", err)
+		} else {
+			msg.SetContext(ctx)
+			_, handleErr = r.handle(msg)
+		}
+		if errors.Is(handleErr, context.Canceled) && ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	partition := &r.summary.Partitions[idx]
+	partition.Read++
+	r.summary.Read++
+
+	if r.handle == nil {
+		return nil
+	}
+
+	if handleErr == nil {
+		partition.Succeeded++
+		r.summary.Succeeded++
+		return nil
+	}
+
+	partition.Failed++
+	r.summary.Failed++
+	if len(r.summary.Failures) < replayMaxFailures {
+		r.summary.Failures = append(r.summary.Failures, ReplayFailure{
+			Partition: kafkaMsg.Partition,
+			Offset:    kafkaMsg.Offset,
+			UUID:      string(headerValue(kafkaMsg, kafka.UUIDHeaderKey)),
+			Error:     handleErr.Error(),
+		})
+	}
+	return nil
+}
+
+// reportProgress writes the number of messages read so far every
+// replayProgressInterval until the returned func is called.
+func (r *replayer) reportProgress() func() {
+	if r.opts.Progress == nil {
+		return func() {}
+	}
+
+	var total int64
+	for _, p := range r.summary.Partitions {
+		total += p.EndOffset - p.StartOffset
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(replayProgressInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				r.mu.Lock()
+				read, succeeded, failed := r.summary.Read, r.summary.Succeeded, r.summary.Failed
+				r.mu.Unlock()
+				fmt.Fprintf(r.opts.Progress, "replay %s: read %d/%d (succeeded %d, failed %d)\n",
+					r.opts.Stream, read, total, succeeded, failed)
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+func headerValue(msg *sarama.ConsumerMessage, key string) []byte {
+	for _, header := range msg.Headers {
+		if header != nil && string(header.Key) == key {
+			return header.Value
+		}
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package consumer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseReplayPosition(t *testing.T) {
+	tests := []struct {
+		in   string
+		want ReplayPosition
+	}{
+		{"", ReplayPosition{}},
+		{"0", ReplayPosition{Offset: 0, set: true}},
+		{"1500", ReplayPosition{Offset: 1500, set: true}},
+		{"2026-03-01T12:30:00Z", ReplayPosition{Time: time.Date(2026, 3, 1, 12, 30, 0, 0, time.UTC), set: true}},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseReplayPosition(tt.in)
+		if err != nil {
+			t.Errorf("ParseReplayPosition(%q): %v", tt.in, err)
+			continue
+		}
+		if got.Offset != tt.want.Offset || !got.Time.Equal(tt.want.Time) || got.set != tt.want.set {
+			t.Errorf("ParseReplayPosition(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+		if got.String() != tt.in {
+			t.Errorf("ParseReplayPosition(%q).String() = %q, want it back", tt.in, got.String())
+		}
+	}
+}
+
+func TestParseReplayPositionKeepsTimeZone(t *testing.T) {
+	got, err := ParseReplayPosition("2026-03-01T20:30:00+08:00")
+	if err != nil {
+		t.Fatalf("ParseReplayPosition: %v", err)
+	}
+	if want := time.Date(2026, 3, 1, 12, 30, 0, 0, time.UTC); !got.Time.Equal(want) {
+		t.Errorf("Time = %s, want %s", got.Time, want)
+	}
+}
+
+func TestParseReplayPositionRejectsInvalid(t *testing.T) {
+	for _, in := range []string{"-1", "yesterday", "2026-03-01", "12.5", "2026-03-01 12:30:00"} {
+		if _, err := ParseReplayPosition(in); err == nil {
+			t.Errorf("ParseReplayPosition(%q) succeeded, want an error", in)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package consumer
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/config"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/consumer/streamHandler"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/database"
+)
+
+const (
+	defaultRetryInitialInterval = 200 * time.Millisecond
+	defaultRetryMultiplier      = 2.0
+	defaultRetryMaxInterval     = 5 * time.Second
+	defaultRetryClassifier      = "transient"
+)
+
+// errorClassifiers decide whether an error returned by a handler is retried.
+var errorClassifiers = map[string]func(error) bool{
+	"transient": database.IsTransientError,
+	"all":       func(error) bool { return true },
+	"none":      func(error) bool { return false },
+}
+
+type retryPolicy struct {
+	maxAttempts     int
+	initialInterval time.Duration
+	multiplier      float64
+	maxInterval     time.Duration
+	jitter          float64
+	isRetryable     func(error) bool
+}
+
+func newRetryPolicy(cfg config.RetryConfig) (*retryPolicy, error) {
+	policy := &retryPolicy{
+		maxAttempts:     cfg.MaxAttempts,
+		initialInterval: cfg.InitialInterval,
+		multiplier:      cfg.Multiplier,
+		maxInterval:     cfg.MaxInterval,
+		jitter:          cfg.Jitter,
+	}
+
+	if policy.maxAttempts < 1 {
+		policy.maxAttempts = 1
+	}
+	if policy.initialInterval <= 0 {
+		policy.initialInterval = defaultRetryInitialInterval
+	}
+	if policy.multiplier < 1 {
+		policy.multiplier = defaultRetryMultiplier
+	}
+	if policy.maxInterval <= 0 {
+		policy.maxInterval = defaultRetryMaxInterval
+	}
+	if policy.jitter < 0 || policy.jitter > 1 {
+		return nil, fmt.Errorf("retry jitter must be between 0 and 1, got %v", policy.jitter)
+	}
+
+	classifier := cfg.Classifier
+	if classifier == "" {
+		classifier = defaultRetryClassifier
+	}
+	isRetryable, ok := errorClassifiers[classifier]
+	if !ok {
+		return nil, fmt.Errorf("unknown retry classifier: %s (valid: transient, all, none)", classifier)
+	}
+	policy.isRetryable = isRetryable
+
+	return policy, nil
+}
+
+// middleware returns Watermill's retry middleware configured from the
+// policy. Each attempt starts from the message's original context.
+func (p *retryPolicy) middleware() message.HandlerMiddleware {
+	return middleware.Retry{
+		MaxRetries:          p.maxAttempts - 1,
+		InitialInterval:     p.initialInterval,
+		MaxInterval:         p.maxInterval,
+		Multiplier:          p.multiplier,
+		RandomizationFactor: p.jitter,
+		ShouldRetry: func(params middleware.RetryParams) bool {
+			attempt := params.RetryNum + 1
+			if attempt >= p.maxAttempts || !p.shouldRetry(params.Err) {
+				return false
+			}
+			log.Warnf("consumer: attempt %d/%d failed, retrying in %s: %v",
+				attempt, p.maxAttempts, params.Delay, params.Err)
+			return true
+		},
+		ResetContextOnRetry: true,
+	}.Middleware
+}
+
+// shouldRetry honours the handler's own classification before falling back
+// to the configured classifier.
+func (p *retryPolicy) shouldRetry(err error) bool {
+	switch {
+	case streamHandler.IsPermanent(err):
+		return false
+	case streamHandler.IsTransient(err):
+		return true
+	default:
+		return p.isRetryable(err)
+	}
+}
+
+// countAttempts records the 1-based attempt number in the message metadata
+// under streamHandler.AttemptKey. It sits directly around the handler so
+// every retry is counted.
+func countAttempts(h message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		attempt, _ := strconv.Atoi(msg.Metadata.Get(streamHandler.AttemptKey))
+		msg.Metadata.Set(streamHandler.AttemptKey, strconv.Itoa(attempt+1))
+		return h(msg)
+	}
+}
@@ -0,0 +1,171 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/config"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/consumer/streamHandler"
+)
+
+// Metadata keys of messages moved to a retry topic.
+const (
+	// RetryNotBeforeKey holds the RFC 3339 time before which the message
+	// is not handed to the handler.
+	RetryNotBeforeKey   = "retry_not_before"
+	RetrySourceTopicKey = "retry_source_topic"
+	// RetryTierKey is the 1-based tier the message was moved to.
+	RetryTierKey   = "retry_tier"
+	RetryErrorKey  = "retry_error"
+	RetryFailedKey = "retry_failed_at"
+)
+
+// retryScheduledKey marks a consumed message that was moved to a retry tier
+// rather than processed, for the stream's status counters.
+const retryScheduledKey = "_retry_scheduled"
+
+// retryTier is one delayed retry topic of a stream.
+type retryTier struct {
+	topic string
+	delay time.Duration
+}
+
+func newRetryTiers(topic string, cfg config.RetryTopicsConfig) ([]retryTier, error) {
+	if len(cfg.Delays) == 0 {
+		return nil, errors.New("retry_topics requires at least one delay")
+	}
+
+	tiers := make([]retryTier, 0, len(cfg.Delays))
+	seen := make(map[string]bool, len(cfg.Delays))
+	for _, delay := range cfg.Delays {
+		if delay <= 0 {
+			return nil, fmt.Errorf("retry_topics delay must be positive, got %s", delay)
+		}
+		tier := retryTier{topic: retryTierTopic(topic, delay), delay: delay}
+		if seen[tier.topic] {
+			return nil, fmt.Errorf("retry_topics delay %s listed twice", delay)
+		}
+		seen[tier.topic] = true
+		tiers = append(tiers, tier)
+	}
+
+	return tiers, nil
+}
+
+// retryTierTopic names the retry topic of a tier, e.g. orders.retry.5s.
+func retryTierTopic(topic string, delay time.Duration) string {
+	var label string
+	switch {
+	case delay%time.Hour == 0:
+		label = strconv.FormatInt(int64(delay/time.Hour), 10) + "h"
+	case delay%time.Minute == 0:
+		label = strconv.FormatInt(int64(delay/time.Minute), 10) + "m"
+	case delay%time.Second == 0:
+		label = strconv.FormatInt(int64(delay/time.Second), 10) + "s"
+	default:
+		label = delay.String()
+	}
+	return topic + ".retry." + label
+}
+
+// nextRetryTier returns the index of the tier a message failing on topic
+// moves to, or -1 once the last tier has been tried.
+func (s *subscription) nextRetryTier(topic string) int {
+	for i, tier := range s.retryTiers {
+		if tier.topic == topic {
+			if i+1 < len(s.retryTiers) {
+				return i + 1
+			}
+			return -1
+		}
+	}
+	return 0
+}
+
+// retryTopics moves messages that fail with a retryable error to the next
+// retry tier and acks them, so the partition moves on. Permanent failures,
+// and failures on the last tier, are returned as permanent for the dead
+// letter middleware around it.
+func (c *Consumer) retryTopics(sub *subscription) message.HandlerMiddleware {
+	return func(h message.HandlerFunc) message.HandlerFunc {
+		return func(msg *message.Message) ([]*message.Message, error) {
+			produced, err := h(msg)
+			if err == nil || streamHandler.IsPermanent(err) || errors.Is(err, context.Canceled) {
+				return produced, err
+			}
+
+			next := sub.nextRetryTier(message.SubscribeTopicFromCtx(msg.Context()))
+			if next < 0 {
+				return nil, streamHandler.Permanent(fmt.Errorf("retry topics exhausted: %w", err))
+			}
+
+			tier := sub.retryTiers[next]
+			if pubErr := c.publishRetry(sub, msg, next, err); pubErr != nil {
+				log.WithContext(msg.Context()).Errorf("consumer: failed to move message %s to retry topic %s: %v",
+					msg.UUID, tier.topic, pubErr)
+				// Nacked, so the message is redelivered instead of lost.
+				return nil, streamHandler.Transient(fmt.Errorf("move to retry topic %s: %w", tier.topic, pubErr))
+			}
+
+			log.WithContext(msg.Context()).Warnw("consumer: message moved to retry topic",
+				"uuid", msg.UUID,
+				"retry_topic", tier.topic,
+				"delay", tier.delay,
+				"error", err)
+			msg.Metadata.Set(retryScheduledKey, tier.topic)
+			return nil, nil
+		}
+	}
+}
+
+// publishRetry republishes msg to a retry tier with the time it becomes due.
+func (c *Consumer) publishRetry(sub *subscription, msg *message.Message, tier int, cause error) error {
+	now := time.Now().UTC()
+
+	retryMsg := message.NewMessage(msg.UUID, msg.Payload)
+	for key, value := range msg.Metadata {
+		retryMsg.Metadata.Set(key, value)
+	}
+
+	if retryMsg.Metadata.Get(RetrySourceTopicKey) == "" {
+		retryMsg.Metadata.Set(RetrySourceTopicKey, sub.config.Topic)
+	}
+	retryMsg.Metadata.Set(RetryTierKey, strconv.Itoa(tier+1))
+	retryMsg.Metadata.Set(RetryErrorKey, cause.Error())
+	retryMsg.Metadata.Set(RetryFailedKey, now.Format(time.RFC3339Nano))
+	retryMsg.Metadata.Set(RetryNotBeforeKey, now.Add(sub.retryTiers[tier].delay).Format(time.RFC3339Nano))
+
+	return c.publisher.Publish(sub.retryTiers[tier].topic, retryMsg)
+}
+
+// retryNotBefore returns the time before which a retry tier message is not
+// handed to the handler, zero when it has none.
+func retryNotBefore(msg *sarama.ConsumerMessage) time.Time {
+	notBefore, _ := time.Parse(time.RFC3339Nano, string(headerValue(msg, RetryNotBeforeKey)))
+	return notBefore
+}
+
+// waitUntil blocks until t has passed. It returns ctx.Err() if ctx is
+// cancelled first.
+func waitUntil(ctx context.Context, t time.Time) error {
+	wait := time.Until(t)
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,107 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/config"
+)
+
+func TestRetryTierTopic(t *testing.T) {
+	tests := []struct {
+		delay time.Duration
+		want  string
+	}{
+		{5 * time.Second, "orders.retry.5s"},
+		{90 * time.Second, "orders.retry.90s"},
+		{time.Minute, "orders.retry.1m"},
+		{10 * time.Minute, "orders.retry.10m"},
+		{2 * time.Hour, "orders.retry.2h"},
+		{1500 * time.Millisecond, "orders.retry.1.5s"},
+	}
+
+	for _, tt := range tests {
+		if got := retryTierTopic("orders", tt.delay); got != tt.want {
+			t.Errorf("retryTierTopic(%s) = %s, want %s", tt.delay, got, tt.want)
+		}
+	}
+}
+
+func TestNewRetryTiersRejectsInvalidDelays(t *testing.T) {
+	delays := [][]time.Duration{
+		nil,
+		{0},
+		{5 * time.Second, -time.Second},
+		{time.Minute, 60 * time.Second},
+	}
+	for _, d := range delays {
+		if _, err := newRetryTiers("orders", config.RetryTopicsConfig{Delays: d}); err == nil {
+			t.Errorf("newRetryTiers(%v) succeeded, want an error", d)
+		}
+	}
+}
+
+func TestNextRetryTier(t *testing.T) {
+	tiers, err := newRetryTiers("orders", config.RetryTopicsConfig{
+		Delays: []time.Duration{5 * time.Second, time.Minute, 10 * time.Minute},
+	})
+	if err != nil {
+		t.Fatalf("newRetryTiers: %v", err)
+	}
+	sub := &subscription{retryTiers: tiers}
+
+	tests := []struct {
+		topic string
+		want  int
+	}{
+		{"orders", 0},
+		{"orders.retry.5s", 1},
+		{"orders.retry.1m", 2},
+		{"orders.retry.10m", -1},
+	}
+	for _, tt := range tests {
+		if got := sub.nextRetryTier(tt.topic); got != tt.want {
+			t.Errorf("nextRetryTier(%s) = %d, want %d", tt.topic, got, tt.want)
+		}
+	}
+}
+
+func TestRetryNotBefore(t *testing.T) {
+	if got := retryNotBefore(&sarama.ConsumerMessage{}); !got.IsZero() {
+		t.Errorf("retryNotBefore without a header = %s, want zero", got)
+	}
+
+	want := time.Date(2026, 3, 1, 12, 30, 0, 500, time.UTC)
+	msg := &sarama.ConsumerMessage{Headers: []*sarama.RecordHeader{
+		{Key: []byte(RetryTierKey), Value: []byte("1")},
+		{Key: []byte(RetryNotBeforeKey), Value: []byte(want.Format(time.RFC3339Nano))},
+	}}
+	if got := retryNotBefore(msg); !got.Equal(want) {
+		t.Errorf("retryNotBefore = %s, want %s", got, want)
+	}
+}
+
+func TestWaitUntil(t *testing.T) {
+	if err := waitUntil(context.Background(), time.Time{}); err != nil {
+		t.Fatalf("waitUntil of a zero time: %v", err)
+	}
+
+	start := time.Now()
+	if err := waitUntil(context.Background(), start.Add(30*time.Millisecond)); err != nil {
+		t.Fatalf("waitUntil: %v", err)
+	}
+	if waited := time.Since(start); waited < 20*time.Millisecond {
+		t.Errorf("waited %s, want until the given time", waited)
+	}
+}
+
+func TestWaitUntilHonoursContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := waitUntil(ctx, time.Now().Add(time.Minute)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want DeadlineExceeded", err)
+	}
+}
@@ -0,0 +1,40 @@
+package consumer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/consumer/streamHandler"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/schema"
+)
+
+// validateSchema checks each message against the stream's schema, in the
+// version named by the payload's version field, before it reaches the
+// handler and older versions are upcast. A message that does not match
+// fails as permanent with the validation errors attached under
+// DeadLetterSchemaErrorsKey, so they travel with it to the dead-letter
+// topic.
+func (s *subscription) validateSchema(h message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		err := s.schema.Validate(msg.Payload)
+		if err == nil {
+			return h(msg)
+		}
+
+		var validationErr *schema.ValidationError
+		if errors.As(err, &validationErr) {
+			if data, jsonErr := json.Marshal(validationErr.Errors); jsonErr == nil {
+				msg.Metadata.Set(DeadLetterSchemaErrorsKey, string(data))
+			}
+		}
+
+		log.WithContext(msg.Context()).Warnw("consumer: message failed schema validation",
+			"stream", s.name,
+			"uuid", msg.UUID,
+			"error", err)
+		return nil, streamHandler.Permanent(fmt.Errorf("validate payload: %w", err))
+	}
+}
@@ -0,0 +1,106 @@
+package consumer
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+)
+
+// groupSessions tracks the consumer group sessions of the Kafka subscriber,
+// which joins the group once per subscribed topic, and the errors it
+// reports. It is what the consumer's health is based on: the brokers being
+// reachable says nothing about whether the subscriber is still consuming.
+type groupSessions struct {
+	mu sync.Mutex
+	// expected is the number of subscribed topics, each holding a session
+	// while it consumes.
+	expected int
+	active   int
+	// missingSince is when fewer than expected sessions became active,
+	// zero while every topic has one.
+	missingSince time.Time
+	lastSetup    time.Time
+	lastErr      error
+	lastErrAt    time.Time
+}
+
+// groupSessionStatus is a point-in-time view of groupSessions.
+type groupSessionStatus struct {
+	Expected     int
+	Active       int
+	MissingSince time.Time
+	LastSetup    time.Time
+	LastErr      error
+	LastErrAt    time.Time
+}
+
+// start resets the tracker for expected topics, none of them joined yet.
+func (s *groupSessions) start(expected int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expected = expected
+	s.active = 0
+	s.missingSince = time.Now()
+}
+
+func (s *groupSessions) setup() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.active++
+	s.lastSetup = time.Now()
+	if s.active >= s.expected {
+		s.missingSince = time.Time{}
+	}
+}
+
+func (s *groupSessions) cleanup() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.active--
+	if s.active < s.expected && s.missingSince.IsZero() {
+		s.missingSince = time.Now()
+	}
+}
+
+func (s *groupSessions) recordError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastErr = err
+	s.lastErrAt = time.Now()
+}
+
+func (s *groupSessions) status() groupSessionStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return groupSessionStatus{
+		Expected:     s.expected,
+		Active:       s.active,
+		MissingSince: s.missingSince,
+		LastSetup:    s.lastSetup,
+		LastErr:      s.lastErr,
+		LastErrAt:    s.lastErrAt,
+	}
+}
+
+// sessionErrorLogger records the errors the Kafka subscriber logs, which is
+// the only way it reports failed group sessions and reconnects.
+type sessionErrorLogger struct {
+	watermill.LoggerAdapter
+	sessions *groupSessions
+}
+
+func (l sessionErrorLogger) Error(msg string, err error, fields watermill.LogFields) {
+	l.sessions.recordError(fmt.Errorf("%s: %w", msg, err))
+	l.LoggerAdapter.Error(msg, err, fields)
+}
+
+func (l sessionErrorLogger) With(fields watermill.LogFields) watermill.LoggerAdapter {
+	return sessionErrorLogger{LoggerAdapter: l.LoggerAdapter.With(fields), sessions: l.sessions}
+}
@@ -0,0 +1,359 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/config"
+)
+
+var ErrStreamNotFound = errors.New("stream not found")
+
+// Stream states reported by Consumer.Streams.
+const (
+	StreamStateRunning = "running"
+	StreamStatePaused  = "paused"
+	// StreamStateCircuitOpen is a stream held by the open circuit breaker.
+	StreamStateCircuitOpen = "circuit_open"
+)
+
+// StreamStatus is a point-in-time view of a registered stream.
+type StreamStatus struct {
+	Name          string
+	Topic         string
+	State         string
+	LastMessageAt time.Time
+	Processed     uint64
+	Failed        uint64
+	// Retried counts the failed messages moved to a retry topic.
+	Retried   uint64
+	RateLimit config.RateLimitConfig
+	// Throughput is the messages completed per second over the last
+	// throughputWindow.
+	Throughput float64
+	// Throttled counts the messages the rate limit held back, and
+	// ThrottledWait is the total time they waited.
+	Throttled     uint64
+	ThrottledWait time.Duration
+	// TimedOut counts handler attempts that failed past the handler timeout,
+	// and Panics the attempts that panicked.
+	TimedOut uint64
+	Panics   uint64
+}
+
+// streamState tracks whether a stream is paused or rate limited and what it
+// has processed.
+type streamState struct {
+	processed     atomic.Uint64
+	failed        atomic.Uint64
+	retried       atomic.Uint64
+	lastMessageAt atomic.Int64
+	throttled     atomic.Uint64
+	throttledWait atomic.Int64
+	timedOut      atomic.Uint64
+	panics        atomic.Uint64
+	throughput    throughputMeter
+	limiter       *rateLimiter
+
+	mu      sync.Mutex
+	paused  bool
+	tripped bool
+	// resumed is non-nil while the stream is paused or tripped, and closed
+	// once it is neither.
+	resumed chan struct{}
+}
+
+func newStreamState(limit config.RateLimitConfig) (*streamState, error) {
+	limiter, err := newRateLimiter(limit)
+	if err != nil {
+		return nil, err
+	}
+	return &streamState{limiter: limiter}, nil
+}
+
+// pause stops the stream's fetch loop from taking new messages. It reports
+// whether the state changed.
+func (s *streamState) pause() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.paused {
+		return false
+	}
+	s.paused = true
+	s.hold()
+	return true
+}
+
+// resume releases a paused fetch loop. It reports whether the state changed.
+// A stream held by the circuit breaker stays held until the circuit closes.
+func (s *streamState) resume() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.paused {
+		return false
+	}
+	s.paused = false
+	s.release()
+	return true
+}
+
+// trip holds the stream while the circuit breaker is open, independently of
+// pause so that neither undoes the other.
+func (s *streamState) trip() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.tripped {
+		return
+	}
+	s.tripped = true
+	s.hold()
+}
+
+func (s *streamState) untrip() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.tripped {
+		return
+	}
+	s.tripped = false
+	s.release()
+}
+
+// hold and release maintain the resumed channel the fetch loop waits on.
+// They must be called with mu held, after updating paused or tripped.
+func (s *streamState) hold() {
+	if s.resumed == nil {
+		s.resumed = make(chan struct{})
+	}
+}
+
+func (s *streamState) release() {
+	if s.paused || s.tripped || s.resumed == nil {
+		return
+	}
+	close(s.resumed)
+	s.resumed = nil
+}
+
+func (s *streamState) isPaused() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.paused
+}
+
+func (s *streamState) isTripped() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tripped
+}
+
+// waitUntilResumed blocks while the stream is paused or held by the circuit
+// breaker. It returns ctx.Err() if ctx is cancelled first.
+func (s *streamState) waitUntilResumed(ctx context.Context) error {
+	s.mu.Lock()
+	resumed := s.resumed
+	s.mu.Unlock()
+
+	if resumed == nil {
+		return nil
+	}
+
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// throttle waits for the stream's rate limit to allow another message.
+func (s *streamState) throttle(ctx context.Context) error {
+	waited, err := s.limiter.Wait(ctx)
+	if waited > 0 {
+		s.throttled.Add(1)
+		s.throttledWait.Add(int64(waited))
+	}
+	return err
+}
+
+func (s *streamState) recordReceived() {
+	s.lastMessageAt.Store(time.Now().UnixNano())
+}
+
+func (s *streamState) recordProcessed() {
+	s.processed.Add(1)
+	s.throughput.record(time.Now())
+}
+
+func (s *streamState) recordRetried() {
+	s.retried.Add(1)
+	s.throughput.record(time.Now())
+}
+
+func (s *streamState) recordFailed() {
+	s.failed.Add(1)
+	s.throughput.record(time.Now())
+}
+
+func (s *streamState) recordTimedOut() {
+	s.timedOut.Add(1)
+}
+
+func (s *streamState) recordPanic() {
+	s.panics.Add(1)
+}
+
+func (s *streamState) status(name, topic string) StreamStatus {
+	status := StreamStatus{
+		Name:          name,
+		Topic:         topic,
+		State:         StreamStateRunning,
+		Processed:     s.processed.Load(),
+		Failed:        s.failed.Load(),
+		Retried:       s.retried.Load(),
+		RateLimit:     s.limiter.Limit(),
+		Throughput:    s.throughput.rate(time.Now()),
+		Throttled:     s.throttled.Load(),
+		ThrottledWait: time.Duration(s.throttledWait.Load()),
+		TimedOut:      s.timedOut.Load(),
+		Panics:        s.panics.Load(),
+	}
+	switch {
+	case s.isPaused():
+		status.State = StreamStatePaused
+	case s.isTripped():
+		status.State = StreamStateCircuitOpen
+	}
+	if last := s.lastMessageAt.Load(); last > 0 {
+		status.LastMessageAt = time.Unix(0, last)
+	}
+	return status
+}
+
+// throughputWindow is how far back StreamStatus.Throughput looks.
+const throughputWindow = 10 * time.Second
+
+// throughputMeter counts completed messages in one-second buckets covering
+// throughputWindow and the current second.
+type throughputMeter struct {
+	mu      sync.Mutex
+	counts  [throughputWindow/time.Second + 1]uint64
+	seconds [throughputWindow/time.Second + 1]int64
+}
+
+func (m *throughputMeter) record(now time.Time) {
+	sec := now.Unix()
+	i := sec % int64(len(m.counts))
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.seconds[i] != sec {
+		m.seconds[i] = sec
+		m.counts[i] = 0
+	}
+	m.counts[i]++
+}
+
+// rate returns the average messages per second over the last full
+// throughputWindow, leaving out the current, partial second.
+func (m *throughputMeter) rate(now time.Time) float64 {
+	sec := now.Unix()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var total uint64
+	for i, count := range m.counts {
+		if age := sec - m.seconds[i]; age >= 1 && age <= int64(throughputWindow/time.Second) {
+			total += count
+		}
+	}
+	return float64(total) / throughputWindow.Seconds()
+}
+
+// Streams returns the status of every registered stream, sorted by name.
+func (c *Consumer) Streams() []StreamStatus {
+	statuses := make([]StreamStatus, 0, len(c.subscriptions))
+	for name, sub := range c.subscriptions {
+		statuses = append(statuses, sub.state.status(name, sub.config.Topic))
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+
+	return statuses
+}
+
+// Stream returns the status of the named stream.
+func (c *Consumer) Stream(name string) (StreamStatus, error) {
+	sub, ok := c.subscriptions[name]
+	if !ok {
+		return StreamStatus{}, ErrStreamNotFound
+	}
+	return sub.state.status(name, sub.config.Topic), nil
+}
+
+// PauseStream stops fetching messages for the named stream. Messages already
+// being processed finish normally, and the consumer group membership is
+// kept so no rebalance is triggered.
+func (c *Consumer) PauseStream(name string) (StreamStatus, error) {
+	sub, ok := c.subscriptions[name]
+	if !ok {
+		return StreamStatus{}, ErrStreamNotFound
+	}
+
+	if sub.state.pause() {
+		log.Infof("consumer: paused stream %s (topic: %s)", name, sub.config.Topic)
+	}
+
+	return sub.state.status(name, sub.config.Topic), nil
+}
+
+// ResumeStream resumes fetching messages for a paused stream.
+func (c *Consumer) ResumeStream(name string) (StreamStatus, error) {
+	sub, ok := c.subscriptions[name]
+	if !ok {
+		return StreamStatus{}, ErrStreamNotFound
+	}
+
+	if sub.state.resume() {
+		log.Infof("consumer: resumed stream %s (topic: %s)", name, sub.config.Topic)
+	}
+
+	return sub.state.status(name, sub.config.Topic), nil
+}
+
+// trackStatus records the outcome of every message in the stream's
+// counters. Dead-lettered and dropped messages count as failed, and
+// messages moved to a retry topic as retried.
+func (s *subscription) trackStatus(h message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		produced, err := h(msg)
+
+		switch {
+		case errors.Is(err, context.Canceled):
+			// Abandoned during shutdown, redelivered later.
+		case err != nil, msg.Metadata.Get(middleware.ReasonForPoisonedKey) != "":
+			s.state.recordFailed()
+		case msg.Metadata.Get(retryScheduledKey) != "":
+			s.state.recordRetried()
+		default:
+			s.state.recordProcessed()
+		}
+
+		return produced, err
+	}
+}
@@ -0,0 +1,210 @@
+package streamHandler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/muazwzxv/kafka-consumer-worker/internal/schemaregistry"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/serde"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/versioning"
+	"github.com/samber/do/v2"
+)
+
+// Decoder turns a message payload into the value v points to.
+type Decoder interface {
+	Decode(data []byte, v any) error
+}
+
+// DecoderFunc adapts a function to the Decoder interface.
+type DecoderFunc func(data []byte, v any) error
+
+func (f DecoderFunc) Decode(data []byte, v any) error {
+	return f(data, v)
+}
+
+// DecoderFactory builds a decoder that needs dependencies, such as the
+// schema registry client, from the injector.
+type DecoderFactory func(i do.Injector) (Decoder, error)
+
+// Decoder names streams select with their decoder setting.
+const (
+	DecoderJSON       = "json"
+	DecoderJSONStrict = "json_strict"
+	DecoderAvro       = serde.EncodingAvro
+	DecoderProtobuf   = serde.EncodingProtobuf
+)
+
+var (
+	decodersMu sync.RWMutex
+	decoders   = map[string]Decoder{
+		DecoderJSON:       DecoderFunc(decodeJSON),
+		DecoderJSONStrict: DecoderFunc(decodeJSONStrict),
+	}
+	decoderFactories = map[string]DecoderFactory{
+		DecoderAvro:     registryDecoder(serde.EncodingAvro),
+		DecoderProtobuf: registryDecoder(serde.EncodingProtobuf),
+	}
+)
+
+// RegisterDecoder makes a decoder available to streams under name. It
+// panics if name is registered twice.
+func RegisterDecoder(name string, decoder Decoder) {
+	decodersMu.Lock()
+	defer decodersMu.Unlock()
+
+	if decoderRegistered(name) {
+		panic(fmt.Sprintf("streamHandler: decoder %q registered twice", name))
+	}
+	decoders[name] = decoder
+}
+
+// RegisterDecoderFactory makes a decoder built by factory available to
+// streams under name. It panics if name is registered twice.
+func RegisterDecoderFactory(name string, factory DecoderFactory) {
+	decodersMu.Lock()
+	defer decodersMu.Unlock()
+
+	if decoderRegistered(name) {
+		panic(fmt.Sprintf("streamHandler: decoder %q registered twice", name))
+	}
+	decoderFactories[name] = factory
+}
+
+// decoderRegistered must be called with decodersMu held.
+func decoderRegistered(name string) bool {
+	_, isDecoder := decoders[name]
+	_, isFactory := decoderFactories[name]
+	return isDecoder || isFactory
+}
+
+// LookupDecoder returns the decoder registered under name. An empty name
+// selects lenient JSON. Decoders registered as factories are built from i.
+func LookupDecoder(i do.Injector, name string) (Decoder, error) {
+	if name == "" {
+		name = DecoderJSON
+	}
+
+	decodersMu.RLock()
+	decoder, ok := decoders[name]
+	factory, isFactory := decoderFactories[name]
+	decodersMu.RUnlock()
+
+	switch {
+	case ok:
+		return decoder, nil
+	case isFactory:
+		decoder, err := factory(i)
+		if err != nil {
+			return nil, fmt.Errorf("build %s decoder: %w", name, err)
+		}
+		return decoder, nil
+	default:
+		return nil, fmt.Errorf("unknown decoder %q (registered: %v)", name, registeredDecoders())
+	}
+}
+
+// BinaryDecoder reports whether the decoder registered under name reads
+// payloads that are not JSON, which JSON Schema validation and payload
+// idempotency keys cannot look into.
+func BinaryDecoder(name string) bool {
+	return name == DecoderAvro || name == DecoderProtobuf
+}
+
+func registeredDecoders() []string {
+	decodersMu.RLock()
+	defer decodersMu.RUnlock()
+
+	names := make([]string, 0, len(decoders)+len(decoderFactories))
+	for registered := range decoders {
+		names = append(names, registered)
+	}
+	for registered := range decoderFactories {
+		names = append(names, registered)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// decodeJSON ignores fields the target type does not declare. Both JSON
+// decoders also read JSON written by a schema registry serializer.
+func decodeJSON(data []byte, v any) error {
+	return json.Unmarshal(serde.StripHeader(data), v)
+}
+
+// decodeJSONStrict rejects fields the target type does not declare and
+// trailing data after the JSON value.
+func decodeJSONStrict(data []byte, v any) error {
+	decoder := json.NewDecoder(bytes.NewReader(serde.StripHeader(data)))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if decoder.More() {
+		return errors.New("unexpected data after JSON value")
+	}
+	return nil
+}
+
+// registryDecoder builds the decoder of a schema registry encoding. The
+// registry being unreachable fails decoding as transient, so the message
+// is retried rather than dead-lettered.
+func registryDecoder(encoding string) DecoderFactory {
+	return func(i do.Injector) (Decoder, error) {
+		client, err := do.Invoke[*schemaregistry.Client](i)
+		if err != nil {
+			return nil, fmt.Errorf("resolve schema registry client: %w", err)
+		}
+
+		deserializer, err := serde.New(encoding, client, "")
+		if err != nil {
+			return nil, err
+		}
+
+		return DecoderFunc(func(data []byte, v any) error {
+			err := deserializer.Deserialize(context.Background(), data, v)
+			if errors.Is(err, schemaregistry.ErrUnavailable) {
+				return Transient(err)
+			}
+			return err
+		}), nil
+	}
+}
+
+// UpcastingDecoder decodes payloads of every version of an event into its
+// current type. decoder, the stream's decoder registered under name, first
+// decodes the payload generically; chain upcasts it to the current
+// version, and the result is decoded into the target. JSON decoders decode
+// the upcast payload themselves, so json_strict still rejects unknown
+// fields. A payload chain cannot upcast fails to decode.
+func UpcastingDecoder(name string, decoder Decoder, chain *versioning.Chain) Decoder {
+	final := decoder
+	if BinaryDecoder(name) {
+		final = DecoderFunc(decodeJSON)
+	}
+
+	return DecoderFunc(func(data []byte, v any) error {
+		var payload map[string]any
+		if err := decoder.Decode(data, &payload); err != nil {
+			return err
+		}
+		if payload == nil {
+			// A null payload has no version; the target decides.
+			return final.Decode([]byte("null"), v)
+		}
+		if err := chain.Upcast(payload); err != nil {
+			return err
+		}
+
+		upcast, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		return final.Decode(upcast, v)
+	})
+}
@@ -0,0 +1,117 @@
+package streamHandler
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/muazwzxv/kafka-consumer-worker/internal/serde"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/versioning"
+)
+
+type decodedUser struct {
+	UUID   string `json:"uuid"`
+	Status string `json:"status"`
+}
+
+func TestDecodeJSONStrict(t *testing.T) {
+	var got decodedUser
+	if err := decodeJSONStrict([]byte(`{"uuid":"u-1","status":"active"}`), &got); err != nil {
+		t.Fatalf("decodeJSONStrict: %v", err)
+	}
+	if want := (decodedUser{UUID: "u-1", Status: "active"}); got != want {
+		t.Errorf("decoded %+v, want %+v", got, want)
+	}
+}
+
+func TestDecodeJSONStrictRejects(t *testing.T) {
+	payloads := map[string]string{
+		"unknown field":  `{"uuid":"u-1","status":"active","role":"admin"}`,
+		"trailing value": `{"uuid":"u-1"} {"uuid":"u-2"}`,
+		"wrong type":     `{"uuid":1}`,
+		"not JSON":       `{"uuid":`,
+	}
+	for name, payload := range payloads {
+		var got decodedUser
+		if err := decodeJSONStrict([]byte(payload), &got); err == nil {
+			t.Errorf("%s: decodeJSONStrict succeeded, want an error", name)
+		}
+	}
+}
+
+func TestDecodeJSONIgnoresUnknownFields(t *testing.T) {
+	var got decodedUser
+	if err := decodeJSON([]byte(`{"uuid":"u-1","role":"admin"}`), &got); err != nil {
+		t.Fatalf("decodeJSON: %v", err)
+	}
+	if got.UUID != "u-1" {
+		t.Errorf("UUID = %q, want u-1", got.UUID)
+	}
+}
+
+func TestJSONDecodersStripRegistryHeader(t *testing.T) {
+	data := append(serde.AppendHeader(nil, 7), `{"uuid":"u-1","status":"active"}`...)
+
+	for name, decode := range map[string]DecoderFunc{
+		DecoderJSON:       decodeJSON,
+		DecoderJSONStrict: decodeJSONStrict,
+	} {
+		var got decodedUser
+		if err := decode(data, &got); err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if got.UUID != "u-1" {
+			t.Errorf("%s: UUID = %q, want u-1", name, got.UUID)
+		}
+	}
+}
+
+func TestLookupDecoder(t *testing.T) {
+	for _, name := range []string{"", DecoderJSON, DecoderJSONStrict} {
+		if _, err := LookupDecoder(nil, name); err != nil {
+			t.Errorf("LookupDecoder(%q): %v", name, err)
+		}
+	}
+	if _, err := LookupDecoder(nil, "yaml"); err == nil {
+		t.Error("LookupDecoder of an unregistered decoder succeeded, want an error")
+	}
+}
+
+func TestRegisterDecoderTwicePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("registering json again did not panic")
+		}
+	}()
+	RegisterDecoder(DecoderJSON, DecoderFunc(decodeJSON))
+}
+
+func TestUpcastingDecoder(t *testing.T) {
+	chain := versioning.NewChain("user").Add(func(payload map[string]any) error {
+		payload["status"] = "active"
+		return nil
+	}, nil)
+
+	type userV2 struct {
+		Version int    `json:"version"`
+		UUID    string `json:"uuid"`
+		Status  string `json:"status"`
+	}
+
+	decoder := UpcastingDecoder(DecoderJSONStrict, DecoderFunc(decodeJSONStrict), chain)
+
+	var got userV2
+	if err := decoder.Decode([]byte(`{"uuid":"u-1"}`), &got); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if want := (userV2{Version: 2, UUID: "u-1", Status: "active"}); got != want {
+		t.Errorf("decoded %+v, want %+v", got, want)
+	}
+
+	if err := decoder.Decode([]byte(`{"uuid":"u-1","role":"admin"}`), &got); err == nil {
+		t.Error("strict decoding of an unknown field succeeded after upcasting, want an error")
+	}
+	if err := decoder.Decode([]byte(`{"version":3,"uuid":"u-1"}`), &got); !errors.Is(err, versioning.ErrUnsupportedVersion) {
+		t.Errorf("err = %v, want ErrUnsupportedVersion for a newer version", err)
+	}
+}
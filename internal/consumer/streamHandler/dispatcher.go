@@ -0,0 +1,148 @@
+package streamHandler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2/log"
+)
+
+// EventTypeKey is the metadata key carrying the event type of a message.
+// Handlers fall back to the payload's event type field when it is not set.
+const EventTypeKey = "event_type"
+
+var ErrUnknownEventType = errors.New("unknown event type")
+
+// UnknownEventPolicy decides what happens to a message whose event type has
+// no registered logic.
+type UnknownEventPolicy string
+
+const (
+	// UnknownEventLog acks the message and logs a warning.
+	UnknownEventLog UnknownEventPolicy = "log"
+	// UnknownEventSkip acks the message silently.
+	UnknownEventSkip UnknownEventPolicy = "skip"
+	// UnknownEventDeadLetter routes the message to the dead-letter topic.
+	UnknownEventDeadLetter UnknownEventPolicy = "dead_letter"
+)
+
+// ParseUnknownEventPolicy validates a configured policy name. An empty name
+// selects UnknownEventLog.
+func ParseUnknownEventPolicy(name string) (UnknownEventPolicy, error) {
+	switch policy := UnknownEventPolicy(name); policy {
+	case "":
+		return UnknownEventLog, nil
+	case UnknownEventLog, UnknownEventSkip, UnknownEventDeadLetter:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown event policy %q (valid: log, skip, dead_letter)", name)
+	}
+}
+
+// EventFunc processes a single decoded event.
+type EventFunc[T any] func(ctx context.Context, event T) error
+
+// BatchEventFunc processes events of one type together and returns one error
+// per event, in the same order as events.
+type BatchEventFunc[T any] func(ctx context.Context, events []T) []error
+
+// Dispatcher routes decoded events to the logic registered for their event
+// type, so supporting a new event type only takes a Register call.
+type Dispatcher[T any] struct {
+	name     string
+	routes   map[string]EventFunc[T]
+	batches  map[string]BatchEventFunc[T]
+	fallback UnknownEventPolicy
+}
+
+// NewDispatcher creates a dispatcher for the named stream that applies
+// fallback to unregistered event types.
+func NewDispatcher[T any](name string, fallback UnknownEventPolicy) *Dispatcher[T] {
+	return &Dispatcher[T]{
+		name:     name,
+		routes:   make(map[string]EventFunc[T]),
+		batches:  make(map[string]BatchEventFunc[T]),
+		fallback: fallback,
+	}
+}
+
+// Register routes eventType to fn. Registering a type twice replaces the
+// earlier logic.
+func (d *Dispatcher[T]) Register(eventType string, fn EventFunc[T]) {
+	d.routes[eventType] = fn
+}
+
+// RegisterBatch routes batches of eventType to fn. Event types without batch
+// logic are dispatched one event at a time by DispatchBatch.
+func (d *Dispatcher[T]) RegisterBatch(eventType string, fn BatchEventFunc[T]) {
+	d.batches[eventType] = fn
+}
+
+// Dispatch runs the logic registered for eventType.
+func (d *Dispatcher[T]) Dispatch(ctx context.Context, eventType string, event T) error {
+	fn, ok := d.routes[eventType]
+	if !ok {
+		return d.unknown(eventType)
+	}
+	return fn(ctx, event)
+}
+
+// DispatchBatch groups events by type and runs each group through its batch
+// logic when registered, or event by event otherwise. eventTypes[i] is the
+// type of events[i]. It returns one error per event.
+func (d *Dispatcher[T]) DispatchBatch(ctx context.Context, eventTypes []string, events []T) []error {
+	errs := make([]error, len(events))
+
+	groups := make(map[string][]int)
+	order := make([]string, 0)
+	for i, eventType := range eventTypes {
+		if _, ok := groups[eventType]; !ok {
+			order = append(order, eventType)
+		}
+		groups[eventType] = append(groups[eventType], i)
+	}
+
+	for _, eventType := range order {
+		idx := groups[eventType]
+
+		batchFn, ok := d.batches[eventType]
+		if !ok {
+			for _, i := range idx {
+				errs[i] = d.Dispatch(ctx, eventType, events[i])
+			}
+			continue
+		}
+
+		group := make([]T, len(idx))
+		for j, i := range idx {
+			group[j] = events[i]
+		}
+
+		results := batchFn(ctx, group)
+		if len(results) != len(group) {
+			err := fmt.Errorf("batch logic for %s returned %d results for %d events", eventType, len(results), len(group))
+			for _, i := range idx {
+				errs[i] = err
+			}
+			continue
+		}
+		for j, i := range idx {
+			errs[i] = results[j]
+		}
+	}
+
+	return errs
+}
+
+func (d *Dispatcher[T]) unknown(eventType string) error {
+	switch d.fallback {
+	case UnknownEventSkip:
+		return nil
+	case UnknownEventDeadLetter:
+		return Permanent(fmt.Errorf("%w %q on stream %s", ErrUnknownEventType, eventType, d.name))
+	default:
+		log.Warnf("%s: no logic registered for event type %q, skipping", d.name, eventType)
+		return nil
+	}
+}
@@ -0,0 +1,84 @@
+package streamHandler
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/muazwzxv/kafka-consumer-worker/internal/database"
+)
+
+// PermanentError marks a failure that redelivery cannot fix, such as a
+// malformed payload or a reference to a record that does not exist. The
+// consumer acks the message and routes it to the dead-letter topic without
+// retrying.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return "permanent: " + e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// TransientError marks a failure that is expected to clear up on its own,
+// such as a dropped database connection. The consumer retries it in place
+// and, once the retry policy is exhausted, nacks the message so Kafka
+// redelivers it instead of committing its offset.
+type TransientError struct {
+	Err error
+}
+
+func (e *TransientError) Error() string {
+	return "transient: " + e.Err.Error()
+}
+
+func (e *TransientError) Unwrap() error {
+	return e.Err
+}
+
+// Permanent wraps err as a PermanentError. It returns nil for a nil err.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{Err: err}
+}
+
+// Transient wraps err as a TransientError. It returns nil for a nil err.
+func Transient(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &TransientError{Err: err}
+}
+
+// IsPermanent reports whether err or any error it wraps is a PermanentError.
+func IsPermanent(err error) bool {
+	var permanent *PermanentError
+	return errors.As(err, &permanent)
+}
+
+// IsTransient reports whether err or any error it wraps is a TransientError.
+func IsTransient(err error) bool {
+	var transient *TransientError
+	return errors.As(err, &transient)
+}
+
+// classifyError wraps a repository error so the consumer settles it
+// correctly: a missing row will never appear on redelivery, while a
+// transient database failure should be retried.
+func classifyError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, sql.ErrNoRows):
+		return Permanent(err)
+	case database.IsTransientError(err):
+		return Transient(err)
+	default:
+		return err
+	}
+}
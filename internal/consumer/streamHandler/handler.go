@@ -6,7 +6,53 @@ import (
 	"github.com/ThreeDotsLabs/watermill/message"
 )
 
+// AttemptKey is the metadata key holding the 1-based attempt number of the
+// handler run currently processing the message.
+const AttemptKey = "attempt"
+
+// MessageHandler processes messages from a single topic.
+//
+// Handlers must not Ack or Nack messages themselves; the consumer settles
+// each message from the returned error:
+//   - nil: the message is acked and its offset committed.
+//   - PermanentError: the message is acked and routed to the dead-letter topic.
+//   - TransientError: the message is retried per the stream's retry policy,
+//     then nacked so it is redelivered.
+//   - any other error: the message is retried if the stream's retry
+//     classifier allows it, then routed to the dead-letter topic.
+//
+// On streams with retry topics, transient and other non-permanent errors
+// move the message to the next delayed retry topic instead, and to the
+// dead-letter topic after the last one.
+//
+// Each attempt runs under the stream's handler_timeout, which the handler
+// sees as its context deadline; an attempt that fails once the deadline
+// has passed fails as transient. Handlers must return when their context
+// is done: the attempt is waited for, never abandoned. A panic fails the
+// attempt as permanent.
 type MessageHandler interface {
 	Handle(ctx context.Context, msg *message.Message) error
 	TopicName() string
 }
+
+// BatchMessageHandler processes messages from a single topic in groups, so
+// side effects can be applied with one bulk write instead of one per
+// message. The consumer hands it up to the stream's batch_size messages, or
+// whatever arrived within batch_linger.
+//
+// HandleBatch returns one error per message, in the same order as msgs.
+// Each error follows the same contract as MessageHandler.Handle, so a batch
+// can partially succeed: only the messages with a nil error are acked.
+type BatchMessageHandler interface {
+	HandleBatch(ctx context.Context, msgs []*message.Message) []error
+	TopicName() string
+}
+
+// ProducingHandler is a MessageHandler that consumes from one topic and
+// publishes to another. Streams with a publish_topic call HandleAndProduce
+// instead of Handle; the returned messages are published to that topic
+// before the consumed message is acked, and a publish failure nacks it.
+type ProducingHandler interface {
+	MessageHandler
+	HandleAndProduce(ctx context.Context, msg *message.Message) ([]*message.Message, error)
+}
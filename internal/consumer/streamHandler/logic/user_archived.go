@@ -0,0 +1,28 @@
+package logic
+
+import (
+	"context"
+
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/dto/stream"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/repository"
+)
+
+type UserArchivedLogic struct {
+	UserRepo repository.UserRepository
+}
+
+func (l *UserArchivedLogic) ProcessUserArchival(ctx context.Context, msg *stream.UserLifeCycleStream) error {
+	user, err := l.UserRepo.GetByUUID(ctx, msg.UUID)
+	if err != nil {
+		return err
+	}
+
+	user.MarkAsArchived()
+	if updateErr := l.UserRepo.UpdateUser(ctx, user); updateErr != nil {
+		return updateErr
+	}
+	log.WithContext(ctx).Infof("successfully processed user archived event for uuid: %s", msg.UUID)
+
+	return nil
+}
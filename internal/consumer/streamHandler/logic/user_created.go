@@ -2,9 +2,11 @@ package logic
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/gofiber/fiber/v2/log"
 	"github.com/muazwzxv/kafka-consumer-worker/internal/dto/stream"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/entity"
 	"github.com/muazwzxv/kafka-consumer-worker/internal/repository"
 )
 
@@ -20,9 +22,55 @@ func (l *UserCreatedLogic) ProcessUserPendingCreation(ctx context.Context, msg *
 
 	user.MarkAsActive()
 	if updateErr := l.UserRepo.UpdateUser(ctx, user); updateErr != nil {
-		return err
+		return updateErr
 	}
 	log.WithContext(ctx).Infof("successfully processed user pending creation event for uuid: %s", msg.UUID)
 
 	return nil
 }
+
+// ProcessUserPendingCreationBatch activates every user in msgs with a single
+// multi-row update. It returns the failures keyed by user UUID; users that
+// are not returned succeeded.
+func (l *UserCreatedLogic) ProcessUserPendingCreationBatch(ctx context.Context, msgs []*stream.UserLifeCycleStream) map[string]error {
+	failures := make(map[string]error)
+
+	uuids := make([]string, 0, len(msgs))
+	for _, msg := range msgs {
+		uuids = append(uuids, msg.UUID)
+	}
+
+	users, err := l.UserRepo.GetByUUIDs(ctx, uuids)
+	if err != nil {
+		for _, uuid := range uuids {
+			failures[uuid] = err
+		}
+		return failures
+	}
+
+	found := make(map[string]bool, len(users))
+	for _, user := range users {
+		found[user.UUID] = true
+	}
+
+	existing := make([]string, 0, len(users))
+	for _, uuid := range uuids {
+		if !found[uuid] {
+			failures[uuid] = sql.ErrNoRows
+			continue
+		}
+		existing = append(existing, uuid)
+	}
+
+	if err := l.UserRepo.UpdateStatusByUUIDs(ctx, existing, entity.UserStatusActive); err != nil {
+		for _, uuid := range existing {
+			failures[uuid] = err
+		}
+		return failures
+	}
+
+	log.WithContext(ctx).Infof("successfully processed %d user pending creation events, %d failed",
+		len(existing), len(failures))
+
+	return failures
+}
@@ -0,0 +1,30 @@
+package logic
+
+import (
+	"context"
+
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/dto/stream"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/repository"
+)
+
+type UserUpdatedLogic struct {
+	UserRepo repository.UserRepository
+}
+
+// ProcessUserUpdate applies the user's name and description from the event.
+func (l *UserUpdatedLogic) ProcessUserUpdate(ctx context.Context, msg *stream.UserLifeCycleStream) error {
+	user, err := l.UserRepo.GetByUUID(ctx, msg.UUID)
+	if err != nil {
+		return err
+	}
+
+	user.Name = msg.Name
+	user.Description = msg.Description
+	if updateErr := l.UserRepo.UpdateUser(ctx, user); updateErr != nil {
+		return updateErr
+	}
+	log.WithContext(ctx).Infof("successfully processed user updated event for uuid: %s", msg.UUID)
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package streamHandler
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/go-viper/mapstructure/v2"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/config"
+	"github.com/samber/do/v2"
+)
+
+// Factory builds the handler of a configured stream. It resolves its
+// dependencies from the injector and reads handler-specific settings from
+// cfg.Options, typically with DecodeOptions.
+type Factory func(i do.Injector, name string, cfg config.StreamConfig) (MessageHandler, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+// Register makes a handler factory available under name, which streams
+// select with their handler setting. Handler packages call it from init;
+// it panics if name is registered twice.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, exists := registry[name]; exists {
+		panic(fmt.Sprintf("streamHandler: handler %q registered twice", name))
+	}
+	registry[name] = factory
+}
+
+// Lookup returns the factory registered under name.
+func Lookup(name string) (Factory, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	factory, ok := registry[name]
+	return factory, ok
+}
+
+// Registered returns the names of every registered handler, sorted.
+func Registered() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DecodeOptions decodes a stream's handler options into target. Unknown
+// option names are rejected so typos fail startup instead of being ignored.
+func DecodeOptions(options map[string]any, target any) error {
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		Result:           target,
+		ErrorUnused:      true,
+		WeaklyTypedInput: true,
+		DecodeHook:       mapstructure.StringToTimeDurationHookFunc(),
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := decoder.Decode(options); err != nil {
+		return fmt.Errorf("decode handler options: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package streamHandler
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill-kafka/v3/pkg/kafka"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/cloudevents"
+)
+
+// Metadata describes the consumed message a decoded payload came from.
+type Metadata struct {
+	UUID      string
+	Topic     string
+	Key       []byte
+	Partition int32
+	Offset    int64
+	Timestamp time.Time
+	// Attempt is the 1-based number of the current handler run.
+	Attempt int
+	Headers message.Metadata
+	// CloudEvent holds the event attributes of messages that are
+	// CloudEvents, in either content mode; nil otherwise.
+	CloudEvent *cloudevents.Event
+}
+
+// MetadataFromMessage collects the metadata of msg, including the Kafka
+// position the subscriber stored in its context.
+func MetadataFromMessage(msg *message.Message) Metadata {
+	md := Metadata{
+		UUID:    msg.UUID,
+		Topic:   message.SubscribeTopicFromCtx(msg.Context()),
+		Headers: msg.Metadata,
+	}
+
+	ctx := msg.Context()
+	if key, ok := kafka.MessageKeyFromCtx(ctx); ok {
+		md.Key = key
+	}
+	if partition, ok := kafka.MessagePartitionFromCtx(ctx); ok {
+		md.Partition = partition
+	}
+	if offset, ok := kafka.MessagePartitionOffsetFromCtx(ctx); ok {
+		md.Offset = offset
+	}
+	if timestamp, ok := kafka.MessageTimestampFromCtx(ctx); ok {
+		md.Timestamp = timestamp
+	}
+	md.Attempt, _ = strconv.Atoi(msg.Metadata.Get(AttemptKey))
+	if event, ok := cloudevents.FromHeaders(msg.Metadata); ok {
+		md.CloudEvent = &event
+	}
+
+	return md
+}
+
+// TypedHandler is a MessageHandler that decodes each payload into T before
+// calling its handle function. A payload that cannot be decoded is a
+// PermanentError, so it is dead-lettered instead of retried, unless the
+// decoder failed with a TransientError, e.g. because the schema registry
+// was unreachable.
+type TypedHandler[T any] struct {
+	topic   string
+	decoder Decoder
+	handle  func(ctx context.Context, event T, md Metadata) error
+}
+
+func NewTypedHandler[T any](
+	topic string,
+	decoder Decoder,
+	handle func(ctx context.Context, event T, md Metadata) error,
+) *TypedHandler[T] {
+	return &TypedHandler[T]{
+		topic:   topic,
+		decoder: decoder,
+		handle:  handle,
+	}
+}
+
+func (h *TypedHandler[T]) TopicName() string {
+	return h.topic
+}
+
+func (h *TypedHandler[T]) Handle(ctx context.Context, msg *message.Message) error {
+	event, md, err := h.Decode(msg)
+	if err != nil {
+		return err
+	}
+	return h.handle(ctx, event, md)
+}
+
+// Decode decodes the payload of msg, for handlers that process decoded
+// events themselves, e.g. in batches.
+func (h *TypedHandler[T]) Decode(msg *message.Message) (T, Metadata, error) {
+	var event T
+	if err := h.decoder.Decode(msg.Payload, &event); err != nil {
+		err = fmt.Errorf("decode %T payload: %w", event, err)
+		if IsTransient(err) {
+			return event, Metadata{}, err
+		}
+		return event, Metadata{}, Permanent(err)
+	}
+	return event, MetadataFromMessage(msg), nil
+}
@@ -2,53 +2,140 @@ package streamHandler
 
 import (
 	"context"
-	"encoding/json"
+	"fmt"
 
 	"github.com/ThreeDotsLabs/watermill/message"
 	"github.com/gofiber/fiber/v2/log"
-	"github.com/muazwzxv/kafka-consumer-worker/internal/consumer/streamHandler/logic"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/config"
 	"github.com/muazwzxv/kafka-consumer-worker/internal/dto/stream"
-	"github.com/muazwzxv/kafka-consumer-worker/internal/entity"
 	"github.com/muazwzxv/kafka-consumer-worker/internal/repository"
+	"github.com/samber/do/v2"
 )
 
+func init() {
+	Register("user_lifecycle", newUserLifecycleHandlerFromConfig)
+}
+
+// UserLifecycleOptions are the handler options of user lifecycle streams.
+type UserLifecycleOptions struct {
+	// UnknownEvent is what happens to messages whose event type has no
+	// registered logic. Options: log, skip, dead_letter.
+	UnknownEvent string `mapstructure:"unknown_event"`
+}
+
+// UserLifecycleHandler decodes user lifecycle events and dispatches them
+// to the logic registered for their event type.
 type UserLifecycleHandler struct {
-	userRepo repository.UserRepository
-	topic    string
+	*TypedHandler[*stream.UserLifeCycleStream]
+	dispatcher *Dispatcher[*stream.UserLifeCycleStream]
 }
 
-func NewUserLifecycleHandler(userRepo repository.UserRepository, topic string) *UserLifecycleHandler {
-	return &UserLifecycleHandler{
-		userRepo: userRepo,
-		topic:    topic,
-	}
+func NewUserLifecycleHandler(
+	userRepo repository.UserRepository,
+	topic string,
+	decoder Decoder,
+	unknownEvents UnknownEventPolicy,
+) *UserLifecycleHandler {
+	dispatcher := NewDispatcher[*stream.UserLifeCycleStream]("user_lifecycle", unknownEvents)
+	registerUserLifecycleEvents(dispatcher, userRepo)
+
+	h := &UserLifecycleHandler{dispatcher: dispatcher}
+	h.TypedHandler = NewTypedHandler(topic, decoder, h.handleEvent)
+	return h
 }
 
-func (h *UserLifecycleHandler) TopicName() string {
-	return h.topic
+func newUserLifecycleHandlerFromConfig(i do.Injector, name string, cfg config.StreamConfig) (MessageHandler, error) {
+	var opts UserLifecycleOptions
+	if err := DecodeOptions(cfg.Options, &opts); err != nil {
+		return nil, err
+	}
+
+	unknownEvents, err := ParseUnknownEventPolicy(opts.UnknownEvent)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder, err := LookupDecoder(i, cfg.Decoder)
+	if err != nil {
+		return nil, err
+	}
+	decoder = UpcastingDecoder(cfg.Decoder, decoder, stream.UserLifeCycleVersions)
+
+	userRepo, err := do.Invoke[repository.UserRepository](i)
+	if err != nil {
+		return nil, fmt.Errorf("resolve user repository: %w", err)
+	}
+
+	return NewUserLifecycleHandler(userRepo, cfg.Topic, decoder, unknownEvents), nil
 }
 
-func (h *UserLifecycleHandler) Handle(ctx context.Context, msg *message.Message) error {
-	log.Infof("Processing message from topic %s: %s", h.topic, msg.UUID)
+func (h *UserLifecycleHandler) handleEvent(ctx context.Context, event *stream.UserLifeCycleStream, md Metadata) error {
+	if event == nil {
+		return Permanent(fmt.Errorf("empty user lifecycle message %s", md.UUID))
+	}
+
+	eventType := userLifecycleEventType(md, event)
+	log.Infof("Processing %s event from topic %s: %s", eventType, md.Topic, md.UUID)
 
-	var userLifecycleStream *stream.UserLifeCycleStream
-	if err := json.Unmarshal(msg.Payload, &userLifecycleStream); err != nil {
-		log.Errorf("Failed to unmarshal message %s: %v", msg.UUID, err)
-		return err
+	if err := h.dispatcher.Dispatch(ctx, eventType, event); err != nil {
+		log.Errorf("Failed to process %s event uuid:%s attempt:%d: %v", eventType, md.UUID, md.Attempt, err)
+		return classifyError(fmt.Errorf("process %s event %s: %w", eventType, event.UUID, err))
 	}
 
-	log.Infof("Message payload: %+v", userLifecycleStream)
+	return nil
+}
+
+func (h *UserLifecycleHandler) HandleBatch(ctx context.Context, msgs []*message.Message) []error {
+	log.Infof("Processing batch of %d messages from topic %s", len(msgs), h.TopicName())
 
-	if userLifecycleStream.Status == entity.UserStatusPending.String() {
-		l := logic.UserCreatedLogic{
-			UserRepo: h.userRepo,
+	errs := make([]error, len(msgs))
+	events := make([]*stream.UserLifeCycleStream, 0, len(msgs))
+	eventTypes := make([]string, 0, len(msgs))
+	eventIdx := make([]int, 0, len(msgs))
+
+	for i, msg := range msgs {
+		event, md, err := h.Decode(msg)
+		if err == nil && event == nil {
+			err = Permanent(fmt.Errorf("empty user lifecycle message %s", msg.UUID))
+		}
+		if err != nil {
+			log.Errorf("Failed to decode message %s: %v", msg.UUID, err)
+			errs[i] = err
+			continue
 		}
 
-		if err := l.ProcessUserPendingCreation(ctx, userLifecycleStream); err != nil {
-			log.Errorf("Failed to process user pending activation uuid:%s: %v", msg.UUID, err)
+		events = append(events, event)
+		eventTypes = append(eventTypes, userLifecycleEventType(md, event))
+		eventIdx = append(eventIdx, i)
+	}
+
+	if len(events) == 0 {
+		return errs
+	}
+
+	results := h.dispatcher.DispatchBatch(ctx, eventTypes, events)
+	for j, err := range results {
+		if err == nil {
+			continue
 		}
+		i := eventIdx[j]
+		log.Errorf("Failed to process %s event uuid:%s attempt:%s: %v",
+			eventTypes[j], msgs[i].UUID, msgs[i].Metadata.Get(AttemptKey), err)
+		errs[i] = classifyError(fmt.Errorf("process %s event %s: %w", eventTypes[j], events[j].UUID, err))
 	}
 
-	msg.Ack()
-	return nil
+	return errs
+}
+
+// userLifecycleEventType reads the event type from the message header, the
+// CloudEvents type, then the payload. Payloads from before event types
+// existed get theirs from the version 1 upcaster.
+func userLifecycleEventType(md Metadata, event *stream.UserLifeCycleStream) string {
+	if eventType := md.Headers.Get(EventTypeKey); eventType != "" {
+		return eventType
+	}
+	if md.CloudEvent != nil && md.CloudEvent.Type != "" {
+		return md.CloudEvent.Type
+	}
+	return event.EventType
 }
@@ -0,0 +1,34 @@
+package streamHandler
+
+import (
+	"context"
+
+	"github.com/muazwzxv/kafka-consumer-worker/internal/consumer/streamHandler/logic"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/dto/stream"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/repository"
+)
+
+// registerUserLifecycleEvents binds each user lifecycle event type to its
+// logic. Supporting a new event type only needs a registration here.
+func registerUserLifecycleEvents(d *Dispatcher[*stream.UserLifeCycleStream], userRepo repository.UserRepository) {
+	created := &logic.UserCreatedLogic{UserRepo: userRepo}
+	d.Register(stream.UserEventCreated, created.ProcessUserPendingCreation)
+	d.RegisterBatch(stream.UserEventCreated, func(ctx context.Context, events []*stream.UserLifeCycleStream) []error {
+		failures := created.ProcessUserPendingCreationBatch(ctx, events)
+
+		errs := make([]error, len(events))
+		for i, event := range events {
+			errs[i] = failures[event.UUID]
+		}
+		return errs
+	})
+
+	updated := &logic.UserUpdatedLogic{UserRepo: userRepo}
+	d.Register(stream.UserEventUpdated, updated.ProcessUserUpdate)
+
+	deactivated := &logic.UserDeactivatedLogic{UserRepo: userRepo}
+	d.Register(stream.UserEventDeactivated, deactivated.ProcessUserDeactivation)
+
+	archived := &logic.UserArchivedLogic{UserRepo: userRepo}
+	d.Register(stream.UserEventArchived, archived.ProcessUserArchival)
+}
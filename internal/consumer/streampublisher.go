@@ -0,0 +1,103 @@
+package consumer
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill-kafka/v3/pkg/kafka"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/health"
+)
+
+const streamPublisherHealthName = "stream_publisher"
+
+// streamPublisher is the publisher behind dead-lettering, retry tiers and
+// the output of producing handlers. It remembers the outcome of the latest
+// publish for its health report.
+type streamPublisher struct {
+	*kafka.Publisher
+
+	mu          sync.Mutex
+	lastSuccess time.Time
+	lastErr     error
+	lastErrAt   time.Time
+	closed      bool
+}
+
+func (p *streamPublisher) Publish(topic string, msgs ...*message.Message) error {
+	err := p.Publisher.Publish(topic, msgs...)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err != nil {
+		p.lastErr = err
+		p.lastErrAt = time.Now()
+		return err
+	}
+	p.lastSuccess = time.Now()
+	p.lastErr = nil
+	return nil
+}
+
+func (p *streamPublisher) Close() error {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+
+	return p.Publisher.Close()
+}
+
+// HealthName implements health.Contributor.
+func (p *streamPublisher) HealthName() string {
+	return streamPublisherHealthName
+}
+
+// Health implements health.Contributor from the outcome of the latest
+// publish, like the application's publishers: a stream publisher that has
+// not published yet is idle.
+func (p *streamPublisher) Health(context.Context) health.Report {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	report := health.Report{
+		State:       health.StateIdle,
+		Healthy:     true,
+		LastSuccess: p.lastSuccess,
+	}
+
+	switch {
+	case p.closed:
+		report.State = health.StateStopped
+		report.Healthy = false
+		report.Error = "stream publisher closed"
+	case p.lastErr != nil:
+		report.State = health.StateDisconnected
+		report.Healthy = false
+		report.Error = p.lastErr.Error()
+		report.Details = map[string]any{"last_error_at": p.lastErrAt}
+	case !p.lastSuccess.IsZero():
+		report.State = health.StateConnected
+	}
+
+	return report
+}
+
+// StreamPublisherHealth returns the health contributor reporting the
+// consumer's stream publisher, which is disabled when no stream publishes.
+func (c *Consumer) StreamPublisherHealth() health.Contributor {
+	if c.publisher == nil {
+		return disabledStreamPublisher{}
+	}
+	return c.publisher
+}
+
+type disabledStreamPublisher struct{}
+
+func (disabledStreamPublisher) HealthName() string {
+	return streamPublisherHealthName
+}
+
+func (disabledStreamPublisher) Health(context.Context) health.Report {
+	return health.Report{State: health.StateDisabled, Healthy: true}
+}
@@ -0,0 +1,131 @@
+package consumer
+
+import (
+	"context"
+	"sync"
+
+	"github.com/IBM/sarama"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/gofiber/fiber/v2/log"
+)
+
+// streamSubscriber feeds one stream's router handler from the shared Kafka
+// subscriber until fetching stops. Messages of a paused or rate limited
+// stream, and retry tier messages that are not due yet, are held back in
+// their partition claim by admit and admitWhenDue, before the Kafka
+// subscriber hands them out. Closing it only stops fetching: the Kafka
+// subscriber stays open so in-flight messages can still be acked, and the
+// consumer closes it once they have drained.
+type streamSubscriber struct {
+	subscriber message.Subscriber
+	// ctx is the context the Kafka subscription runs with.
+	ctx          context.Context
+	fetchCtx     context.Context
+	stopFetching context.CancelFunc
+	sub          *subscription
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func newStreamSubscriber(
+	subscriber message.Subscriber,
+	ctx context.Context,
+	fetchCtx context.Context,
+	stopFetching context.CancelFunc,
+	sub *subscription,
+) *streamSubscriber {
+	return &streamSubscriber{
+		subscriber:   subscriber,
+		ctx:          ctx,
+		fetchCtx:     fetchCtx,
+		stopFetching: stopFetching,
+		sub:          sub,
+		closed:       make(chan struct{}),
+	}
+}
+
+// Subscribe ignores the router's context, which is cancelled as soon as the
+// router starts closing, in favour of the consumer's handler context.
+func (s *streamSubscriber) Subscribe(_ context.Context, topic string) (<-chan *message.Message, error) {
+	messages, err := s.subscriber.Subscribe(s.ctx, topic)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan *message.Message)
+	go func() {
+		defer close(out)
+		s.forward(topic, messages, out)
+		log.Infof("consumer: stopped fetching messages for topic: %s", topic)
+		// The router treats a closed channel as a stopped handler, so keep
+		// it open until the router itself closes the subscription.
+		<-s.closed
+	}()
+
+	return out, nil
+}
+
+func (s *streamSubscriber) forward(topic string, messages <-chan *message.Message, out chan<- *message.Message) {
+	for {
+		select {
+		case <-s.fetchCtx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				log.Warnf("consumer: message channel closed for topic: %s", topic)
+				return
+			}
+			if !s.deliver(msg, out) {
+				return
+			}
+		}
+	}
+}
+
+// deliver hands msg to the router. It reports false if fetching stopped
+// first, leaving msg unacked so it is redelivered after a restart.
+func (s *streamSubscriber) deliver(msg *message.Message, out chan<- *message.Message) bool {
+	s.sub.state.recordReceived()
+
+	select {
+	case out <- msg:
+		return true
+	case <-s.fetchCtx.Done():
+		return false
+	}
+}
+
+// Close stops fetching for every stream; it is called by the router when it
+// starts closing.
+func (s *streamSubscriber) Close() error {
+	s.stopFetching()
+	s.closeOnce.Do(func() { close(s.closed) })
+	return nil
+}
+
+// admit is the claim gate of the stream's topics. It holds a message in its
+// partition claim while the stream is paused or held by the circuit
+// breaker, and until the stream's rate limit allows it. A message admitted
+// just before a pause is still processed.
+func (s *subscription) admit(ctx context.Context, _ *sarama.ConsumerMessage) error {
+	if err := s.state.waitUntilResumed(ctx); err != nil {
+		return err
+	}
+	if err := s.state.throttle(ctx); err != nil {
+		return err
+	}
+	// The stream may have been paused while waiting for the rate limit.
+	return s.state.waitUntilResumed(ctx)
+}
+
+// admitWhenDue is the claim gate of the stream's retry tiers. It holds each
+// message until its retry not-before time before admitting it; as the
+// claim of each partition waits on its own, a message only holds back its
+// own partition.
+func (s *subscription) admitWhenDue(ctx context.Context, msg *sarama.ConsumerMessage) error {
+	if err := waitUntil(ctx, retryNotBefore(msg)); err != nil {
+		return err
+	}
+	return s.admit(ctx, msg)
+}
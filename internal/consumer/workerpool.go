@@ -0,0 +1,143 @@
+package consumer
+
+import (
+	"errors"
+	"hash/fnv"
+	"strconv"
+	"sync"
+
+	"github.com/ThreeDotsLabs/watermill-kafka/v3/pkg/kafka"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+var errWorkerPoolClosed = errors.New("worker pool closed")
+
+// keyedWorkerPool runs a stream's router handler on a fixed set of workers,
+// keeping messages that share a key on the same worker so they are handled
+// in the order they were received. Each worker buffers up to queueDepth
+// messages; the router goroutine of a message waits for its worker to run
+// it, so acking, retries and dead-lettering stay per message.
+//
+// The Kafka subscriber only hands out the next message of a partition once
+// the previous one is acked or nacked, so the useful concurrency is bounded
+// by the number of partitions assigned to this instance.
+type keyedWorkerPool struct {
+	queues []chan *poolTask
+	stop   chan struct{}
+	wg     sync.WaitGroup
+
+	stopOnce sync.Once
+}
+
+type poolTask struct {
+	msg     *message.Message
+	handler message.HandlerFunc
+	done    chan poolResult
+}
+
+type poolResult struct {
+	produced []*message.Message
+	err      error
+}
+
+func newKeyedWorkerPool(concurrency, queueDepth int) *keyedWorkerPool {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	if queueDepth < 0 {
+		queueDepth = 0
+	}
+
+	p := &keyedWorkerPool{
+		queues: make([]chan *poolTask, concurrency),
+		stop:   make(chan struct{}),
+	}
+
+	for i := range p.queues {
+		queue := make(chan *poolTask, queueDepth)
+		p.queues[i] = queue
+
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for {
+				// Stopping wins over queued tasks.
+				select {
+				case <-p.stop:
+					return
+				default:
+				}
+				select {
+				case <-p.stop:
+					return
+				case task := <-queue:
+					task.run()
+				}
+			}
+		}()
+	}
+
+	return p
+}
+
+func (t *poolTask) run() {
+	if err := t.msg.Context().Err(); err != nil {
+		// Given up on while it was queued.
+		t.done <- poolResult{err: err}
+		return
+	}
+	produced, err := t.handler(t.msg)
+	t.done <- poolResult{produced: produced, err: err}
+}
+
+// Middleware runs the rest of the chain for each message on the worker
+// owning its key. It blocks while that worker's queue is full.
+func (p *keyedWorkerPool) Middleware(h message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		task := &poolTask{msg: msg, handler: h, done: make(chan poolResult, 1)}
+
+		select {
+		case p.queues[p.worker(msg)] <- task:
+		case <-msg.Context().Done():
+			return nil, msg.Context().Err()
+		case <-p.stop:
+			return nil, errWorkerPoolClosed
+		}
+
+		select {
+		case r := <-task.done:
+			return r.produced, r.err
+		case <-p.stop:
+			return nil, errWorkerPoolClosed
+		}
+	}
+}
+
+// Close stops the workers once the task each is running has finished.
+// Messages still queued are left unacked for redelivery.
+func (p *keyedWorkerPool) Close() {
+	p.stopOnce.Do(func() { close(p.stop) })
+	p.wg.Wait()
+}
+
+func (p *keyedWorkerPool) worker(msg *message.Message) int {
+	if len(p.queues) == 1 {
+		return 0
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write(orderingKey(msg))
+	return int(h.Sum32() % uint32(len(p.queues)))
+}
+
+// orderingKey returns the Kafka message key, falling back to the partition
+// and then the message UUID for unkeyed messages.
+func orderingKey(msg *message.Message) []byte {
+	if key, ok := kafka.MessageKeyFromCtx(msg.Context()); ok && len(key) > 0 {
+		return key
+	}
+	if partition, ok := kafka.MessagePartitionFromCtx(msg.Context()); ok {
+		return []byte(strconv.FormatInt(int64(partition), 10))
+	}
+	return []byte(msg.UUID)
+}
@@ -0,0 +1,112 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+func TestKeyedWorkerPoolRunsWorkersConcurrently(t *testing.T) {
+	pool := newKeyedWorkerPool(2, 0)
+	defer pool.Close()
+
+	// Find two messages owned by different workers.
+	first := message.NewMessage(watermill.NewUUID(), nil)
+	second := message.NewMessage(watermill.NewUUID(), nil)
+	for pool.worker(second) == pool.worker(first) {
+		second = message.NewMessage(watermill.NewUUID(), nil)
+	}
+
+	secondDone := make(chan struct{})
+	handler := pool.Middleware(func(msg *message.Message) ([]*message.Message, error) {
+		if msg == first {
+			<-secondDone
+		}
+		return nil, nil
+	})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, _ = handler(first)
+	}()
+
+	if _, err := handler(second); err != nil {
+		t.Fatalf("handle second: %v", err)
+	}
+	close(secondDone)
+	wg.Wait()
+}
+
+func TestKeyedWorkerPoolSameKeySameWorker(t *testing.T) {
+	pool := newKeyedWorkerPool(8, 0)
+	defer pool.Close()
+
+	msg := message.NewMessage(watermill.NewUUID(), nil)
+	first := pool.worker(msg)
+	for range 10 {
+		if got := pool.worker(msg); got != first {
+			t.Fatalf("worker = %d, want %d", got, first)
+		}
+	}
+}
+
+func TestKeyedWorkerPoolReturnsHandlerResult(t *testing.T) {
+	pool := newKeyedWorkerPool(1, 0)
+	defer pool.Close()
+
+	want := message.NewMessage("produced", nil)
+	handler := pool.Middleware(func(*message.Message) ([]*message.Message, error) {
+		return []*message.Message{want}, context.DeadlineExceeded
+	})
+
+	produced, err := handler(message.NewMessage(watermill.NewUUID(), nil))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if len(produced) != 1 || produced[0] != want {
+		t.Fatalf("produced = %v, want [%v]", produced, want)
+	}
+}
+
+func TestKeyedWorkerPoolCloseReleasesWaiters(t *testing.T) {
+	pool := newKeyedWorkerPool(1, 0)
+
+	started := make(chan struct{})
+	block := make(chan struct{})
+	handler := pool.Middleware(func(*message.Message) ([]*message.Message, error) {
+		close(started)
+		<-block
+		return nil, nil
+	})
+
+	go func() { _, _ = handler(message.NewMessage(watermill.NewUUID(), nil)) }()
+	<-started
+
+	queued := make(chan error, 1)
+	go func() {
+		_, err := handler(message.NewMessage(watermill.NewUUID(), nil))
+		queued <- err
+	}()
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		close(block)
+	}()
+	pool.Close()
+
+	select {
+	case err := <-queued:
+		if !errors.Is(err, errWorkerPoolClosed) {
+			t.Fatalf("err = %v, want %v", err, errWorkerPoolClosed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("queued message still waiting after Close")
+	}
+}
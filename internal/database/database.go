@@ -5,11 +5,13 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
+	"sync/atomic"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/gofiber/fiber/v2/log"
 	"github.com/jmoiron/sqlx"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/health"
 )
 
 var ErrConfigInvalid = errors.New("invalid database configuration")
@@ -17,6 +19,8 @@ var ErrConfigInvalid = errors.New("invalid database configuration")
 type Database struct {
 	*sqlx.DB
 	cfg *DBConfig
+	// lastPing is the unix nano time of the last successful ping.
+	lastPing atomic.Int64
 }
 
 type DBConfig struct {
@@ -73,17 +77,23 @@ func NewDatabase(ctx context.Context, cfg *DBConfig) (*Database, error) {
 
 	log.Info("database connection established successfully")
 
-	return &Database{
+	d := &Database{
 		DB:  db,
 		cfg: cfg,
-	}, nil
+	}
+	d.lastPing.Store(time.Now().UnixNano())
+	return d, nil
 }
 
 func (d *Database) Ping(ctx context.Context) error {
-	if d.DB != nil {
-		return d.DB.PingContext(ctx)
+	if d.DB == nil {
+		return errors.New("database connection is nil")
+	}
+	if err := d.DB.PingContext(ctx); err != nil {
+		return err
 	}
-	return errors.New("database connection is nil")
+	d.lastPing.Store(time.Now().UnixNano())
+	return nil
 }
 
 func (d *Database) Close() error {
@@ -113,6 +123,43 @@ func (d *Database) HealthCheck() error {
 	return nil
 }
 
+// HealthName implements health.Contributor.
+func (d *Database) HealthName() string {
+	return "database"
+}
+
+// Health implements health.Contributor by pinging the database.
+func (d *Database) Health(ctx context.Context) health.Report {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	report := health.Report{
+		State:   health.StateConnected,
+		Healthy: true,
+	}
+
+	if err := d.Ping(ctx); err != nil {
+		report.State = health.StateDisconnected
+		report.Healthy = false
+		report.Error = err.Error()
+	}
+	if last := d.lastPing.Load(); last > 0 {
+		report.LastSuccess = time.Unix(0, last)
+	}
+
+	if d.DB != nil {
+		stats := d.DB.Stats()
+		report.Details = map[string]any{
+			"host":             d.cfg.Host,
+			"open_connections": stats.OpenConnections,
+			"in_use":           stats.InUse,
+			"idle":             stats.Idle,
+		}
+	}
+
+	return report
+}
+
 func validateConfig(cfg *DBConfig) error {
 	if cfg == nil {
 		return errors.New("config is nil")
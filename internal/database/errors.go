@@ -0,0 +1,56 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// MySQL server error numbers that are worth retrying.
+const (
+	mysqlErrTooManyConnections = 1040
+	mysqlErrLockWaitTimeout    = 1205
+	mysqlErrDeadlock           = 1213
+	mysqlErrServerGone         = 2006
+	mysqlErrServerLost         = 2013
+)
+
+// IsTransientError reports whether err is a database failure that is likely
+// to succeed when the same operation is retried, such as a dropped
+// connection, a deadlock or a lock wait timeout.
+func IsTransientError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, mysql.ErrInvalidConn) {
+		return true
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		case mysqlErrTooManyConnections,
+			mysqlErrLockWaitTimeout,
+			mysqlErrDeadlock,
+			mysqlErrServerGone,
+			mysqlErrServerLost:
+			return true
+		}
+		return false
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
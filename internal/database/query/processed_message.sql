@@ -0,0 +1,12 @@
+-- name: InsertProcessedMessage :execrows
+INSERT IGNORE INTO processed_messages (stream, message_key, processed_at)
+VALUES (?, ?, NOW());
+
+-- name: DeleteProcessedMessage :exec
+DELETE FROM processed_messages
+WHERE stream = ? AND message_key = ?;
+
+-- name: DeleteProcessedMessagesBefore :execrows
+DELETE FROM processed_messages
+WHERE processed_at < ?
+LIMIT ?;
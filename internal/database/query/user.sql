@@ -10,11 +10,19 @@ LIMIT ? OFFSET ?;
 INSERT INTO users (name, uuid, description, status, created_at, updated_at)
 VALUES (?, ?, ?, ?, NOW(), NOW());
 
+-- name: GetUsersByUUIDs :many
+SELECT * FROM users WHERE uuid IN (sqlc.slice('uuids'));
+
 -- name: UpdateUser :exec
 UPDATE users
 SET name = ?, description = ?, status = ?, updated_at = NOW()
 WHERE uuid = ?;
 
+-- name: UpdateUsersStatus :exec
+UPDATE users
+SET status = ?, updated_at = NOW()
+WHERE uuid IN (sqlc.slice('uuids'));
+
 -- name: DeleteUser :exec
 DELETE FROM users WHERE id = ?;
 
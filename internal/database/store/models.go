@@ -6,8 +6,16 @@ package store
 
 import (
 	"database/sql"
+	"time"
 )
 
+type ProcessedMessage struct {
+	ID          int64     `db:"id" json:"id"`
+	Stream      string    `db:"stream" json:"stream"`
+	MessageKey  string    `db:"message_key" json:"message_key"`
+	ProcessedAt time.Time `db:"processed_at" json:"processed_at"`
+}
+
 type User struct {
 	ID          int64          `db:"id" json:"id"`
 	Uuid        string         `db:"uuid" json:"uuid"`
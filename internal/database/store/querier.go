@@ -12,11 +12,16 @@ import (
 type Querier interface {
 	CountUsers(ctx context.Context, db DBTX) (int64, error)
 	CreateUser(ctx context.Context, db DBTX, arg CreateUserParams) (sql.Result, error)
+	DeleteProcessedMessage(ctx context.Context, db DBTX, arg DeleteProcessedMessageParams) error
+	DeleteProcessedMessagesBefore(ctx context.Context, db DBTX, arg DeleteProcessedMessagesBeforeParams) (int64, error)
 	DeleteUser(ctx context.Context, db DBTX, id int64) error
 	GetUserByUUID(ctx context.Context, db DBTX, uuid string) (*User, error)
 	GetUsersByStatus(ctx context.Context, db DBTX, status string) ([]*User, error)
+	GetUsersByUUIDs(ctx context.Context, db DBTX, uuids []string) ([]*User, error)
+	InsertProcessedMessage(ctx context.Context, db DBTX, arg InsertProcessedMessageParams) (int64, error)
 	ListUsers(ctx context.Context, db DBTX, arg ListUsersParams) ([]*User, error)
 	UpdateUser(ctx context.Context, db DBTX, arg UpdateUserParams) error
+	UpdateUsersStatus(ctx context.Context, db DBTX, arg UpdateUsersStatusParams) error
 }
 
 var _ Querier = (*Queries)(nil)
@@ -8,6 +8,7 @@ package store
 import (
 	"context"
 	"database/sql"
+	"strings"
 )
 
 const countUsers = `-- name: CountUsers :one
@@ -107,6 +108,51 @@ func (q *Queries) GetUsersByStatus(ctx context.Context, db DBTX, status string)
 	return items, nil
 }
 
+const getUsersByUUIDs = `-- name: GetUsersByUUIDs :many
+SELECT id, uuid, name, description, status, created_at, updated_at FROM users WHERE uuid IN (/*SLICE:uuids*/?)
+`
+
+func (q *Queries) GetUsersByUUIDs(ctx context.Context, db DBTX, uuids []string) ([]*User, error) {
+	query := getUsersByUUIDs
+	var queryParams []interface{}
+	if len(uuids) > 0 {
+		for _, v := range uuids {
+			queryParams = append(queryParams, v)
+		}
+		query = strings.Replace(query, "/*SLICE:uuids*/?", strings.Repeat(",?", len(uuids))[1:], 1)
+	} else {
+		query = strings.Replace(query, "/*SLICE:uuids*/?", "NULL", 1)
+	}
+	rows, err := db.QueryContext(ctx, query, queryParams...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []*User{}
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.Uuid,
+			&i.Name,
+			&i.Description,
+			&i.Status,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listUsers = `-- name: ListUsers :many
 SELECT id, uuid, name, description, status, created_at, updated_at FROM users
 ORDER BY created_at DESC
@@ -171,3 +217,30 @@ func (q *Queries) UpdateUser(ctx context.Context, db DBTX, arg UpdateUserParams)
 	)
 	return err
 }
+
+const updateUsersStatus = `-- name: UpdateUsersStatus :exec
+UPDATE users
+SET status = ?, updated_at = NOW()
+WHERE uuid IN (/*SLICE:uuids*/?)
+`
+
+type UpdateUsersStatusParams struct {
+	Status string   `db:"status" json:"status"`
+	Uuids  []string `db:"uuids" json:"uuids"`
+}
+
+func (q *Queries) UpdateUsersStatus(ctx context.Context, db DBTX, arg UpdateUsersStatusParams) error {
+	query := updateUsersStatus
+	var queryParams []interface{}
+	queryParams = append(queryParams, arg.Status)
+	if len(arg.Uuids) > 0 {
+		for _, v := range arg.Uuids {
+			queryParams = append(queryParams, v)
+		}
+		query = strings.Replace(query, "/*SLICE:uuids*/?", strings.Repeat(",?", len(arg.Uuids))[1:], 1)
+	} else {
+		query = strings.Replace(query, "/*SLICE:uuids*/?", "NULL", 1)
+	}
+	_, err := db.ExecContext(ctx, query, queryParams...)
+	return err
+}
@@ -0,0 +1,55 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/jmoiron/sqlx"
+)
+
+type txContextKey struct{}
+
+// TxFromContext returns the transaction started by WithTx, if any.
+// Repositories use it so that writes made while handling a message join the
+// caller's transaction.
+func TxFromContext(ctx context.Context) (*sqlx.Tx, bool) {
+	tx, ok := ctx.Value(txContextKey{}).(*sqlx.Tx)
+	return tx, ok
+}
+
+// WithTx runs fn inside a transaction carried by the context passed to fn.
+// The transaction is committed if fn returns nil and rolled back otherwise.
+// If ctx already carries a transaction, fn joins it instead of starting a
+// new one.
+func (d *Database) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := TxFromContext(ctx); ok {
+		return fn(ctx)
+	}
+
+	tx, err := d.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(context.WithValue(ctx, txContextKey{}, tx)); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			log.Errorw("database transaction rollback failed",
+				"error", rollbackErr)
+		}
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+
+	return nil
+}
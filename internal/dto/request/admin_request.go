@@ -0,0 +1,8 @@
+package request
+
+// UpdateRateLimitRequest replaces a stream's rate limit. A zero per_second
+// removes the limit.
+type UpdateRateLimitRequest struct {
+	PerSecond float64 `json:"per_second" validate:"min=0"`
+	Burst     int     `json:"burst" validate:"min=0"`
+}
@@ -0,0 +1,53 @@
+package response
+
+import "time"
+
+type StreamStatusResponse struct {
+	Name          string     `json:"name"`
+	Topic         string     `json:"topic"`
+	State         string     `json:"state"`
+	LastMessageAt *time.Time `json:"last_message_at"`
+	Processed     uint64     `json:"processed"`
+	Failed        uint64     `json:"failed"`
+	Retried       uint64     `json:"retried"`
+	// Throughput is in messages per second.
+	Throughput      float64           `json:"throughput"`
+	RateLimit       RateLimitResponse `json:"rate_limit"`
+	Throttled       uint64            `json:"throttled"`
+	ThrottledWaitMs int64             `json:"throttled_wait_ms"`
+	TimedOut        uint64            `json:"timed_out"`
+	Panics          uint64            `json:"panics"`
+}
+
+type RateLimitResponse struct {
+	PerSecond float64 `json:"per_second"`
+	Burst     int     `json:"burst"`
+}
+
+type StreamListResponse struct {
+	Streams []StreamStatusResponse `json:"streams"`
+}
+
+type PartitionLagResponse struct {
+	Partition       int32 `json:"partition"`
+	CommittedOffset int64 `json:"committed_offset"`
+	HighWaterMark   int64 `json:"high_water_mark"`
+	Lag             int64 `json:"lag"`
+}
+
+type TopicLagResponse struct {
+	Topic      string                 `json:"topic"`
+	TotalLag   int64                  `json:"total_lag"`
+	Partitions []PartitionLagResponse `json:"partitions"`
+}
+
+type ConsumerLagResponse struct {
+	ConsumerGroup     string             `json:"consumer_group"`
+	TotalLag          int64              `json:"total_lag"`
+	Threshold         int64              `json:"threshold"`
+	ThresholdExceeded bool               `json:"threshold_exceeded"`
+	CheckedAt         *time.Time         `json:"checked_at"`
+	Topics            []TopicLagResponse `json:"topics"`
+	Error             string             `json:"error,omitempty"`
+	FailedChecks      int                `json:"failed_checks,omitempty"`
+}
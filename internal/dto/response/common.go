@@ -52,6 +52,7 @@ type HealthResponse struct {
 type ServiceHealth struct {
 	Status  string `json:"status"`
 	Message string `json:"message,omitempty"`
+	Details any    `json:"details,omitempty"`
 }
 
 type SuccessResponse struct {
@@ -2,7 +2,21 @@ package stream
 
 import "time"
 
+// User lifecycle event types
+const (
+	UserEventCreated     = "user.created"
+	UserEventUpdated     = "user.updated"
+	UserEventDeactivated = "user.deactivated"
+	UserEventArchived    = "user.archived"
+)
+
 type UserLifeCycleStream struct {
+	// Version is the event version, UserLifeCycleStreamVersion for events
+	// built by this service. Consumed payloads of older versions are
+	// upcast by UserLifeCycleVersions before they are decoded.
+	Version int `json:"version"`
+	// EventType is used when the message has no event_type header.
+	EventType   string    `json:"event_type,omitempty"`
 	UUID        string    `json:"uuid"`
 	Name        string    `json:"name"`
 	Description string    `json:"description"`
@@ -10,3 +24,14 @@ type UserLifeCycleStream struct {
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
+
+// CloudEventType implements cloudevents.Describer.
+func (s UserLifeCycleStream) CloudEventType() string {
+	return s.EventType
+}
+
+// CloudEventSubject implements cloudevents.Describer; the subject of a
+// user lifecycle event is the user.
+func (s UserLifeCycleStream) CloudEventSubject() string {
+	return s.UUID
+}
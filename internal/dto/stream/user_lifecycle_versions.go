@@ -0,0 +1,38 @@
+package stream
+
+import (
+	"strconv"
+
+	"github.com/muazwzxv/kafka-consumer-worker/internal/entity"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/versioning"
+)
+
+// UserLifeCycleStreamVersion is the current version of UserLifeCycleStream.
+const UserLifeCycleStreamVersion = 2
+
+// UserLifeCycleVersions converts user lifecycle payloads between versions:
+//   - 1: the unversioned payload. event_type is optional; messages
+//     published before event types existed only carry a status.
+//   - 2: adds the version field and always sets event_type.
+var UserLifeCycleVersions = versioning.NewChain("user_lifecycle").
+	Add(upcastUserLifecycleV1, nil)
+
+// upcastUserLifecycleV1 fills in the event type of version 1 payloads
+// without one: a pending_activation status means the user was just
+// created. Other statuses are left without an event type.
+func upcastUserLifecycleV1(payload map[string]any) error {
+	if eventType, _ := payload["event_type"].(string); eventType != "" {
+		return nil
+	}
+	if status, _ := payload["status"].(string); status == entity.UserStatusPending.String() {
+		payload["event_type"] = UserEventCreated
+	}
+	return nil
+}
+
+func init() {
+	if current := UserLifeCycleVersions.Current(); current != UserLifeCycleStreamVersion {
+		panic("stream: UserLifeCycleVersions ends at version " + strconv.Itoa(current) +
+			", UserLifeCycleStreamVersion is " + strconv.Itoa(UserLifeCycleStreamVersion))
+	}
+}
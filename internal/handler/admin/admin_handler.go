@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/config"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/consumer"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/dto/response"
+	"github.com/samber/do/v2"
+)
+
+type StreamController interface {
+	Streams() []consumer.StreamStatus
+	PauseStream(name string) (consumer.StreamStatus, error)
+	ResumeStream(name string) (consumer.StreamStatus, error)
+	SetStreamRateLimit(name string, limit config.RateLimitConfig) (consumer.StreamStatus, error)
+}
+
+type LagReporter interface {
+	Lag() (consumer.LagReport, error)
+}
+
+type AdminHandler struct {
+	streams StreamController
+	lag     LagReporter
+	token   string
+}
+
+func NewAdminHandler(i do.Injector) (*AdminHandler, error) {
+	c := do.MustInvoke[*consumer.Consumer](i)
+	cfg := do.MustInvoke[*config.Config](i)
+
+	return &AdminHandler{
+		streams: c,
+		lag:     c,
+		token:   cfg.Admin.Token,
+	}, nil
+}
+
+func (h *AdminHandler) RegisterRoutes(app *fiber.App) {
+	admin := app.Group("/admin")
+	admin.Get("/streams", h.ListStreams)
+	admin.Post("/streams/:name/pause", h.requireToken, h.PauseStream)
+	admin.Post("/streams/:name/resume", h.requireToken, h.ResumeStream)
+	admin.Put("/streams/:name/rate_limit", h.requireToken, h.SetStreamRateLimit)
+	admin.Get("/consumer/lag", h.ConsumerLag)
+}
+
+// requireToken only lets requests carrying the configured admin token
+// through. Without a configured token every request is refused.
+func (h *AdminHandler) requireToken(c *fiber.Ctx) error {
+	if h.token == "" {
+		return response.HandleError(c, response.BuildErrorWithCode(
+			fiber.StatusForbidden,
+			"Admin mutations are disabled: admin.token is not set",
+			"ADMIN_DISABLED",
+		))
+	}
+
+	token, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+		log.WithContext(c.UserContext()).Warnw("rejected admin request",
+			"method", c.Method(),
+			"path", c.Path(),
+			"ip", c.IP())
+		return response.HandleError(c, response.BuildErrorWithCode(
+			fiber.StatusUnauthorized,
+			"Missing or invalid admin token",
+			"UNAUTHORIZED",
+		))
+	}
+
+	return c.Next()
+}
@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/consumer"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/dto/response"
+)
+
+func (h *AdminHandler) ConsumerLag(c *fiber.Ctx) error {
+	report, err := h.lag.Lag()
+	if errors.Is(err, consumer.ErrLagNotAvailable) {
+		return response.HandleError(c, response.BuildErrorWithCode(
+			fiber.StatusServiceUnavailable,
+			"Consumer lag not available yet",
+			"LAG_NOT_AVAILABLE",
+		))
+	}
+
+	resp := toConsumerLagResponse(report)
+	if err != nil {
+		// Serve the last good snapshot alongside the refresh error.
+		log.WithContext(c.UserContext()).Warnw("consumer lag check failed",
+			"error", err)
+		resp.Error = err.Error()
+	}
+
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
+
+func toConsumerLagResponse(report consumer.LagReport) response.ConsumerLagResponse {
+	resp := response.ConsumerLagResponse{
+		ConsumerGroup:     report.ConsumerGroup,
+		TotalLag:          report.TotalLag,
+		Threshold:         report.Threshold,
+		ThresholdExceeded: report.ThresholdExceeded(),
+		FailedChecks:      report.FailedChecks,
+		Topics:            make([]response.TopicLagResponse, 0, len(report.Topics)),
+	}
+	if !report.CheckedAt.IsZero() {
+		checkedAt := report.CheckedAt
+		resp.CheckedAt = &checkedAt
+	}
+
+	for _, topic := range report.Topics {
+		topicResp := response.TopicLagResponse{
+			Topic:      topic.Topic,
+			TotalLag:   topic.TotalLag,
+			Partitions: make([]response.PartitionLagResponse, 0, len(topic.Partitions)),
+		}
+		for _, partition := range topic.Partitions {
+			topicResp.Partitions = append(topicResp.Partitions, response.PartitionLagResponse{
+				Partition:       partition.Partition,
+				CommittedOffset: partition.CommittedOffset,
+				HighWaterMark:   partition.HighWaterMark,
+				Lag:             partition.Lag,
+			})
+		}
+		resp.Topics = append(resp.Topics, topicResp)
+	}
+
+	return resp
+}
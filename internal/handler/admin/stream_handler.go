@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/config"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/consumer"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/dto/request"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/dto/response"
+)
+
+func (h *AdminHandler) ListStreams(c *fiber.Ctx) error {
+	statuses := h.streams.Streams()
+
+	resp := response.StreamListResponse{
+		Streams: make([]response.StreamStatusResponse, 0, len(statuses)),
+	}
+	for _, status := range statuses {
+		resp.Streams = append(resp.Streams, toStreamStatusResponse(status))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
+
+func (h *AdminHandler) PauseStream(c *fiber.Ctx) error {
+	logger := log.WithContext(c.UserContext())
+	name := c.Params("name")
+
+	logger.Infow("pausing stream",
+		"stream", name,
+		"ip", c.IP())
+
+	status, err := h.streams.PauseStream(name)
+	if err != nil {
+		return handleStreamError(c, name, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(toStreamStatusResponse(status))
+}
+
+func (h *AdminHandler) ResumeStream(c *fiber.Ctx) error {
+	logger := log.WithContext(c.UserContext())
+	name := c.Params("name")
+
+	logger.Infow("resuming stream",
+		"stream", name,
+		"ip", c.IP())
+
+	status, err := h.streams.ResumeStream(name)
+	if err != nil {
+		return handleStreamError(c, name, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(toStreamStatusResponse(status))
+}
+
+func (h *AdminHandler) SetStreamRateLimit(c *fiber.Ctx) error {
+	logger := log.WithContext(c.UserContext())
+	name := c.Params("name")
+
+	var req request.UpdateRateLimitRequest
+	if err := c.BodyParser(&req); err != nil {
+		logger.Warnw("invalid request body",
+			"error", err,
+			"path", c.Path(),
+			"ip", c.IP())
+		return response.HandleError(c, response.BuildErrorWithCode(
+			fiber.StatusBadRequest,
+			"Invalid request body",
+			"INVALID_REQUEST_BODY",
+		))
+	}
+
+	logger.Infow("setting stream rate limit",
+		"stream", name,
+		"per_second", req.PerSecond,
+		"burst", req.Burst,
+		"ip", c.IP())
+
+	status, err := h.streams.SetStreamRateLimit(name, config.RateLimitConfig{
+		PerSecond: req.PerSecond,
+		Burst:     req.Burst,
+	})
+	if err != nil {
+		return handleStreamError(c, name, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(toStreamStatusResponse(status))
+}
+
+func handleStreamError(c *fiber.Ctx, name string, err error) error {
+	if errors.Is(err, consumer.ErrStreamNotFound) {
+		log.WithContext(c.UserContext()).Warnw("stream not found",
+			"stream", name)
+		return response.HandleError(c, response.BuildErrorWithCode(
+			fiber.StatusNotFound,
+			"Stream not found: "+name,
+			response.NotFound,
+		))
+	}
+	if errors.Is(err, consumer.ErrInvalidRateLimit) {
+		return response.HandleError(c, response.BuildErrorWithCode(
+			fiber.StatusBadRequest,
+			err.Error(),
+			response.BadRequest,
+		))
+	}
+
+	return response.HandleError(c, err)
+}
+
+func toStreamStatusResponse(status consumer.StreamStatus) response.StreamStatusResponse {
+	resp := response.StreamStatusResponse{
+		Name:       status.Name,
+		Topic:      status.Topic,
+		State:      status.State,
+		Processed:  status.Processed,
+		Failed:     status.Failed,
+		Retried:    status.Retried,
+		Throughput: status.Throughput,
+		RateLimit: response.RateLimitResponse{
+			PerSecond: status.RateLimit.PerSecond,
+			Burst:     status.RateLimit.Burst,
+		},
+		Throttled:       status.Throttled,
+		ThrottledWaitMs: status.ThrottledWait.Milliseconds(),
+		TimedOut:        status.TimedOut,
+		Panics:          status.Panics,
+	}
+	if !status.LastMessageAt.IsZero() {
+		lastMessageAt := status.LastMessageAt
+		resp.LastMessageAt = &lastMessageAt
+	}
+	return resp
+}
@@ -1,31 +1,57 @@
 package handler
 
 import (
-	"context"
+	"fmt"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/log"
-	"github.com/samber/do/v2"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/config"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/consumer"
 	"github.com/muazwzxv/kafka-consumer-worker/internal/database"
 	"github.com/muazwzxv/kafka-consumer-worker/internal/dto/response"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/health"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/publisher"
+	"github.com/samber/do/v2"
 )
 
-type DatabaseService interface {
-	Ping(ctx context.Context) error
-}
-
 type HealthHandler struct {
-	dbService DatabaseService
-	version   string
+	contributors []health.Contributor
+	critical     map[string]bool
+	version      string
 }
 
 func NewHealthHandler(i do.Injector) (*HealthHandler, error) {
+	cfg := do.MustInvoke[*config.Config](i)
 	db := do.MustInvoke[*database.Database](i)
+	c := do.MustInvoke[*consumer.Consumer](i)
+	userLifecyclePublisher := do.MustInvoke[*publisher.UserLifecyclePublisher](i)
+
+	contributors := []health.Contributor{
+		db,
+		c,
+		c.LagHealth(),
+		c.CircuitBreakerHealth(),
+		c.StreamPublisherHealth(),
+		userLifecyclePublisher,
+	}
+
+	known := make(map[string]bool, len(contributors))
+	for _, contributor := range contributors {
+		known[contributor.HealthName()] = true
+	}
+	critical := make(map[string]bool, len(cfg.Health.Critical))
+	for _, name := range cfg.Health.Critical {
+		if !known[name] {
+			return nil, fmt.Errorf("health: unknown critical contributor %q", name)
+		}
+		critical[name] = true
+	}
 
 	return &HealthHandler{
-		dbService: db,
-		version:   "1.0.0", // TODO: Make configurable via config
+		contributors: contributors,
+		critical:     critical,
+		version:      "1.0.0", // TODO: Make configurable via config
 	}, nil
 }
 
@@ -47,21 +73,20 @@ func (h *HealthHandler) HealthCheck(c *fiber.Ctx) error {
 		Services:  make(map[string]response.ServiceHealth),
 	}
 
-	if h.dbService != nil {
-		if err := h.dbService.Ping(c.Context()); err != nil {
-			logger.Warnw("health check database ping failed",
-				"error", err)
-			healthResp.Services["database"] = response.ServiceHealth{
-				Status:  "unhealthy",
-				Message: "Database connection failed: " + err.Error(),
-			}
-			healthResp.Status = "degraded"
-		} else {
-			healthResp.Services["database"] = response.ServiceHealth{
-				Status:  "healthy",
-				Message: "Connected",
+	for _, contributor := range h.contributors {
+		name := contributor.HealthName()
+		report := contributor.Health(c.UserContext())
+		if !report.Healthy {
+			logger.Warnw("health check contributor unhealthy",
+				"service", name,
+				"state", report.State,
+				"critical", h.critical[name],
+				"error", report.Error)
+			if h.critical[name] {
+				healthResp.Status = "degraded"
 			}
 		}
+		healthResp.Services[name] = toServiceHealth(report, h.critical[name])
 	}
 
 	statusCode := fiber.StatusOK
@@ -73,11 +98,15 @@ func (h *HealthHandler) HealthCheck(c *fiber.Ctx) error {
 }
 
 func (h *HealthHandler) ReadinessCheck(c *fiber.Ctx) error {
-	if h.dbService != nil {
-		if err := h.dbService.Ping(c.Context()); err != nil {
+	for _, contributor := range h.contributors {
+		name := contributor.HealthName()
+		if !h.critical[name] {
+			continue
+		}
+		if report := contributor.Health(c.UserContext()); !report.Healthy {
 			return response.HandleError(c, response.BuildErrorWithCode(
 				fiber.StatusServiceUnavailable,
-				"Service not ready: database unavailable",
+				fmt.Sprintf("Service not ready: %s %s: %s", name, report.State, report.Error),
 				"SERVICE_UNAVAILABLE",
 			))
 		}
@@ -89,6 +118,35 @@ func (h *HealthHandler) ReadinessCheck(c *fiber.Ctx) error {
 	})
 }
 
+// toServiceHealth reports a contributor's health, marking whether it is
+// critical to readiness.
+func toServiceHealth(report health.Report, critical bool) response.ServiceHealth {
+	details := fiber.Map{
+		"state":    report.State,
+		"critical": critical,
+	}
+	if !report.LastSuccess.IsZero() {
+		details["last_success"] = report.LastSuccess
+	}
+	if report.Error != "" {
+		details["error"] = report.Error
+	}
+	for key, value := range report.Details {
+		details[key] = value
+	}
+
+	service := response.ServiceHealth{
+		Status:  "healthy",
+		Message: report.State,
+		Details: details,
+	}
+	if !report.Healthy {
+		service.Status = "unhealthy"
+		service.Message = report.State + ": " + report.Error
+	}
+	return service
+}
+
 func (h *HealthHandler) LivenessCheck(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{
 		"status": "alive",
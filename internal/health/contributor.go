@@ -0,0 +1,42 @@
+// Package health defines how components report their health to the
+// /health and /health/ready endpoints.
+package health
+
+import (
+	"context"
+	"time"
+)
+
+// Connection states reported by contributors.
+const (
+	StateConnected    = "connected"
+	StateConnecting   = "connecting"
+	StateDisconnected = "disconnected"
+	// StateIdle is a contributor that has not needed a connection yet.
+	StateIdle     = "idle"
+	StateDisabled = "disabled"
+	StateStopped  = "stopped"
+)
+
+// Report is a contributor's view of its own health.
+type Report struct {
+	State   string
+	Healthy bool
+	// LastSuccess is the last time the contributor did useful work against
+	// its backend, such as a successful ping, publish or consumed message.
+	LastSuccess time.Time
+	// Error describes the latest failure while unhealthy.
+	Error   string
+	Details map[string]any
+}
+
+// Contributor is a component whose health is reported under /health
+// services. Contributors listed as critical in config fail readiness while
+// unhealthy; the rest are informational.
+type Contributor interface {
+	// HealthName is the key the contributor is reported under.
+	HealthName() string
+	// Health reports the contributor's current health. It must return
+	// promptly, bounding any backend round trip by ctx.
+	Health(ctx context.Context) Report
+}
@@ -0,0 +1,205 @@
+// Package kafkaclient builds the sarama configuration every Kafka client in
+// the service shares: the consumer's subscriber and stream publisher, the
+// service publishers, the lag monitor and the replay command.
+package kafkaclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/IBM/sarama"
+	"github.com/ThreeDotsLabs/watermill-kafka/v3/pkg/kafka"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/config"
+)
+
+// SASL mechanisms accepted in KafkaSASLConfig.Mechanism.
+const (
+	MechanismPlain       = "PLAIN"
+	MechanismSCRAMSHA256 = "SCRAM-SHA-256"
+	MechanismSCRAMSHA512 = "SCRAM-SHA-512"
+)
+
+// SubscriberConfig returns Watermill's default subscriber config with the
+// connection settings of cfg applied.
+func SubscriberConfig(cfg config.KafkaConfig) (*sarama.Config, error) {
+	saramaConfig := kafka.DefaultSaramaSubscriberConfig()
+	if err := applyGroup(saramaConfig, cfg.Group); err != nil {
+		return nil, fmt.Errorf("kafka group: %w", err)
+	}
+	if err := Apply(saramaConfig, cfg); err != nil {
+		return nil, err
+	}
+	return saramaConfig, nil
+}
+
+// Initial offsets accepted in ConsumerGroupConfig.InitialOffset.
+const (
+	InitialOffsetOldest = "oldest"
+	InitialOffsetNewest = "newest"
+)
+
+// Rebalance strategies accepted in ConsumerGroupConfig.RebalanceStrategy.
+const (
+	StrategyRange      = "range"
+	StrategyRoundRobin = "roundrobin"
+	StrategySticky     = "sticky"
+)
+
+// PublisherConfig returns Watermill's default sync publisher config with
+// the connection settings of cfg applied.
+func PublisherConfig(cfg config.KafkaConfig) (*sarama.Config, error) {
+	saramaConfig := kafka.DefaultSaramaSyncPublisherConfig()
+	if err := Apply(saramaConfig, cfg); err != nil {
+		return nil, err
+	}
+	return saramaConfig, nil
+}
+
+// Apply sets the client ID, Kafka version, dial timeouts, TLS and SASL of
+// cfg on saramaConfig. Unset values keep sarama's defaults.
+func Apply(saramaConfig *sarama.Config, cfg config.KafkaConfig) error {
+	if cfg.ClientID != "" {
+		saramaConfig.ClientID = cfg.ClientID
+	}
+
+	if cfg.Version != "" {
+		version, err := sarama.ParseKafkaVersion(cfg.Version)
+		if err != nil {
+			return fmt.Errorf("kafka version: %w", err)
+		}
+		saramaConfig.Version = version
+	}
+
+	if cfg.DialTimeout > 0 {
+		saramaConfig.Net.DialTimeout = cfg.DialTimeout
+	}
+	if cfg.ReadTimeout > 0 {
+		saramaConfig.Net.ReadTimeout = cfg.ReadTimeout
+	}
+	if cfg.WriteTimeout > 0 {
+		saramaConfig.Net.WriteTimeout = cfg.WriteTimeout
+	}
+
+	if cfg.TLS.Enable {
+		tlsConfig, err := newTLSConfig(cfg.TLS)
+		if err != nil {
+			return fmt.Errorf("kafka tls: %w", err)
+		}
+		saramaConfig.Net.TLS.Enable = true
+		saramaConfig.Net.TLS.Config = tlsConfig
+	}
+
+	if cfg.SASL.Enable {
+		if err := applySASL(saramaConfig, cfg.SASL); err != nil {
+			return fmt.Errorf("kafka sasl: %w", err)
+		}
+	}
+
+	if err := saramaConfig.Validate(); err != nil {
+		return fmt.Errorf("kafka config: %w", err)
+	}
+	return nil
+}
+
+func newTLSConfig(cfg config.KafkaTLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// Only for local clusters with self-signed certificates.
+		InsecureSkipVerify: cfg.InsecureSkipVerify, //nolint:gosec
+	}
+
+	if cfg.CAFile != "" {
+		ca, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ca file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in ca file %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	switch {
+	case cfg.CertFile != "" && cfg.KeyFile != "":
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	case cfg.CertFile != "" || cfg.KeyFile != "":
+		return nil, errors.New("cert_file and key_file must be set together")
+	}
+
+	return tlsConfig, nil
+}
+
+func applySASL(saramaConfig *sarama.Config, cfg config.KafkaSASLConfig) error {
+	if cfg.Username == "" {
+		return errors.New("username is required")
+	}
+
+	saramaConfig.Net.SASL.Enable = true
+	saramaConfig.Net.SASL.Handshake = true
+	saramaConfig.Net.SASL.User = cfg.Username
+	saramaConfig.Net.SASL.Password = cfg.Password
+
+	switch strings.ToUpper(cfg.Mechanism) {
+	case "", MechanismPlain:
+		saramaConfig.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+	case MechanismSCRAMSHA256:
+		saramaConfig.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
+		saramaConfig.Net.SASL.SCRAMClientGeneratorFunc = newSCRAMSHA256Client
+	case MechanismSCRAMSHA512:
+		saramaConfig.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
+		saramaConfig.Net.SASL.SCRAMClientGeneratorFunc = newSCRAMSHA512Client
+	default:
+		return fmt.Errorf("unknown mechanism %q (valid: %s, %s, %s)",
+			cfg.Mechanism, MechanismPlain, MechanismSCRAMSHA256, MechanismSCRAMSHA512)
+	}
+
+	return nil
+}
+
+func applyGroup(saramaConfig *sarama.Config, cfg config.ConsumerGroupConfig) error {
+	switch strings.ToLower(cfg.InitialOffset) {
+	case "", InitialOffsetNewest:
+		saramaConfig.Consumer.Offsets.Initial = sarama.OffsetNewest
+	case InitialOffsetOldest:
+		saramaConfig.Consumer.Offsets.Initial = sarama.OffsetOldest
+	default:
+		return fmt.Errorf("unknown initial_offset %q (valid: %s, %s)",
+			cfg.InitialOffset, InitialOffsetOldest, InitialOffsetNewest)
+	}
+
+	if cfg.AutoCommitInterval > 0 {
+		saramaConfig.Consumer.Offsets.AutoCommit.Interval = cfg.AutoCommitInterval
+	}
+	if cfg.SessionTimeout > 0 {
+		saramaConfig.Consumer.Group.Session.Timeout = cfg.SessionTimeout
+	}
+	if cfg.HeartbeatInterval > 0 {
+		saramaConfig.Consumer.Group.Heartbeat.Interval = cfg.HeartbeatInterval
+	}
+	if cfg.RebalanceTimeout > 0 {
+		saramaConfig.Consumer.Group.Rebalance.Timeout = cfg.RebalanceTimeout
+	}
+
+	switch strings.ToLower(cfg.RebalanceStrategy) {
+	case "", StrategyRange:
+		saramaConfig.Consumer.Group.Rebalance.GroupStrategies = []sarama.BalanceStrategy{sarama.NewBalanceStrategyRange()}
+	case StrategyRoundRobin:
+		saramaConfig.Consumer.Group.Rebalance.GroupStrategies = []sarama.BalanceStrategy{sarama.NewBalanceStrategyRoundRobin()}
+	case StrategySticky:
+		saramaConfig.Consumer.Group.Rebalance.GroupStrategies = []sarama.BalanceStrategy{sarama.NewBalanceStrategySticky()}
+	default:
+		return fmt.Errorf("unknown rebalance_strategy %q (valid: %s, %s, %s)",
+			cfg.RebalanceStrategy, StrategyRange, StrategyRoundRobin, StrategySticky)
+	}
+
+	return nil
+}
@@ -0,0 +1,40 @@
+package kafkaclient
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+
+	"github.com/IBM/sarama"
+	"github.com/xdg-go/scram"
+)
+
+// scramClient implements sarama.SCRAMClient on top of xdg-go/scram.
+type scramClient struct {
+	hashGenerator scram.HashGeneratorFcn
+	conversation  *scram.ClientConversation
+}
+
+func newSCRAMSHA256Client() sarama.SCRAMClient {
+	return &scramClient{hashGenerator: sha256.New}
+}
+
+func newSCRAMSHA512Client() sarama.SCRAMClient {
+	return &scramClient{hashGenerator: sha512.New}
+}
+
+func (c *scramClient) Begin(userName, password, authzID string) error {
+	client, err := c.hashGenerator.NewClient(userName, password, authzID)
+	if err != nil {
+		return err
+	}
+	c.conversation = client.NewConversation()
+	return nil
+}
+
+func (c *scramClient) Step(challenge string) (string, error) {
+	return c.conversation.Step(challenge)
+}
+
+func (c *scramClient) Done() bool {
+	return c.conversation.Done()
+}
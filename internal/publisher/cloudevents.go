@@ -0,0 +1,76 @@
+package publisher
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/cloudevents"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/config"
+)
+
+// cloudEventer turns published messages into CloudEvents.
+type cloudEventer struct {
+	mode        string
+	source      string
+	contentType string
+}
+
+// newCloudEventer returns nil when cfg is disabled. contentType is the
+// datacontenttype of the publisher's encoding.
+func newCloudEventer(cfg config.CloudEventsConfig, contentType string) (*cloudEventer, error) {
+	if !cfg.Enable {
+		return nil, nil
+	}
+
+	switch cfg.Mode {
+	case cloudevents.ModeBinary, cloudevents.ModeStructured:
+	default:
+		return nil, fmt.Errorf("unknown cloudevents mode %q (valid: %s, %s)",
+			cfg.Mode, cloudevents.ModeBinary, cloudevents.ModeStructured)
+	}
+	if cfg.Source == "" {
+		return nil, fmt.Errorf("cloudevents source is not set")
+	}
+
+	return &cloudEventer{
+		mode:        cfg.Mode,
+		source:      cfg.Source,
+		contentType: contentType,
+	}, nil
+}
+
+// wrap makes msg, carrying the serialized payload, a CloudEvent. In
+// structured mode the payload is replaced by the envelope.
+func (c *cloudEventer) wrap(msg *message.Message, payload any) error {
+	describer, ok := payload.(cloudevents.Describer)
+	if !ok {
+		return fmt.Errorf("payload %T does not implement cloudevents.Describer", payload)
+	}
+
+	event := cloudevents.Event{
+		ID:              msg.UUID,
+		Source:          c.source,
+		Type:            describer.CloudEventType(),
+		SpecVersion:     cloudevents.SpecVersion,
+		Time:            time.Now().UTC(),
+		Subject:         describer.CloudEventSubject(),
+		DataContentType: c.contentType,
+	}
+	if err := event.Validate(); err != nil {
+		return err
+	}
+
+	if c.mode == cloudevents.ModeBinary {
+		cloudevents.SetHeaders(msg.Metadata, event)
+		return nil
+	}
+
+	envelope, err := cloudevents.Marshal(event, msg.Payload)
+	if err != nil {
+		return err
+	}
+	msg.Payload = envelope
+	msg.Metadata.Set(cloudevents.ContentTypeKey, cloudevents.ContentTypeStructured)
+	return nil
+}
@@ -2,31 +2,102 @@ package publisher
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"sync"
+	"time"
 
+	"github.com/IBM/sarama"
 	"github.com/ThreeDotsLabs/watermill"
 	"github.com/ThreeDotsLabs/watermill-kafka/v3/pkg/kafka"
 	"github.com/ThreeDotsLabs/watermill/message"
 	"github.com/gofiber/fiber/v2/log"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/config"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/health"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/kafkaclient"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/schema"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/schemaregistry"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/serde"
+	"github.com/samber/do/v2"
 )
 
 type Publisher interface {
+	health.Contributor
+
 	Publish(ctx context.Context, payload interface{}) error
+	// PublishWithKey publishes payload with key as the Kafka message key, so
+	// all messages sharing a key land on the same partition in order.
+	PublishWithKey(ctx context.Context, key string, payload interface{}) error
 	Close() error
 }
 
+// partitionKeyMetadataKey carries the Kafka message key from Publish to the
+// marshaler. It is stripped from the message headers.
+const partitionKeyMetadataKey = "_partition_key"
+
+// keyMarshaler is kafka.DefaultMarshaler that also sets the Kafka message
+// key when one was given. Unkeyed messages keep a nil key so the producer
+// spreads them across partitions.
+type keyMarshaler struct {
+	kafka.DefaultMarshaler
+}
+
+func (m keyMarshaler) Marshal(topic string, msg *message.Message) (*sarama.ProducerMessage, error) {
+	key := msg.Metadata.Get(partitionKeyMetadataKey)
+	if key != "" {
+		msg = msg.Copy()
+		delete(msg.Metadata, partitionKeyMetadataKey)
+	}
+
+	kafkaMsg, err := m.DefaultMarshaler.Marshal(topic, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	if key != "" {
+		kafkaMsg.Key = sarama.StringEncoder(key)
+	}
+
+	return kafkaMsg, nil
+}
+
 type publisher struct {
 	kafkaPublisher *kafka.Publisher
 	topic          string
 	name           string
+	serializer     serde.Serializer
+	// schema, when set, validates every payload before it is published.
+	schema *schema.Validator
+	// cloudEvents, when set, publishes every payload as a CloudEvent.
+	cloudEvents *cloudEventer
+	// versions, when set, publishes every payload at the configured event
+	// version.
+	versions *eventVersioner
+
+	mu          sync.Mutex
+	lastSuccess time.Time
+	lastErr     error
+	lastErrAt   time.Time
+	closed      bool
 }
 
-func newPublisher(broker, topic, name string) (Publisher, error) {
+func newPublisher(
+	kafkaConfig config.KafkaConfig,
+	topic, name string,
+	serializer serde.Serializer,
+	validator *schema.Validator,
+	cloudEvents *cloudEventer,
+	versions *eventVersioner,
+) (Publisher, error) {
+	saramaConfig, err := kafkaclient.PublisherConfig(kafkaConfig)
+	if err != nil {
+		return nil, err
+	}
+
 	kafkaPublisher, err := kafka.NewPublisher(
 		kafka.PublisherConfig{
-			Brokers:   []string{broker},
-			Marshaler: kafka.DefaultMarshaler{},
+			Brokers:               kafkaConfig.BrokerAddrs(),
+			Marshaler:             keyMarshaler{},
+			OverwriteSaramaConfig: saramaConfig,
 		},
 		watermill.NewStdLogger(false, false),
 	)
@@ -40,27 +111,98 @@ func newPublisher(broker, topic, name string) (Publisher, error) {
 		kafkaPublisher: kafkaPublisher,
 		topic:          topic,
 		name:           name,
+		serializer:     serializer,
+		schema:         validator,
+		cloudEvents:    cloudEvents,
+		versions:       versions,
 	}, nil
 }
 
+// newSerializer builds the serializer of cfg's encoding. Avro and protobuf
+// resolve the schema registry client and write with the latest schema of
+// the registry subject, <topic>-value unless configured.
+func newSerializer(i do.Injector, cfg config.PublisherConfig) (serde.Serializer, error) {
+	encoding := cfg.Encoding
+	if encoding != serde.EncodingAvro && encoding != serde.EncodingProtobuf {
+		return serde.New(encoding, nil, "")
+	}
+
+	if cfg.Schema.Enable {
+		return nil, fmt.Errorf("schema validation cannot be used with the %s encoding", encoding)
+	}
+
+	client, err := do.Invoke[*schemaregistry.Client](i)
+	if err != nil {
+		return nil, fmt.Errorf("resolve schema registry client: %w", err)
+	}
+
+	subject := cfg.RegistrySubject
+	if subject == "" {
+		subject = cfg.Topic + "-value"
+	}
+	return serde.New(encoding, client, subject)
+}
+
 func (p *publisher) Publish(ctx context.Context, payload interface{}) error {
-	data, err := json.Marshal(payload)
+	return p.PublishWithKey(ctx, "", payload)
+}
+
+func (p *publisher) PublishWithKey(ctx context.Context, key string, payload interface{}) error {
+	encoded := payload
+	if p.versions != nil {
+		var err error
+		if encoded, err = p.versions.convert(payload); err != nil {
+			log.WithContext(ctx).Errorw("failed to convert payload version",
+				"publisher", p.name,
+				"topic", p.topic,
+				"event_version", p.versions.version,
+				"error", err)
+			return fmt.Errorf("convert payload version: %w", err)
+		}
+	}
+
+	data, err := p.serializer.Serialize(ctx, encoded)
 	if err != nil {
-		log.WithContext(ctx).Errorw("failed to marshal payload",
+		log.WithContext(ctx).Errorw("failed to serialize payload",
 			"publisher", p.name,
 			"topic", p.topic,
 			"error", err)
-		return fmt.Errorf("marshal payload: %w", err)
+		return fmt.Errorf("serialize payload: %w", err)
+	}
+
+	if p.schema != nil {
+		if err := p.schema.Validate(data); err != nil {
+			log.WithContext(ctx).Errorw("payload failed schema validation",
+				"publisher", p.name,
+				"topic", p.topic,
+				"error", err)
+			return fmt.Errorf("validate payload: %w", err)
+		}
 	}
 
 	msg := message.NewMessage(watermill.NewUUID(), data)
+	if key != "" {
+		msg.Metadata.Set(partitionKeyMetadataKey, key)
+	}
+	if p.cloudEvents != nil {
+		if err := p.cloudEvents.wrap(msg, payload); err != nil {
+			log.WithContext(ctx).Errorw("failed to build cloudevent",
+				"publisher", p.name,
+				"topic", p.topic,
+				"error", err)
+			return fmt.Errorf("build cloudevent: %w", err)
+		}
+	}
 
 	log.WithContext(ctx).Infow("publishing message",
 		"publisher", p.name,
 		"topic", p.topic,
-		"uuid", msg.UUID)
+		"uuid", msg.UUID,
+		"key", key)
 
-	if err := p.kafkaPublisher.Publish(p.topic, msg); err != nil {
+	err = p.kafkaPublisher.Publish(p.topic, msg)
+	p.recordPublish(err)
+	if err != nil {
 		log.WithContext(ctx).Errorw("failed to publish message",
 			"publisher", p.name,
 			"topic", p.topic,
@@ -72,8 +214,63 @@ func (p *publisher) Publish(ctx context.Context, payload interface{}) error {
 	return nil
 }
 
+func (p *publisher) recordPublish(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err != nil {
+		p.lastErr = err
+		p.lastErrAt = time.Now()
+		return
+	}
+	p.lastSuccess = time.Now()
+	p.lastErr = nil
+}
+
+// HealthName implements health.Contributor.
+func (p *publisher) HealthName() string {
+	return "publisher:" + p.name
+}
+
+// Health implements health.Contributor from the outcome of the latest
+// publish: the producer connects lazily, so a publisher that has not
+// published yet is idle rather than connected.
+func (p *publisher) Health(context.Context) health.Report {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	report := health.Report{
+		State:       health.StateIdle,
+		Healthy:     true,
+		LastSuccess: p.lastSuccess,
+		Details: map[string]any{
+			"topic": p.topic,
+		},
+	}
+
+	switch {
+	case p.closed:
+		report.State = health.StateStopped
+		report.Healthy = false
+		report.Error = "publisher closed"
+	case p.lastErr != nil:
+		report.State = health.StateDisconnected
+		report.Healthy = false
+		report.Error = p.lastErr.Error()
+		report.Details["last_error_at"] = p.lastErrAt
+	case !p.lastSuccess.IsZero():
+		report.State = health.StateConnected
+	}
+
+	return report
+}
+
 func (p *publisher) Close() error {
 	log.Infof("%s publisher: closing", p.name)
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+
 	if err := p.kafkaPublisher.Close(); err != nil {
 		log.Errorw("publisher close error",
 			"publisher", p.name,
@@ -98,6 +295,24 @@ func (n *noopPublisher) Publish(ctx context.Context, payload interface{}) error
 	return nil
 }
 
+func (n *noopPublisher) PublishWithKey(ctx context.Context, key string, payload interface{}) error {
+	return nil
+}
+
 func (n *noopPublisher) Close() error {
 	return nil
 }
+
+// HealthName implements health.Contributor.
+func (n *noopPublisher) HealthName() string {
+	return "publisher:" + n.name
+}
+
+// Health implements health.Contributor; a disabled publisher is always
+// healthy.
+func (n *noopPublisher) Health(context.Context) health.Report {
+	return health.Report{
+		State:   health.StateDisabled,
+		Healthy: true,
+	}
+}
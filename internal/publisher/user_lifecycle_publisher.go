@@ -1,7 +1,12 @@
 package publisher
 
 import (
+	"fmt"
+
 	"github.com/muazwzxv/kafka-consumer-worker/internal/config"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/dto/stream"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/schema"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/serde"
 	"github.com/samber/do/v2"
 )
 
@@ -18,13 +23,42 @@ func NewUserLifecyclePublisher(i do.Injector) (*UserLifecyclePublisher, error) {
 
 	publisherConfig := cfg.Publishers.UserLifecycle
 	if !publisherConfig.Enable {
-		return &UserLifecyclePublisher{newNoopPublisher(publisherConfig.Topic)}, nil
+		return &UserLifecyclePublisher{newNoopPublisher(userlifeCyclePublisherName)}, nil
+	}
+
+	serializer, err := newSerializer(i, publisherConfig)
+	if err != nil {
+		return nil, fmt.Errorf("%s publisher: %w", userlifeCyclePublisherName, err)
+	}
+
+	versions, err := newEventVersioner(stream.UserLifeCycleVersions, publisherConfig.EventVersion)
+	if err != nil {
+		return nil, fmt.Errorf("%s publisher: %w", userlifeCyclePublisherName, err)
+	}
+
+	var validator *schema.Validator
+	if publisherConfig.Schema.Enable {
+		registry := do.MustInvoke[*schema.Registry](i)
+
+		validator, err = registry.Validator(publisherConfig.Schema.Subject)
+		if err != nil {
+			return nil, fmt.Errorf("%s publisher: %w", userlifeCyclePublisherName, err)
+		}
+	}
+
+	cloudEvents, err := newCloudEventer(publisherConfig.CloudEvents, serde.ContentType(publisherConfig.Encoding))
+	if err != nil {
+		return nil, fmt.Errorf("%s publisher: %w", userlifeCyclePublisherName, err)
 	}
 
 	pub, err := newPublisher(
-		cfg.Kafka.Broker,
+		cfg.Kafka,
 		cfg.Publishers.UserLifecycle.Topic,
 		userlifeCyclePublisherName,
+		serializer,
+		validator,
+		cloudEvents,
+		versions,
 	)
 	if err != nil {
 		return nil, err
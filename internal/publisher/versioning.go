@@ -0,0 +1,37 @@
+package publisher
+
+import (
+	"fmt"
+
+	"github.com/muazwzxv/kafka-consumer-worker/internal/versioning"
+)
+
+// eventVersioner publishes versioned events at a chosen version, so
+// producers can keep emitting the version consumers still read during a
+// migration.
+type eventVersioner struct {
+	chain   *versioning.Chain
+	version int
+}
+
+// newEventVersioner publishes at version, or the chain's current version
+// when version is 0.
+func newEventVersioner(chain *versioning.Chain, version int) (*eventVersioner, error) {
+	if version == 0 {
+		version = chain.Current()
+	}
+	if version < 1 || version > chain.Current() {
+		return nil, fmt.Errorf("%w %d, latest is %d", versioning.ErrUnsupportedVersion, version, chain.Current())
+	}
+	return &eventVersioner{chain: chain, version: version}, nil
+}
+
+// convert returns payload, a value of the current version, at the
+// publishing version. Payloads at an older version are downcast through
+// their JSON form.
+func (v *eventVersioner) convert(payload any) (any, error) {
+	if v.version == v.chain.Current() {
+		return payload, nil
+	}
+	return v.chain.Convert(payload, v.version)
+}
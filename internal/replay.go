@@ -0,0 +1,38 @@
+package app
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/config"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/consumer"
+	"github.com/samber/do/v2"
+)
+
+// Replay loads config from the default locations and reprocesses a range of
+// a stream's topic with the stream's registered handler. It starts neither
+// the HTTP server nor the live consumer.
+func Replay(ctx context.Context, opts consumer.ReplayOptions) (consumer.ReplaySummary, error) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return consumer.ReplaySummary{}, fmt.Errorf("load config: %w", err)
+	}
+
+	if err := setLogLevel(cfg.Server.LogLevel); err != nil {
+		return consumer.ReplaySummary{}, fmt.Errorf("invalid log level: %w", err)
+	}
+
+	injector := do.New()
+	provideCore(injector, cfg)
+
+	// Only the services the handler used were created; shutting the
+	// injector down closes them, including the database.
+	defer func() {
+		if report := injector.Shutdown(); report != nil && !report.Succeed {
+			log.Warnw("replay shutdown failed", "error", report.Error())
+		}
+	}()
+
+	return consumer.Replay(ctx, injector, opts)
+}
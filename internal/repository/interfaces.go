@@ -3,6 +3,7 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/muazwzxv/kafka-consumer-worker/internal/entity"
 )
@@ -11,6 +12,18 @@ type UserRepository interface {
 	Create(ctx context.Context, item *entity.User) error
 	GetByUUID(ctx context.Context, uuid string) (*entity.User, error)
 	UpdateUser(ctx context.Context, user *entity.User) error
+	GetByUUIDs(ctx context.Context, uuids []string) ([]*entity.User, error)
+	UpdateStatusByUUIDs(ctx context.Context, uuids []string, status entity.UserStatus) error
+}
+
+type ProcessedMessageRepository interface {
+	// MarkProcessed records key as processed for stream. It returns false if
+	// the key was already recorded.
+	MarkProcessed(ctx context.Context, stream, key string) (bool, error)
+	Unmark(ctx context.Context, stream, key string) error
+	// DeleteProcessedBefore removes up to limit records older than before
+	// and returns how many were removed.
+	DeleteProcessedBefore(ctx context.Context, before time.Time, limit int) (int64, error)
 }
 
 type DatabaseRepository interface {
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/muazwzxv/kafka-consumer-worker/internal/database"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/database/store"
+	"github.com/samber/do/v2"
+)
+
+type ProcessedMessageRepositoryImpl struct {
+	queries *store.Queries
+	db      store.DBTX
+}
+
+func NewProcessedMessageRepository(i do.Injector) (ProcessedMessageRepository, error) {
+	queries := do.MustInvoke[*store.Queries](i)
+	db := do.MustInvoke[*database.Database](i)
+
+	return &ProcessedMessageRepositoryImpl{
+		queries: queries,
+		db:      db.DB,
+	}, nil
+}
+
+func (r *ProcessedMessageRepositoryImpl) MarkProcessed(ctx context.Context, stream, key string) (bool, error) {
+	inserted, err := r.queries.InsertProcessedMessage(ctx, r.conn(ctx), store.InsertProcessedMessageParams{
+		Stream:     stream,
+		MessageKey: key,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return inserted > 0, nil
+}
+
+func (r *ProcessedMessageRepositoryImpl) Unmark(ctx context.Context, stream, key string) error {
+	return r.queries.DeleteProcessedMessage(ctx, r.conn(ctx), store.DeleteProcessedMessageParams{
+		Stream:     stream,
+		MessageKey: key,
+	})
+}
+
+func (r *ProcessedMessageRepositoryImpl) DeleteProcessedBefore(ctx context.Context, before time.Time, limit int) (int64, error) {
+	return r.queries.DeleteProcessedMessagesBefore(ctx, r.conn(ctx), store.DeleteProcessedMessagesBeforeParams{
+		ProcessedAt: before,
+		Limit:       int32(limit),
+	})
+}
+
+func (r *ProcessedMessageRepositoryImpl) conn(ctx context.Context) store.DBTX {
+	if tx, ok := database.TxFromContext(ctx); ok {
+		return tx
+	}
+	return r.db
+}
@@ -26,7 +26,7 @@ func NewUserRepository(i do.Injector) (UserRepository, error) {
 }
 
 func (r *UserRepositoryImpl) Create(ctx context.Context, item *entity.User) error {
-	_, err := r.queries.CreateUser(ctx, r.db, store.CreateUserParams{
+	_, err := r.queries.CreateUser(ctx, r.conn(ctx), store.CreateUserParams{
 		Name: item.Name,
 		Uuid: item.UUID,
 		Description: sql.NullString{
@@ -43,7 +43,7 @@ func (r *UserRepositoryImpl) Create(ctx context.Context, item *entity.User) erro
 }
 
 func (r *UserRepositoryImpl) GetByUUID(ctx context.Context, uuid string) (*entity.User, error) {
-	row, err := r.queries.GetUserByUUID(ctx, r.db, uuid)
+	row, err := r.queries.GetUserByUUID(ctx, r.conn(ctx), uuid)
 	if err != nil {
 		return nil, err
 	}
@@ -52,13 +52,13 @@ func (r *UserRepositoryImpl) GetByUUID(ctx context.Context, uuid string) (*entit
 }
 
 func (r *UserRepositoryImpl) UpdateUser(ctx context.Context, user *entity.User) error {
-	if err := r.queries.UpdateUser(ctx, r.db, store.UpdateUserParams{
+	if err := r.queries.UpdateUser(ctx, r.conn(ctx), store.UpdateUserParams{
 		Name: user.Name,
 		Description: sql.NullString{
 			String: user.Description,
 			Valid:  user.Description != "",
 		},
-		Status: entity.UserStatusActive.String(),
+		Status: user.Status.String(),
 		Uuid:   user.UUID,
 	}); err != nil {
 		return err
@@ -67,6 +67,40 @@ func (r *UserRepositoryImpl) UpdateUser(ctx context.Context, user *entity.User)
 	return nil
 }
 
+func (r *UserRepositoryImpl) GetByUUIDs(ctx context.Context, uuids []string) ([]*entity.User, error) {
+	rows, err := r.queries.GetUsersByUUIDs(ctx, r.conn(ctx), uuids)
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]*entity.User, 0, len(rows))
+	for _, row := range rows {
+		users = append(users, r.toEntity(row))
+	}
+
+	return users, nil
+}
+
+func (r *UserRepositoryImpl) UpdateStatusByUUIDs(ctx context.Context, uuids []string, status entity.UserStatus) error {
+	if len(uuids) == 0 {
+		return nil
+	}
+
+	return r.queries.UpdateUsersStatus(ctx, r.conn(ctx), store.UpdateUsersStatusParams{
+		Status: status.String(),
+		Uuids:  uuids,
+	})
+}
+
+// conn returns the transaction carried by ctx, if any, so writes made while
+// handling a message commit or roll back together.
+func (r *UserRepositoryImpl) conn(ctx context.Context) store.DBTX {
+	if tx, ok := database.TxFromContext(ctx); ok {
+		return tx
+	}
+	return r.db
+}
+
 func (r *UserRepositoryImpl) toEntity(row *store.User) *entity.User {
 	result := &entity.User{
 		UUID:   row.Uuid,
@@ -0,0 +1,222 @@
+// Package schema validates message payloads against the JSON Schemas
+// embedded in the binary. Each subject, usually a stream, has one schema
+// per version under schemas/<subject>/<version>.json, with versions named
+// v1, v2, and so on. A payload is validated against the schema of its own
+// version, read from its version field; payloads without one are v1.
+package schema
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/muazwzxv/kafka-consumer-worker/internal/versioning"
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+//go:embed schemas
+var files embed.FS
+
+// schemaURLPrefix is the base URL the embedded schemas are compiled under.
+const schemaURLPrefix = "embed:///"
+
+var ErrUnknownSchema = errors.New("unknown schema")
+
+var printer = message.NewPrinter(language.English)
+
+// Registry holds the compiled schemas of every subject.
+type Registry struct {
+	// schemas maps subject to version to schema.
+	schemas map[string]map[string]*jsonschema.Schema
+	// latest maps subject to its highest version.
+	latest map[string]string
+}
+
+// NewRegistry compiles the embedded schemas.
+func NewRegistry() (*Registry, error) {
+	compiler := jsonschema.NewCompiler()
+	compiler.AssertFormat()
+
+	paths, err := fs.Glob(files, "schemas/*/v*.json")
+	if err != nil {
+		return nil, fmt.Errorf("list schemas: %w", err)
+	}
+
+	r := &Registry{
+		schemas: make(map[string]map[string]*jsonschema.Schema),
+		latest:  make(map[string]string),
+	}
+
+	for _, p := range paths {
+		subject := path.Base(path.Dir(p))
+		version := strings.TrimSuffix(path.Base(p), ".json")
+		if _, err := parseVersion(version); err != nil {
+			return nil, fmt.Errorf("schema %s: %w", p, err)
+		}
+
+		data, err := files.ReadFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("read schema %s: %w", p, err)
+		}
+		doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("parse schema %s: %w", p, err)
+		}
+		if err := compiler.AddResource(schemaURLPrefix+p, doc); err != nil {
+			return nil, fmt.Errorf("add schema %s: %w", p, err)
+		}
+		compiled, err := compiler.Compile(schemaURLPrefix + p)
+		if err != nil {
+			return nil, fmt.Errorf("compile schema %s: %w", p, err)
+		}
+
+		if r.schemas[subject] == nil {
+			r.schemas[subject] = make(map[string]*jsonschema.Schema)
+		}
+		r.schemas[subject][version] = compiled
+		if latest, ok := r.latest[subject]; !ok || compareVersions(version, latest) > 0 {
+			r.latest[subject] = version
+		}
+	}
+
+	return r, nil
+}
+
+// Subjects returns the subjects with at least one schema, sorted.
+func (r *Registry) Subjects() []string {
+	subjects := make([]string, 0, len(r.schemas))
+	for subject := range r.schemas {
+		subjects = append(subjects, subject)
+	}
+	sort.Strings(subjects)
+	return subjects
+}
+
+// Latest returns the highest version of subject.
+func (r *Registry) Latest(subject string) (string, bool) {
+	version, ok := r.latest[subject]
+	return version, ok
+}
+
+// Validator returns a validator for subject.
+func (r *Registry) Validator(subject string) (*Validator, error) {
+	if _, ok := r.schemas[subject]; !ok {
+		return nil, fmt.Errorf("%w: no schemas for subject %s", ErrUnknownSchema, subject)
+	}
+	return &Validator{registry: r, subject: subject}, nil
+}
+
+// Validate checks payload against version of subject. It returns a
+// *ValidationError if the payload does not match, or wraps
+// ErrUnknownSchema if there is no such schema.
+func (r *Registry) Validate(subject, version string, payload []byte) error {
+	schema, ok := r.schemas[subject][version]
+	if !ok {
+		return fmt.Errorf("%w: %s/%s", ErrUnknownSchema, subject, version)
+	}
+
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(payload))
+	if err != nil {
+		return &ValidationError{
+			Subject: subject,
+			Version: version,
+			Errors:  []FieldError{{Path: "/", Message: "invalid JSON: " + err.Error()}},
+		}
+	}
+
+	err = schema.Validate(doc)
+	if err == nil {
+		return nil
+	}
+
+	var validationErr *jsonschema.ValidationError
+	if !errors.As(err, &validationErr) {
+		return fmt.Errorf("validate against %s/%s: %w", subject, version, err)
+	}
+	return &ValidationError{
+		Subject: subject,
+		Version: version,
+		Errors:  fieldErrors(validationErr, nil),
+	}
+}
+
+// Validator validates payloads of one subject.
+type Validator struct {
+	registry *Registry
+	subject  string
+}
+
+func (v *Validator) Subject() string {
+	return v.subject
+}
+
+// Validate checks payload against the schema of the version in its
+// version field. Payloads that are not JSON or carry an invalid version
+// are checked against the latest schema, whose errors say why they fail.
+func (v *Validator) Validate(payload []byte) error {
+	version := v.registry.latest[v.subject]
+	if n, err := versioning.PayloadVersion(payload); err == nil {
+		version = "v" + strconv.Itoa(n)
+	}
+	return v.registry.Validate(v.subject, version, payload)
+}
+
+// FieldError is one reason a payload does not match its schema.
+type FieldError struct {
+	// Path is the JSON pointer of the offending value, "/" for the
+	// payload itself.
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every reason a payload does not match its schema.
+type ValidationError struct {
+	Subject string
+	Version string
+	Errors  []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	reasons := make([]string, len(e.Errors))
+	for i, fieldErr := range e.Errors {
+		reasons[i] = fieldErr.Path + ": " + fieldErr.Message
+	}
+	return fmt.Sprintf("payload does not match schema %s/%s: %s", e.Subject, e.Version, strings.Join(reasons, "; "))
+}
+
+// fieldErrors flattens the leaves of a validation error tree.
+func fieldErrors(err *jsonschema.ValidationError, errs []FieldError) []FieldError {
+	if len(err.Causes) == 0 {
+		return append(errs, FieldError{
+			Path:    "/" + strings.Join(err.InstanceLocation, "/"),
+			Message: err.ErrorKind.LocalizedString(printer),
+		})
+	}
+	for _, cause := range err.Causes {
+		errs = fieldErrors(cause, errs)
+	}
+	return errs
+}
+
+func parseVersion(version string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimPrefix(version, "v"))
+	if err != nil || !strings.HasPrefix(version, "v") || n < 1 {
+		return 0, fmt.Errorf("version %q is not of the form v1, v2, ...", version)
+	}
+	return n, nil
+}
+
+// compareVersions compares two versions accepted by parseVersion.
+func compareVersions(a, b string) int {
+	na, _ := parseVersion(a)
+	nb, _ := parseVersion(b)
+	return na - nb
+}
@@ -0,0 +1,100 @@
+package schema
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidatorPicksSchemaOfPayloadVersion(t *testing.T) {
+	registry, err := NewRegistry()
+	if err != nil {
+		t.Fatalf("NewRegistry: %v", err)
+	}
+	validator, err := registry.Validator("user_lifecycle")
+	if err != nil {
+		t.Fatalf("Validator: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		payload string
+		// version is the schema version the payload fails against, empty
+		// when it is valid.
+		version string
+	}{
+		{
+			name:    "v1 without version field",
+			payload: `{"uuid":"9b2c3f4e-1a2b-4c3d-8e9f-0a1b2c3d4e5f","status":"active"}`,
+		},
+		{
+			name:    "v2",
+			payload: `{"version":2,"event_type":"user.activated","uuid":"9b2c3f4e-1a2b-4c3d-8e9f-0a1b2c3d4e5f","status":"active"}`,
+		},
+		{
+			name:    "v2 missing event_type",
+			payload: `{"version":2,"uuid":"9b2c3f4e-1a2b-4c3d-8e9f-0a1b2c3d4e5f","status":"active"}`,
+			version: "v2",
+		},
+		{
+			name:    "v1 with bad status",
+			payload: `{"uuid":"9b2c3f4e-1a2b-4c3d-8e9f-0a1b2c3d4e5f","status":"deleted"}`,
+			version: "v1",
+		},
+		{
+			name:    "invalid version checked against latest",
+			payload: `{"version":"two","event_type":"user.activated","uuid":"9b2c3f4e-1a2b-4c3d-8e9f-0a1b2c3d4e5f","status":"active"}`,
+			version: "v2",
+		},
+		{
+			name:    "not JSON",
+			payload: `{"uuid":`,
+			version: "v2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validator.Validate([]byte(tt.payload))
+			if tt.version == "" {
+				if err != nil {
+					t.Fatalf("Validate: %v", err)
+				}
+				return
+			}
+
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("err = %v, want a *ValidationError", err)
+			}
+			if validationErr.Version != tt.version {
+				t.Errorf("validated against %s, want %s", validationErr.Version, tt.version)
+			}
+		})
+	}
+}
+
+func TestValidatorRejectsUnknownVersion(t *testing.T) {
+	registry, err := NewRegistry()
+	if err != nil {
+		t.Fatalf("NewRegistry: %v", err)
+	}
+	validator, err := registry.Validator("user_lifecycle")
+	if err != nil {
+		t.Fatalf("Validator: %v", err)
+	}
+
+	err = validator.Validate([]byte(`{"version":9,"uuid":"9b2c3f4e-1a2b-4c3d-8e9f-0a1b2c3d4e5f","status":"active"}`))
+	if !errors.Is(err, ErrUnknownSchema) {
+		t.Fatalf("err = %v, want ErrUnknownSchema", err)
+	}
+}
+
+func TestValidatorUnknownSubject(t *testing.T) {
+	registry, err := NewRegistry()
+	if err != nil {
+		t.Fatalf("NewRegistry: %v", err)
+	}
+	if _, err := registry.Validator("orders"); !errors.Is(err, ErrUnknownSchema) {
+		t.Fatalf("err = %v, want ErrUnknownSchema", err)
+	}
+}
@@ -0,0 +1,289 @@
+// Package schemaregistry is a client of Confluent-compatible schema
+// registries, the source of the writer schemas of avro and protobuf
+// payloads.
+package schemaregistry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/muazwzxv/kafka-consumer-worker/internal/config"
+)
+
+// Schema types as the registry names them. An empty type means avro.
+const (
+	TypeAvro     = "AVRO"
+	TypeProtobuf = "PROTOBUF"
+	TypeJSON     = "JSON"
+)
+
+const (
+	defaultTimeout = 10 * time.Second
+	contentType    = "application/vnd.schemaregistry.v1+json"
+)
+
+var (
+	// ErrNotFound is returned for schemas, subjects and versions the
+	// registry does not know.
+	ErrNotFound = errors.New("schema registry: not found")
+	// ErrUnavailable is returned when the registry cannot be reached or
+	// fails the request itself; trying again later may succeed.
+	ErrUnavailable = errors.New("schema registry: unavailable")
+)
+
+// Reference is a schema another schema depends on, e.g. a protobuf import.
+type Reference struct {
+	// Name is how the referencing schema refers to it: the import path of
+	// a protobuf file or the full name of an avro type.
+	Name    string `json:"name"`
+	Subject string `json:"subject"`
+	Version int    `json:"version"`
+}
+
+// Schema is a schema as stored in the registry.
+type Schema struct {
+	ID         int         `json:"id,omitempty"`
+	Subject    string      `json:"subject,omitempty"`
+	Version    int         `json:"version,omitempty"`
+	Type       string      `json:"schemaType,omitempty"`
+	Schema     string      `json:"schema"`
+	References []Reference `json:"references,omitempty"`
+}
+
+// SchemaType returns the type of s, with the registry's avro default
+// applied.
+func (s Schema) SchemaType() string {
+	if s.Type == "" {
+		return TypeAvro
+	}
+	return s.Type
+}
+
+// Error is an error response of the registry.
+type Error struct {
+	StatusCode int
+	Code       int    `json:"error_code"`
+	Message    string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("schema registry: %s (status %d, code %d)", e.Message, e.StatusCode, e.Code)
+}
+
+// Is reports 404 responses as ErrNotFound, and server errors and rate
+// limiting as ErrUnavailable.
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrUnavailable:
+		return e.StatusCode >= http.StatusInternalServerError || e.StatusCode == http.StatusTooManyRequests
+	}
+	return false
+}
+
+type latestEntry struct {
+	schema    Schema
+	fetchedAt time.Time
+}
+
+// Client talks to the registry over its REST API. Schemas fetched by ID or
+// by subject version never change, so they are cached for the life of the
+// client; the latest version of a subject is cached for CacheTTL.
+type Client struct {
+	baseURL    string
+	username   string
+	password   string
+	cacheTTL   time.Duration
+	httpClient *http.Client
+
+	mu         sync.Mutex
+	byID       map[int]Schema
+	byVersion  map[string]Schema
+	latest     map[string]latestEntry
+	registered map[string]int
+}
+
+func NewClient(cfg config.SchemaRegistryConfig) (*Client, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("schema registry: url is not set")
+	}
+	if _, err := url.ParseRequestURI(cfg.URL); err != nil {
+		return nil, fmt.Errorf("schema registry: invalid url %q: %w", cfg.URL, err)
+	}
+
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	return &Client{
+		baseURL:    strings.TrimRight(cfg.URL, "/"),
+		username:   cfg.Username,
+		password:   cfg.Password,
+		cacheTTL:   cfg.CacheTTL,
+		httpClient: &http.Client{Timeout: timeout},
+		byID:       make(map[int]Schema),
+		byVersion:  make(map[string]Schema),
+		latest:     make(map[string]latestEntry),
+		registered: make(map[string]int),
+	}, nil
+}
+
+// SchemaByID returns the schema registered under id.
+func (c *Client) SchemaByID(ctx context.Context, id int) (Schema, error) {
+	c.mu.Lock()
+	schema, ok := c.byID[id]
+	c.mu.Unlock()
+	if ok {
+		return schema, nil
+	}
+
+	if err := c.do(ctx, http.MethodGet, "/schemas/ids/"+strconv.Itoa(id), nil, &schema); err != nil {
+		return Schema{}, fmt.Errorf("get schema %d: %w", id, err)
+	}
+	schema.ID = id
+
+	c.mu.Lock()
+	c.byID[id] = schema
+	c.mu.Unlock()
+	return schema, nil
+}
+
+// SchemaByVersion returns version of subject.
+func (c *Client) SchemaByVersion(ctx context.Context, subject string, version int) (Schema, error) {
+	key := subject + "/" + strconv.Itoa(version)
+
+	c.mu.Lock()
+	schema, ok := c.byVersion[key]
+	c.mu.Unlock()
+	if ok {
+		return schema, nil
+	}
+
+	schema, err := c.subjectVersion(ctx, subject, strconv.Itoa(version))
+	if err != nil {
+		return Schema{}, err
+	}
+
+	c.mu.Lock()
+	c.byVersion[key] = schema
+	c.byID[schema.ID] = schema
+	c.mu.Unlock()
+	return schema, nil
+}
+
+// LatestSchema returns the latest version of subject.
+func (c *Client) LatestSchema(ctx context.Context, subject string) (Schema, error) {
+	c.mu.Lock()
+	entry, ok := c.latest[subject]
+	c.mu.Unlock()
+	if ok && (c.cacheTTL <= 0 || time.Since(entry.fetchedAt) < c.cacheTTL) {
+		return entry.schema, nil
+	}
+
+	schema, err := c.subjectVersion(ctx, subject, "latest")
+	if err != nil {
+		return Schema{}, err
+	}
+
+	c.mu.Lock()
+	c.latest[subject] = latestEntry{schema: schema, fetchedAt: time.Now()}
+	c.byVersion[subject+"/"+strconv.Itoa(schema.Version)] = schema
+	c.byID[schema.ID] = schema
+	c.mu.Unlock()
+	return schema, nil
+}
+
+func (c *Client) subjectVersion(ctx context.Context, subject, version string) (Schema, error) {
+	var schema Schema
+	path := "/subjects/" + url.PathEscape(subject) + "/versions/" + version
+	if err := c.do(ctx, http.MethodGet, path, nil, &schema); err != nil {
+		return Schema{}, fmt.Errorf("get subject %s version %s: %w", subject, version, err)
+	}
+	return schema, nil
+}
+
+// Register registers schema under subject, or looks it up if it already
+// is, and returns its ID.
+func (c *Client) Register(ctx context.Context, subject string, schema Schema) (int, error) {
+	key := subject + "\x00" + schema.SchemaType() + "\x00" + schema.Schema
+
+	c.mu.Lock()
+	id, ok := c.registered[key]
+	c.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+
+	request := Schema{Type: schema.Type, Schema: schema.Schema, References: schema.References}
+	var response struct {
+		ID int `json:"id"`
+	}
+	path := "/subjects/" + url.PathEscape(subject) + "/versions"
+	if err := c.do(ctx, http.MethodPost, path, request, &response); err != nil {
+		return 0, fmt.Errorf("register schema under %s: %w", subject, err)
+	}
+
+	c.mu.Lock()
+	c.registered[key] = response.ID
+	c.mu.Unlock()
+	return response.ID, nil
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body, result any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", contentType)
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("%w: read response: %w", ErrUnavailable, err)
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		regErr := &Error{StatusCode: resp.StatusCode}
+		if json.Unmarshal(data, regErr) != nil || regErr.Message == "" {
+			regErr.Message = http.StatusText(resp.StatusCode)
+		}
+		return regErr
+	}
+
+	if err := json.Unmarshal(data, result); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package schemaregistry_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/muazwzxv/kafka-consumer-worker/internal/config"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/schemaregistry"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/schemaregistry/schemaregistrytest"
+)
+
+const (
+	userV1 = `{"type":"record","name":"User","fields":[{"name":"id","type":"string"}]}`
+	userV2 = `{"type":"record","name":"User","fields":[{"name":"id","type":"string"},{"name":"name","type":"string","default":""}]}`
+)
+
+func newClient(t *testing.T, registry *schemaregistrytest.FakeRegistry, cacheTTL time.Duration) *schemaregistry.Client {
+	t.Helper()
+
+	client, err := schemaregistry.NewClient(config.SchemaRegistryConfig{
+		URL:      registry.URL(),
+		Timeout:  time.Second,
+		CacheTTL: cacheTTL,
+	})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	return client
+}
+
+func TestClientCachesSchemaByID(t *testing.T) {
+	registry := schemaregistrytest.NewFakeRegistry()
+	defer registry.Close()
+	registered := registry.Register("users-value", schemaregistry.Schema{Schema: userV1})
+
+	client := newClient(t, registry, time.Minute)
+	ctx := context.Background()
+
+	for range 3 {
+		schema, err := client.SchemaByID(ctx, registered.ID)
+		if err != nil {
+			t.Fatalf("SchemaByID: %v", err)
+		}
+		if schema.ID != registered.ID || schema.Schema != userV1 {
+			t.Fatalf("SchemaByID = %+v, want id %d with the v1 schema", schema, registered.ID)
+		}
+	}
+
+	if got := registry.Requests(); got != 1 {
+		t.Errorf("registry served %d requests, want 1", got)
+	}
+}
+
+func TestClientCachesSchemaByVersion(t *testing.T) {
+	registry := schemaregistrytest.NewFakeRegistry()
+	defer registry.Close()
+	registry.Register("users-value", schemaregistry.Schema{Schema: userV1})
+	v2 := registry.Register("users-value", schemaregistry.Schema{Schema: userV2})
+
+	client := newClient(t, registry, time.Minute)
+	ctx := context.Background()
+
+	for range 3 {
+		schema, err := client.SchemaByVersion(ctx, "users-value", 2)
+		if err != nil {
+			t.Fatalf("SchemaByVersion: %v", err)
+		}
+		if schema.Version != 2 || schema.ID != v2.ID {
+			t.Fatalf("SchemaByVersion = %+v, want version 2 with id %d", schema, v2.ID)
+		}
+	}
+
+	// A version lookup also fills the by-ID cache.
+	if _, err := client.SchemaByID(ctx, v2.ID); err != nil {
+		t.Fatalf("SchemaByID: %v", err)
+	}
+
+	if got := registry.Requests(); got != 1 {
+		t.Errorf("registry served %d requests, want 1", got)
+	}
+}
+
+func TestClientCachesLatestSchemaForTTL(t *testing.T) {
+	registry := schemaregistrytest.NewFakeRegistry()
+	defer registry.Close()
+	registry.Register("users-value", schemaregistry.Schema{Schema: userV1})
+
+	const ttl = 50 * time.Millisecond
+	client := newClient(t, registry, ttl)
+	ctx := context.Background()
+
+	latest, err := client.LatestSchema(ctx, "users-value")
+	if err != nil {
+		t.Fatalf("LatestSchema: %v", err)
+	}
+	if latest.Version != 1 {
+		t.Fatalf("LatestSchema version = %d, want 1", latest.Version)
+	}
+
+	// A new version is not seen while the cached latest is fresh.
+	registry.Register("users-value", schemaregistry.Schema{Schema: userV2})
+	if latest, err = client.LatestSchema(ctx, "users-value"); err != nil {
+		t.Fatalf("LatestSchema: %v", err)
+	}
+	if latest.Version != 1 {
+		t.Errorf("LatestSchema version = %d within the TTL, want cached 1", latest.Version)
+	}
+	if got := registry.Requests(); got != 1 {
+		t.Errorf("registry served %d requests within the TTL, want 1", got)
+	}
+
+	time.Sleep(ttl + 10*time.Millisecond)
+
+	if latest, err = client.LatestSchema(ctx, "users-value"); err != nil {
+		t.Fatalf("LatestSchema: %v", err)
+	}
+	if latest.Version != 2 {
+		t.Errorf("LatestSchema version = %d after the TTL, want 2", latest.Version)
+	}
+	if got := registry.Requests(); got != 2 {
+		t.Errorf("registry served %d requests after the TTL, want 2", got)
+	}
+}
+
+func TestClientRegisterCachesID(t *testing.T) {
+	registry := schemaregistrytest.NewFakeRegistry()
+	defer registry.Close()
+
+	client := newClient(t, registry, time.Minute)
+	ctx := context.Background()
+
+	first, err := client.Register(ctx, "users-value", schemaregistry.Schema{Schema: userV1})
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	second, err := client.Register(ctx, "users-value", schemaregistry.Schema{Schema: userV1})
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if first != second {
+		t.Errorf("Register returned ids %d and %d for the same schema", first, second)
+	}
+	if got := registry.Requests(); got != 1 {
+		t.Errorf("registry served %d requests, want 1", got)
+	}
+}
+
+func TestClientMapsNotFound(t *testing.T) {
+	registry := schemaregistrytest.NewFakeRegistry()
+	defer registry.Close()
+	registry.Register("users-value", schemaregistry.Schema{Schema: userV1})
+
+	client := newClient(t, registry, time.Minute)
+	ctx := context.Background()
+
+	lookups := map[string]func() error{
+		"unknown id": func() error {
+			_, err := client.SchemaByID(ctx, 42)
+			return err
+		},
+		"unknown subject": func() error {
+			_, err := client.LatestSchema(ctx, "orders-value")
+			return err
+		},
+		"unknown version": func() error {
+			_, err := client.SchemaByVersion(ctx, "users-value", 7)
+			return err
+		},
+	}
+
+	for name, lookup := range lookups {
+		t.Run(name, func(t *testing.T) {
+			err := lookup()
+			if !errors.Is(err, schemaregistry.ErrNotFound) {
+				t.Fatalf("err = %v, want ErrNotFound", err)
+			}
+			if errors.Is(err, schemaregistry.ErrUnavailable) {
+				t.Errorf("err = %v also matches ErrUnavailable", err)
+			}
+
+			var regErr *schemaregistry.Error
+			if !errors.As(err, &regErr) || regErr.StatusCode != http.StatusNotFound {
+				t.Errorf("err = %v, want a registry error with status 404", err)
+			}
+		})
+	}
+}
+
+func TestClientMapsServerErrorsToUnavailable(t *testing.T) {
+	registry := schemaregistrytest.NewFakeRegistry()
+	defer registry.Close()
+	registered := registry.Register("users-value", schemaregistry.Schema{Schema: userV1})
+
+	client := newClient(t, registry, time.Minute)
+	ctx := context.Background()
+
+	for _, status := range []int{http.StatusInternalServerError, http.StatusServiceUnavailable, http.StatusTooManyRequests} {
+		registry.Fail(status)
+
+		_, err := client.SchemaByID(ctx, registered.ID)
+		if !errors.Is(err, schemaregistry.ErrUnavailable) {
+			t.Errorf("status %d: err = %v, want ErrUnavailable", status, err)
+		}
+		if errors.Is(err, schemaregistry.ErrNotFound) {
+			t.Errorf("status %d: err = %v also matches ErrNotFound", status, err)
+		}
+	}
+
+	// A failed lookup is not cached.
+	registry.Fail(0)
+	if _, err := client.SchemaByID(ctx, registered.ID); err != nil {
+		t.Fatalf("SchemaByID after recovery: %v", err)
+	}
+}
+
+func TestClientMapsUnreachableRegistryToUnavailable(t *testing.T) {
+	registry := schemaregistrytest.NewFakeRegistry()
+	client := newClient(t, registry, time.Minute)
+	registry.Close()
+
+	_, err := client.SchemaByID(context.Background(), 1)
+	if !errors.Is(err, schemaregistry.ErrUnavailable) {
+		t.Fatalf("err = %v, want ErrUnavailable", err)
+	}
+}
@@ -0,0 +1,184 @@
+// Package schemaregistrytest provides an in-memory schema registry for
+// running the schemaregistry client and the serdes offline.
+package schemaregistrytest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+
+	"github.com/muazwzxv/kafka-consumer-worker/internal/schemaregistry"
+)
+
+const contentType = "application/vnd.schemaregistry.v1+json"
+
+// FakeRegistry is an in-memory schema registry served over HTTP on a local
+// port, implementing the part of the REST API the client uses.
+type FakeRegistry struct {
+	server *httptest.Server
+
+	mu       sync.Mutex
+	schemas  []schemaregistry.Schema
+	subjects map[string][]int
+	requests int
+	// failStatus, when set, is returned for every request.
+	failStatus int
+}
+
+// NewFakeRegistry starts a fake registry. Close stops it.
+func NewFakeRegistry() *FakeRegistry {
+	f := &FakeRegistry{subjects: make(map[string][]int)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /schemas/ids/{id}", f.getByID)
+	mux.HandleFunc("GET /subjects/{subject}/versions/{version}", f.getVersion)
+	mux.HandleFunc("POST /subjects/{subject}/versions", f.register)
+
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.requests++
+		failStatus := f.failStatus
+		f.mu.Unlock()
+
+		if failStatus != 0 {
+			writeError(w, failStatus, failStatus*100, http.StatusText(failStatus))
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	return f
+}
+
+// URL is the base URL to configure the Client with.
+func (f *FakeRegistry) URL() string {
+	return f.server.URL
+}
+
+func (f *FakeRegistry) Close() {
+	f.server.Close()
+}
+
+// Requests returns how many requests the registry has served, to check
+// what the client caches.
+func (f *FakeRegistry) Requests() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests
+}
+
+// Fail makes the registry answer every request with status, until it is
+// called again with 0.
+func (f *FakeRegistry) Fail(status int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failStatus = status
+}
+
+// Register adds schema as the next version of subject and returns it with
+// its ID and version set. A schema already registered keeps its ID, and
+// registering the latest version of a subject again is a no-op, as in the
+// real registry.
+func (f *FakeRegistry) Register(subject string, schema schemaregistry.Schema) schemaregistry.Schema {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.registerLocked(subject, schema)
+}
+
+func (f *FakeRegistry) registerLocked(subject string, schema schemaregistry.Schema) schemaregistry.Schema {
+	id := 0
+	for _, existing := range f.schemas {
+		if existing.SchemaType() == schema.SchemaType() && existing.Schema == schema.Schema {
+			id = existing.ID
+			break
+		}
+	}
+	if id == 0 {
+		id = len(f.schemas) + 1
+		f.schemas = append(f.schemas, schemaregistry.Schema{
+			ID:         id,
+			Type:       schema.Type,
+			Schema:     schema.Schema,
+			References: schema.References,
+		})
+	}
+
+	versions := f.subjects[subject]
+	for i, existing := range versions {
+		if existing == id {
+			return f.versionLocked(subject, i+1)
+		}
+	}
+	f.subjects[subject] = append(versions, id)
+	return f.versionLocked(subject, len(versions)+1)
+}
+
+// versionLocked returns version of subject, which must exist.
+func (f *FakeRegistry) versionLocked(subject string, version int) schemaregistry.Schema {
+	schema := f.schemas[f.subjects[subject][version-1]-1]
+	schema.Subject = subject
+	schema.Version = version
+	return schema
+}
+
+func (f *FakeRegistry) getByID(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err != nil || id < 1 || id > len(f.schemas) {
+		writeError(w, http.StatusNotFound, 40403, "Schema not found")
+		return
+	}
+	schema := f.schemas[id-1]
+	writeJSON(w, http.StatusOK, schemaregistry.Schema{Type: schema.Type, Schema: schema.Schema, References: schema.References})
+}
+
+func (f *FakeRegistry) getVersion(w http.ResponseWriter, r *http.Request) {
+	subject := r.PathValue("subject")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	versions, ok := f.subjects[subject]
+	if !ok {
+		writeError(w, http.StatusNotFound, 40401, "Subject '"+subject+"' not found.")
+		return
+	}
+
+	version := len(versions)
+	if param := r.PathValue("version"); param != "latest" {
+		var err error
+		if version, err = strconv.Atoi(param); err != nil || version < 1 || version > len(versions) {
+			writeError(w, http.StatusNotFound, 40402, "Version "+param+" not found.")
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, f.versionLocked(subject, version))
+}
+
+func (f *FakeRegistry) register(w http.ResponseWriter, r *http.Request) {
+	var schema schemaregistry.Schema
+	if err := json.NewDecoder(r.Body).Decode(&schema); err != nil || schema.Schema == "" {
+		writeError(w, http.StatusUnprocessableEntity, 42201, "Invalid schema")
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	registered := f.registerLocked(r.PathValue("subject"), schema)
+	writeJSON(w, http.StatusOK, map[string]int{"id": registered.ID})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status, code int, message string) {
+	writeJSON(w, status, map[string]any{"error_code": code, "message": message})
+}
@@ -0,0 +1,109 @@
+package serde
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/hamba/avro/v2"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/schemaregistry"
+)
+
+// avroAPI maps record fields to struct fields by their json tags, so the
+// payload types shared with the JSON encoding need no avro tags.
+var avroAPI = avro.Config{TagKey: "json"}.Freeze()
+
+// Avro encodes avro binary in the wire format. Values are serialized from
+// structs, with fields matched to record fields by json tag, or maps.
+// Payloads are deserialized through their JSON form, with logical
+// timestamps as RFC 3339, so they decode into the same types as JSON
+// payloads whatever the writer's schema version. Parsed schemas are cached
+// by ID.
+type Avro struct {
+	client  *schemaregistry.Client
+	subject string
+
+	mu      sync.Mutex
+	schemas map[int]avro.Schema
+}
+
+func NewAvro(client *schemaregistry.Client, subject string) *Avro {
+	return &Avro{
+		client:  client,
+		subject: subject,
+		schemas: make(map[int]avro.Schema),
+	}
+}
+
+func (a *Avro) Serialize(ctx context.Context, v any) ([]byte, error) {
+	writer, err := latestSchema(ctx, a.client, a.subject, schemaregistry.TypeAvro)
+	if err != nil {
+		return nil, err
+	}
+	schema, err := a.parse(ctx, writer)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := avroAPI.Marshal(schema, v)
+	if err != nil {
+		return nil, fmt.Errorf("avro encode with schema %d: %w", writer.ID, err)
+	}
+	return append(AppendHeader(make([]byte, 0, headerSize+len(value)), writer.ID), value...), nil
+}
+
+func (a *Avro) Deserialize(ctx context.Context, data []byte, v any) error {
+	writer, value, err := writerSchema(ctx, a.client, data, schemaregistry.TypeAvro)
+	if err != nil {
+		return err
+	}
+	schema, err := a.parse(ctx, writer)
+	if err != nil {
+		return err
+	}
+
+	var decoded any
+	if err := avroAPI.Unmarshal(schema, value, &decoded); err != nil {
+		return fmt.Errorf("avro decode with schema %d: %w", writer.ID, err)
+	}
+
+	data, err = json.Marshal(decoded)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// parse parses schema after the named types it references. Each schema
+// gets its own cache of named types, so different versions of a record do
+// not clash.
+func (a *Avro) parse(ctx context.Context, schema schemaregistry.Schema) (avro.Schema, error) {
+	a.mu.Lock()
+	parsed, ok := a.schemas[schema.ID]
+	a.mu.Unlock()
+	if ok {
+		return parsed, nil
+	}
+
+	cache := &avro.SchemaCache{}
+	err := references(ctx, a.client, schema, func(ref schemaregistry.Reference, referenced schemaregistry.Schema) error {
+		if _, err := avro.ParseWithCache(referenced.Schema, "", cache); err != nil {
+			return fmt.Errorf("parse avro reference %s: %w", ref.Name, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err = avro.ParseWithCache(schema.Schema, "", cache)
+	if err != nil {
+		return nil, fmt.Errorf("parse avro schema %d: %w", schema.ID, err)
+	}
+
+	a.mu.Lock()
+	a.schemas[schema.ID] = parsed
+	a.mu.Unlock()
+	return parsed, nil
+}
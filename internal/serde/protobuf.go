@@ -0,0 +1,296 @@
+package serde
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bufbuild/protocompile"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/schemaregistry"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// protoSchemaFile is the name the registry's schema text is compiled
+// under; references are compiled under their import paths.
+const protoSchemaFile = "schema.proto"
+
+// Protobuf encodes protobuf in the wire format, where the schema ID is
+// followed by the indexes of the message type within the schema's .proto
+// file. Values are either generated proto.Message types or, through their
+// JSON form, any type whose json tags match the proto field names; such
+// values are serialized as the first message of the schema. Compiled
+// schemas are cached by ID.
+type Protobuf struct {
+	client  *schemaregistry.Client
+	subject string
+
+	mu    sync.Mutex
+	files map[int]protoreflect.FileDescriptor
+}
+
+func NewProtobuf(client *schemaregistry.Client, subject string) *Protobuf {
+	return &Protobuf{
+		client:  client,
+		subject: subject,
+		files:   make(map[int]protoreflect.FileDescriptor),
+	}
+}
+
+func (p *Protobuf) Serialize(ctx context.Context, v any) ([]byte, error) {
+	writer, err := latestSchema(ctx, p.client, p.subject, schemaregistry.TypeProtobuf)
+	if err != nil {
+		return nil, err
+	}
+	file, err := p.compile(ctx, writer)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		msg     proto.Message
+		indexes []int
+	)
+	if generated, ok := v.(proto.Message); ok {
+		msg = generated
+		if indexes, err = messageIndexes(file, generated.ProtoReflect().Descriptor().FullName()); err != nil {
+			return nil, fmt.Errorf("schema %d: %w", writer.ID, err)
+		}
+	} else {
+		if file.Messages().Len() == 0 {
+			return nil, fmt.Errorf("schema %d declares no messages", writer.ID)
+		}
+		dynamic := dynamicpb.NewMessage(file.Messages().Get(0))
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(data, dynamic); err != nil {
+			return nil, fmt.Errorf("protobuf encode with schema %d: %w", writer.ID, err)
+		}
+		msg, indexes = dynamic, []int{0}
+	}
+
+	value, err := proto.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("protobuf encode with schema %d: %w", writer.ID, err)
+	}
+
+	out := AppendHeader(make([]byte, 0, headerSize+len(indexes)+1+len(value)), writer.ID)
+	out = appendMessageIndexes(out, indexes)
+	return append(out, value...), nil
+}
+
+func (p *Protobuf) Deserialize(ctx context.Context, data []byte, v any) error {
+	writer, value, err := writerSchema(ctx, p.client, data, schemaregistry.TypeProtobuf)
+	if err != nil {
+		return err
+	}
+	indexes, value, err := readMessageIndexes(value)
+	if err != nil {
+		return err
+	}
+
+	if generated, ok := v.(proto.Message); ok {
+		if err := proto.Unmarshal(value, generated); err != nil {
+			return fmt.Errorf("protobuf decode with schema %d: %w", writer.ID, err)
+		}
+		return nil
+	}
+
+	file, err := p.compile(ctx, writer)
+	if err != nil {
+		return err
+	}
+	desc, err := messageByIndexes(file, indexes)
+	if err != nil {
+		return fmt.Errorf("schema %d: %w", writer.ID, err)
+	}
+
+	dynamic := dynamicpb.NewMessage(desc)
+	if err := proto.Unmarshal(value, dynamic); err != nil {
+		return fmt.Errorf("protobuf decode with schema %d: %w", writer.ID, err)
+	}
+
+	data, err = json.Marshal(protoMessageValue(dynamic))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// compile compiles schema with the files it imports, which are its
+// references or the well-known types.
+func (p *Protobuf) compile(ctx context.Context, schema schemaregistry.Schema) (protoreflect.FileDescriptor, error) {
+	p.mu.Lock()
+	file, ok := p.files[schema.ID]
+	p.mu.Unlock()
+	if ok {
+		return file, nil
+	}
+
+	sources := map[string]string{protoSchemaFile: schema.Schema}
+	err := references(ctx, p.client, schema, func(ref schemaregistry.Reference, referenced schemaregistry.Schema) error {
+		sources[ref.Name] = referenced.Schema
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			Accessor: protocompile.SourceAccessorFromMap(sources),
+		}),
+	}
+	files, err := compiler.Compile(ctx, protoSchemaFile)
+	if err != nil {
+		return nil, fmt.Errorf("compile protobuf schema %d: %w", schema.ID, err)
+	}
+	file = files[0]
+
+	p.mu.Lock()
+	p.files[schema.ID] = file
+	p.mu.Unlock()
+	return file, nil
+}
+
+// appendMessageIndexes appends the path to a message type: its index among
+// the file's top-level messages, then among each enclosing message's
+// nested ones. The common path to the first message is a single zero.
+func appendMessageIndexes(dst []byte, indexes []int) []byte {
+	if len(indexes) == 1 && indexes[0] == 0 {
+		return binary.AppendVarint(dst, 0)
+	}
+	dst = binary.AppendVarint(dst, int64(len(indexes)))
+	for _, index := range indexes {
+		dst = binary.AppendVarint(dst, int64(index))
+	}
+	return dst
+}
+
+func readMessageIndexes(data []byte) ([]int, []byte, error) {
+	errInvalid := errors.New("invalid protobuf message indexes")
+
+	count, n := binary.Varint(data)
+	if n <= 0 || count < 0 || count > int64(len(data)) {
+		return nil, nil, errInvalid
+	}
+	data = data[n:]
+	if count == 0 {
+		return []int{0}, data, nil
+	}
+
+	indexes := make([]int, count)
+	for i := range indexes {
+		index, n := binary.Varint(data)
+		if n <= 0 || index < 0 {
+			return nil, nil, errInvalid
+		}
+		indexes[i] = int(index)
+		data = data[n:]
+	}
+	return indexes, data, nil
+}
+
+func messageByIndexes(file protoreflect.FileDescriptor, indexes []int) (protoreflect.MessageDescriptor, error) {
+	messages := file.Messages()
+	var desc protoreflect.MessageDescriptor
+	for _, index := range indexes {
+		if index >= messages.Len() {
+			return nil, fmt.Errorf("no message at index path %v", indexes)
+		}
+		desc = messages.Get(index)
+		messages = desc.Messages()
+	}
+	return desc, nil
+}
+
+func messageIndexes(file protoreflect.FileDescriptor, name protoreflect.FullName) ([]int, error) {
+	var find func(messages protoreflect.MessageDescriptors, path []int) []int
+	find = func(messages protoreflect.MessageDescriptors, path []int) []int {
+		for i := range messages.Len() {
+			desc := messages.Get(i)
+			if desc.FullName() == name {
+				return append(path, i)
+			}
+			if found := find(desc.Messages(), append(path, i)); found != nil {
+				return found
+			}
+		}
+		return nil
+	}
+
+	if indexes := find(file.Messages(), nil); indexes != nil {
+		return indexes, nil
+	}
+	return nil, fmt.Errorf("message %s is not declared in the schema", name)
+}
+
+// protoMessageValue turns msg into a value whose JSON form uses the proto
+// field names, numbers as JSON numbers, enums by name and timestamps as
+// RFC 3339, so it decodes into the same types as JSON payloads.
+// Wrapper types are unwrapped.
+func protoMessageValue(msg protoreflect.Message) any {
+	desc := msg.Descriptor()
+	switch name := desc.FullName(); {
+	case name == "google.protobuf.Timestamp":
+		fields := desc.Fields()
+		seconds := msg.Get(fields.ByName("seconds")).Int()
+		nanos := msg.Get(fields.ByName("nanos")).Int()
+		return time.Unix(seconds, nanos).UTC()
+	case strings.HasPrefix(string(name), "google.protobuf.") && strings.HasSuffix(string(name), "Value") &&
+		desc.Fields().Len() == 1 && desc.Fields().Get(0).Name() == "value":
+		field := desc.Fields().Get(0)
+		return protoSingularValue(field, msg.Get(field))
+	}
+
+	out := make(map[string]any)
+	msg.Range(func(field protoreflect.FieldDescriptor, value protoreflect.Value) bool {
+		out[string(field.Name())] = protoFieldValue(field, value)
+		return true
+	})
+	return out
+}
+
+func protoFieldValue(field protoreflect.FieldDescriptor, value protoreflect.Value) any {
+	switch {
+	case field.IsList():
+		list := value.List()
+		out := make([]any, list.Len())
+		for i := range out {
+			out[i] = protoSingularValue(field, list.Get(i))
+		}
+		return out
+	case field.IsMap():
+		out := make(map[string]any)
+		value.Map().Range(func(key protoreflect.MapKey, value protoreflect.Value) bool {
+			out[key.String()] = protoSingularValue(field.MapValue(), value)
+			return true
+		})
+		return out
+	default:
+		return protoSingularValue(field, value)
+	}
+}
+
+func protoSingularValue(field protoreflect.FieldDescriptor, value protoreflect.Value) any {
+	switch field.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return protoMessageValue(value.Message())
+	case protoreflect.EnumKind:
+		if enumValue := field.Enum().Values().ByNumber(value.Enum()); enumValue != nil {
+			return string(enumValue.Name())
+		}
+		return int32(value.Enum())
+	default:
+		return value.Interface()
+	}
+}
@@ -0,0 +1,183 @@
+// Package serde encodes and decodes message payloads. JSON payloads are
+// self-describing; avro and protobuf payloads use the Confluent wire
+// format, a zero magic byte and the 4-byte big-endian ID of the writer's
+// schema in the schema registry, followed by the encoded value.
+package serde
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/muazwzxv/kafka-consumer-worker/internal/schemaregistry"
+)
+
+// Encodings publishers and streams select by name.
+const (
+	EncodingJSON     = "json"
+	EncodingAvro     = "avro"
+	EncodingProtobuf = "protobuf"
+)
+
+const (
+	magicByte  = 0
+	headerSize = 5
+)
+
+// ErrWireFormat is returned for payloads that are not in the wire format.
+var ErrWireFormat = errors.New("payload is not in the schema registry wire format")
+
+// Serializer turns a value into a message payload.
+type Serializer interface {
+	Serialize(ctx context.Context, v any) ([]byte, error)
+}
+
+// Deserializer turns a message payload into the value v points to.
+type Deserializer interface {
+	Deserialize(ctx context.Context, data []byte, v any) error
+}
+
+// Serde is both.
+type Serde interface {
+	Serializer
+	Deserializer
+}
+
+// New returns the serde of encoding. Avro and protobuf need client, and
+// serialize with the latest schema registered under subject; subject is
+// unused when only deserializing.
+func New(encoding string, client *schemaregistry.Client, subject string) (Serde, error) {
+	switch encoding {
+	case "", EncodingJSON:
+		return JSON{}, nil
+	case EncodingAvro:
+		if client == nil {
+			return nil, errors.New("avro encoding requires a schema registry")
+		}
+		return NewAvro(client, subject), nil
+	case EncodingProtobuf:
+		if client == nil {
+			return nil, errors.New("protobuf encoding requires a schema registry")
+		}
+		return NewProtobuf(client, subject), nil
+	default:
+		return nil, fmt.Errorf("unknown encoding %q (valid: %s, %s, %s)",
+			encoding, EncodingJSON, EncodingAvro, EncodingProtobuf)
+	}
+}
+
+// ContentType returns the media type of payloads in encoding.
+func ContentType(encoding string) string {
+	switch encoding {
+	case EncodingAvro:
+		return "application/avro"
+	case EncodingProtobuf:
+		return "application/protobuf"
+	default:
+		return "application/json"
+	}
+}
+
+// AppendHeader appends the wire format header for schema id to dst.
+func AppendHeader(dst []byte, id int) []byte {
+	dst = append(dst, magicByte)
+	return binary.BigEndian.AppendUint32(dst, uint32(id))
+}
+
+// ParseHeader splits a wire format payload into the writer's schema ID and
+// the encoded value.
+func ParseHeader(data []byte) (int, []byte, error) {
+	if len(data) < headerSize || data[0] != magicByte {
+		return 0, nil, ErrWireFormat
+	}
+	return int(binary.BigEndian.Uint32(data[1:headerSize])), data[headerSize:], nil
+}
+
+// StripHeader returns the value of a wire format payload, or data itself
+// if it has no header. JSON never starts with a zero byte, so it tells
+// plain JSON from JSON written by a schema registry serializer.
+func StripHeader(data []byte) []byte {
+	if _, value, err := ParseHeader(data); err == nil {
+		return value
+	}
+	return data
+}
+
+// JSON is the plain JSON encoding. It also reads JSON written by a schema
+// registry serializer, ignoring the schema ID.
+type JSON struct{}
+
+func (JSON) Serialize(_ context.Context, v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSON) Deserialize(_ context.Context, data []byte, v any) error {
+	return json.Unmarshal(StripHeader(data), v)
+}
+
+// latestSchema returns the latest schema of subject, which must be of
+// schemaType.
+func latestSchema(ctx context.Context, client *schemaregistry.Client, subject, schemaType string) (schemaregistry.Schema, error) {
+	if subject == "" {
+		return schemaregistry.Schema{}, errors.New("no schema registry subject to serialize with")
+	}
+	schema, err := client.LatestSchema(ctx, subject)
+	if err != nil {
+		return schemaregistry.Schema{}, err
+	}
+	if schema.SchemaType() != schemaType {
+		return schemaregistry.Schema{}, fmt.Errorf("subject %s holds a %s schema, not %s", subject, schema.SchemaType(), schemaType)
+	}
+	return schema, nil
+}
+
+// writerSchema returns the schema a wire format payload was written with,
+// which must be of schemaType, and the encoded value.
+func writerSchema(ctx context.Context, client *schemaregistry.Client, data []byte, schemaType string) (schemaregistry.Schema, []byte, error) {
+	id, value, err := ParseHeader(data)
+	if err != nil {
+		return schemaregistry.Schema{}, nil, err
+	}
+	schema, err := client.SchemaByID(ctx, id)
+	if err != nil {
+		return schemaregistry.Schema{}, nil, err
+	}
+	if schema.SchemaType() != schemaType {
+		return schemaregistry.Schema{}, nil, fmt.Errorf("schema %d is a %s schema, not %s", id, schema.SchemaType(), schemaType)
+	}
+	return schema, value, nil
+}
+
+// references resolves the schemas schema references, transitively, and
+// calls fn for each before the schemas that depend on it.
+func references(ctx context.Context, client *schemaregistry.Client, schema schemaregistry.Schema,
+	fn func(ref schemaregistry.Reference, schema schemaregistry.Schema) error,
+) error {
+	seen := make(map[string]bool)
+
+	var visit func(refs []schemaregistry.Reference) error
+	visit = func(refs []schemaregistry.Reference) error {
+		for _, ref := range refs {
+			if seen[ref.Name] {
+				continue
+			}
+			seen[ref.Name] = true
+
+			referenced, err := client.SchemaByVersion(ctx, ref.Subject, ref.Version)
+			if err != nil {
+				return fmt.Errorf("resolve reference %s: %w", ref.Name, err)
+			}
+			if err := visit(referenced.References); err != nil {
+				return err
+			}
+			if err := fn(ref, referenced); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return visit(schema.References)
+}
@@ -0,0 +1,142 @@
+package serde_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/muazwzxv/kafka-consumer-worker/internal/config"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/schemaregistry"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/schemaregistry/schemaregistrytest"
+	"github.com/muazwzxv/kafka-consumer-worker/internal/serde"
+)
+
+type user struct {
+	ID    string `json:"id"`
+	Email string `json:"email"`
+	Age   int32  `json:"age"`
+}
+
+const (
+	userAvro = `{"type":"record","name":"User","fields":[
+		{"name":"id","type":"string"},
+		{"name":"email","type":"string"},
+		{"name":"age","type":"int"}]}`
+	userProto = `syntax = "proto3";
+package users;
+
+message User {
+  string id = 1;
+  string email = 2;
+  int32 age = 3;
+}
+
+message Deleted {
+  string id = 1;
+}
+`
+)
+
+func newRegistry(t *testing.T) (*schemaregistrytest.FakeRegistry, *schemaregistry.Client) {
+	t.Helper()
+
+	registry := schemaregistrytest.NewFakeRegistry()
+	t.Cleanup(registry.Close)
+
+	client, err := schemaregistry.NewClient(config.SchemaRegistryConfig{
+		URL:      registry.URL(),
+		Timeout:  time.Second,
+		CacheTTL: time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	return registry, client
+}
+
+func TestAvroRoundTrip(t *testing.T) {
+	registry, client := newRegistry(t)
+	registered := registry.Register("users-value", schemaregistry.Schema{Type: schemaregistry.TypeAvro, Schema: userAvro})
+
+	s, err := serde.New(serde.EncodingAvro, client, "users-value")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	roundTrip(t, s, registered.ID)
+}
+
+func TestProtobufRoundTrip(t *testing.T) {
+	registry, client := newRegistry(t)
+	registered := registry.Register("users-value", schemaregistry.Schema{Type: schemaregistry.TypeProtobuf, Schema: userProto})
+
+	s, err := serde.New(serde.EncodingProtobuf, client, "users-value")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	roundTrip(t, s, registered.ID)
+}
+
+func roundTrip(t *testing.T, s serde.Serde, schemaID int) {
+	t.Helper()
+	ctx := context.Background()
+
+	want := user{ID: "u-1", Email: "ada@example.com", Age: 36}
+	data, err := s.Serialize(ctx, want)
+	if err != nil {
+		t.Fatalf("Serialize: %v", err)
+	}
+
+	id, _, err := serde.ParseHeader(data)
+	if err != nil {
+		t.Fatalf("ParseHeader: %v", err)
+	}
+	if id != schemaID {
+		t.Errorf("schema id = %d, want %d", id, schemaID)
+	}
+
+	var got user
+	if err := s.Deserialize(ctx, data, &got); err != nil {
+		t.Fatalf("Deserialize: %v", err)
+	}
+	if got != want {
+		t.Errorf("Deserialize = %+v, want %+v", got, want)
+	}
+}
+
+func TestAvroDeserializesWithWriterSchema(t *testing.T) {
+	registry, client := newRegistry(t)
+	registry.Register("users-value", schemaregistry.Schema{Type: schemaregistry.TypeAvro, Schema: userAvro})
+
+	ctx := context.Background()
+	data, err := serde.NewAvro(client, "users-value").Serialize(ctx, user{ID: "u-1", Email: "ada@example.com", Age: 36})
+	if err != nil {
+		t.Fatalf("Serialize: %v", err)
+	}
+
+	// A newer version does not change how older payloads decode.
+	registry.Register("users-value", schemaregistry.Schema{Type: schemaregistry.TypeAvro, Schema: `{"type":"record","name":"User","fields":[
+		{"name":"id","type":"string"},
+		{"name":"email","type":"string"},
+		{"name":"age","type":"int"},
+		{"name":"name","type":"string","default":""}]}`})
+
+	var got user
+	if err := serde.NewAvro(client, "users-value").Deserialize(ctx, data, &got); err != nil {
+		t.Fatalf("Deserialize: %v", err)
+	}
+	if got.ID != "u-1" || got.Age != 36 {
+		t.Errorf("Deserialize = %+v, want the v1 payload", got)
+	}
+}
+
+func TestDeserializeRejectsPayloadsOutsideWireFormat(t *testing.T) {
+	registry, client := newRegistry(t)
+	registry.Register("users-value", schemaregistry.Schema{Type: schemaregistry.TypeAvro, Schema: userAvro})
+
+	var got user
+	err := serde.NewAvro(client, "users-value").Deserialize(context.Background(), []byte(`{"id":"u-1"}`), &got)
+	if !errors.Is(err, serde.ErrWireFormat) {
+		t.Fatalf("err = %v, want ErrWireFormat", err)
+	}
+}
@@ -73,6 +73,8 @@ func (s *UserServiceImpl) CreateUser(ctx context.Context, req request.CreateUser
 
 func (s *UserServiceImpl) publish(ctx context.Context, user *entity.User) error {
 	payload := &stream.UserLifeCycleStream{
+		Version:     stream.UserLifeCycleStreamVersion,
+		EventType:   stream.UserEventCreated,
 		UUID:        user.UUID,
 		Name:        user.Name,
 		Description: user.Description,
@@ -80,7 +82,7 @@ func (s *UserServiceImpl) publish(ctx context.Context, user *entity.User) error
 		CreatedAt:   user.CreatedAt,
 		UpdatedAt:   user.UpdatedAt,
 	}
-	return s.userLifecyclePublisher.Publish(ctx, payload)
+	return s.userLifecyclePublisher.PublishWithKey(ctx, user.UUID, payload)
 }
 
 func (s *UserServiceImpl) entityToResponse(item *entity.User) *response.UserResponse {
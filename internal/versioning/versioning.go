@@ -0,0 +1,186 @@
+// Package versioning converts event payloads between the versions of an
+// event. Consumers upcast payloads of older versions to the current one
+// before decoding them, so handlers only deal with the current type;
+// publishers can downcast to an older version while consumers migrate.
+//
+// The version is carried in the payload's version field. Payloads without
+// it are version 1, so events published before an event was versioned are
+// upcast like any other.
+package versioning
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Field is the payload field holding the event version.
+const Field = "version"
+
+// ErrUnsupportedVersion is returned for versions the chain does not know,
+// such as payloads published by a newer producer.
+var ErrUnsupportedVersion = errors.New("unsupported event version")
+
+// Step converts a payload between two adjacent versions in place. The
+// chain sets the version field itself.
+type Step func(payload map[string]any) error
+
+// Chain holds the conversions between the versions of one event. Version
+// n+1 is reached from n by up[n-1] and goes back by down[n-1].
+type Chain struct {
+	name string
+	up   []Step
+	down []Step
+}
+
+func NewChain(name string) *Chain {
+	return &Chain{name: name}
+}
+
+// Add registers the next version of the event: up converts a payload of
+// the previous current version to it and down converts back. Either may
+// be nil when the versions only differ in the version field. It returns c
+// so versions can be chained at declaration.
+func (c *Chain) Add(up, down Step) *Chain {
+	c.up = append(c.up, up)
+	c.down = append(c.down, down)
+	return c
+}
+
+// Current is the latest version of the event.
+func (c *Chain) Current() int {
+	return len(c.up) + 1
+}
+
+// Upcast converts payload to the current version in place.
+func (c *Chain) Upcast(payload map[string]any) error {
+	version, err := Version(payload)
+	if err != nil {
+		return fmt.Errorf("%s: %w", c.name, err)
+	}
+	if version > c.Current() {
+		return fmt.Errorf("%s: %w %d, latest known is %d", c.name, ErrUnsupportedVersion, version, c.Current())
+	}
+
+	for ; version < c.Current(); version++ {
+		if step := c.up[version-1]; step != nil {
+			if err := step(payload); err != nil {
+				return fmt.Errorf("%s: upcast version %d to %d: %w", c.name, version, version+1, err)
+			}
+		}
+	}
+	payload[Field] = c.Current()
+	return nil
+}
+
+// Downcast converts payload, of the current version or an older one, to
+// version in place. Version 1 payloads do not carry the version field.
+func (c *Chain) Downcast(payload map[string]any, version int) error {
+	from, err := Version(payload)
+	if err != nil {
+		return fmt.Errorf("%s: %w", c.name, err)
+	}
+	if version < 1 || version > from || from > c.Current() {
+		return fmt.Errorf("%s: %w: cannot downcast version %d to %d", c.name, ErrUnsupportedVersion, from, version)
+	}
+
+	for ; from > version; from-- {
+		if step := c.down[from-2]; step != nil {
+			if err := step(payload); err != nil {
+				return fmt.Errorf("%s: downcast version %d to %d: %w", c.name, from, from-1, err)
+			}
+		}
+	}
+
+	if version == 1 {
+		delete(payload, Field)
+	} else {
+		payload[Field] = version
+	}
+	return nil
+}
+
+// Convert returns v as a payload of version, e.g. to publish at an older
+// version. v is a value of the current version, converted through its
+// JSON form.
+func (c *Chain) Convert(v any, version int) (map[string]any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, fmt.Errorf("%s: payload is not an object: %w", c.name, err)
+	}
+
+	payload[Field] = c.Current()
+	if err := c.Downcast(payload, version); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// PayloadVersion returns the version of a JSON payload, 1 when it has no
+// version field.
+func PayloadVersion(data []byte) (int, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return 0, fmt.Errorf("payload is not an object: %w", err)
+	}
+	raw, ok := fields[Field]
+	if !ok {
+		return 1, nil
+	}
+
+	var version any
+	if err := json.Unmarshal(raw, &version); err != nil {
+		return 0, fmt.Errorf("invalid event version: %w", err)
+	}
+	return Version(map[string]any{Field: version})
+}
+
+// Version returns the version of payload, 1 when it has no version field.
+// Numbers decoded from JSON or a binary encoding and numeric strings are
+// accepted.
+func Version(payload map[string]any) (int, error) {
+	raw, ok := payload[Field]
+	if !ok || raw == nil {
+		return 1, nil
+	}
+
+	var version int
+	switch value := raw.(type) {
+	case float64:
+		if value != math.Trunc(value) {
+			return 0, fmt.Errorf("invalid event version %v", value)
+		}
+		version = int(value)
+	case int:
+		version = value
+	case int32:
+		version = int(value)
+	case int64:
+		version = int(value)
+	case json.Number:
+		n, err := value.Int64()
+		if err != nil {
+			return 0, fmt.Errorf("invalid event version %q", value)
+		}
+		version = int(n)
+	case string:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return 0, fmt.Errorf("invalid event version %q", value)
+		}
+		version = n
+	default:
+		return 0, fmt.Errorf("invalid event version %v", raw)
+	}
+
+	if version < 1 {
+		return 0, fmt.Errorf("invalid event version %d", version)
+	}
+	return version, nil
+}
@@ -0,0 +1,227 @@
+package versioning
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// testChain renames name to full_name in version 2 and adds a default
+// tier in version 3.
+func testChain() *Chain {
+	return NewChain("user").
+		Add(func(payload map[string]any) error {
+			payload["full_name"] = payload["name"]
+			delete(payload, "name")
+			return nil
+		}, func(payload map[string]any) error {
+			payload["name"] = payload["full_name"]
+			delete(payload, "full_name")
+			return nil
+		}).
+		Add(func(payload map[string]any) error {
+			if _, ok := payload["tier"]; !ok {
+				payload["tier"] = "free"
+			}
+			return nil
+		}, func(payload map[string]any) error {
+			delete(payload, "tier")
+			return nil
+		})
+}
+
+func TestChainUpcast(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload map[string]any
+		want    map[string]any
+	}{
+		{
+			name:    "unversioned",
+			payload: map[string]any{"name": "Ada"},
+			want:    map[string]any{"version": 3, "full_name": "Ada", "tier": "free"},
+		},
+		{
+			name:    "version 2 from JSON",
+			payload: map[string]any{"version": float64(2), "full_name": "Ada"},
+			want:    map[string]any{"version": 3, "full_name": "Ada", "tier": "free"},
+		},
+		{
+			name:    "current",
+			payload: map[string]any{"version": 3, "full_name": "Ada", "tier": "pro"},
+			want:    map[string]any{"version": 3, "full_name": "Ada", "tier": "pro"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := testChain().Upcast(tt.payload); err != nil {
+				t.Fatalf("Upcast: %v", err)
+			}
+			if !reflect.DeepEqual(tt.payload, tt.want) {
+				t.Errorf("Upcast = %v, want %v", tt.payload, tt.want)
+			}
+		})
+	}
+}
+
+func TestChainUpcastRejectsNewerVersion(t *testing.T) {
+	err := testChain().Upcast(map[string]any{"version": 4})
+	if !errors.Is(err, ErrUnsupportedVersion) {
+		t.Fatalf("err = %v, want ErrUnsupportedVersion", err)
+	}
+}
+
+func TestChainUpcastStepError(t *testing.T) {
+	errStep := errors.New("step failed")
+	chain := NewChain("user").Add(func(map[string]any) error { return errStep }, nil)
+
+	if err := chain.Upcast(map[string]any{}); !errors.Is(err, errStep) {
+		t.Fatalf("err = %v, want the step's error", err)
+	}
+}
+
+func TestChainNilStepsOnlyChangeVersion(t *testing.T) {
+	chain := NewChain("user").Add(nil, nil)
+
+	payload := map[string]any{"name": "Ada"}
+	if err := chain.Upcast(payload); err != nil {
+		t.Fatalf("Upcast: %v", err)
+	}
+	if want := (map[string]any{"version": 2, "name": "Ada"}); !reflect.DeepEqual(payload, want) {
+		t.Fatalf("Upcast = %v, want %v", payload, want)
+	}
+
+	if err := chain.Downcast(payload, 1); err != nil {
+		t.Fatalf("Downcast: %v", err)
+	}
+	if want := (map[string]any{"name": "Ada"}); !reflect.DeepEqual(payload, want) {
+		t.Fatalf("Downcast = %v, want %v", payload, want)
+	}
+}
+
+func TestChainDowncast(t *testing.T) {
+	tests := []struct {
+		version int
+		want    map[string]any
+	}{
+		{3, map[string]any{"version": 3, "full_name": "Ada", "tier": "pro"}},
+		{2, map[string]any{"version": 2, "full_name": "Ada"}},
+		{1, map[string]any{"name": "Ada"}},
+	}
+
+	for _, tt := range tests {
+		payload := map[string]any{"version": 3, "full_name": "Ada", "tier": "pro"}
+		if err := testChain().Downcast(payload, tt.version); err != nil {
+			t.Fatalf("Downcast to %d: %v", tt.version, err)
+		}
+		if !reflect.DeepEqual(payload, tt.want) {
+			t.Errorf("Downcast to %d = %v, want %v", tt.version, payload, tt.want)
+		}
+	}
+}
+
+func TestChainDowncastRejectsInvalidTargets(t *testing.T) {
+	chain := testChain()
+	for _, version := range []int{0, 3, 4} {
+		payload := map[string]any{"version": 2, "full_name": "Ada"}
+		if err := chain.Downcast(payload, version); !errors.Is(err, ErrUnsupportedVersion) {
+			t.Errorf("Downcast of version 2 to %d err = %v, want ErrUnsupportedVersion", version, err)
+		}
+	}
+
+	payload := map[string]any{"version": 4}
+	if err := chain.Downcast(payload, 1); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("Downcast of version 4 err = %v, want ErrUnsupportedVersion", err)
+	}
+}
+
+func TestChainRoundTrip(t *testing.T) {
+	chain := testChain()
+	payload := map[string]any{"version": 3, "full_name": "Ada", "tier": "free"}
+
+	if err := chain.Downcast(payload, 1); err != nil {
+		t.Fatalf("Downcast: %v", err)
+	}
+	if err := chain.Upcast(payload); err != nil {
+		t.Fatalf("Upcast: %v", err)
+	}
+	if want := (map[string]any{"version": 3, "full_name": "Ada", "tier": "free"}); !reflect.DeepEqual(payload, want) {
+		t.Fatalf("round trip = %v, want %v", payload, want)
+	}
+}
+
+func TestChainConvert(t *testing.T) {
+	type user struct {
+		FullName string `json:"full_name"`
+		Tier     string `json:"tier"`
+	}
+
+	payload, err := testChain().Convert(user{FullName: "Ada", Tier: "pro"}, 2)
+	if err != nil {
+		t.Fatalf("Convert: %v", err)
+	}
+	if want := (map[string]any{"version": 2, "full_name": "Ada"}); !reflect.DeepEqual(payload, want) {
+		t.Fatalf("Convert = %v, want %v", payload, want)
+	}
+
+	if _, err := testChain().Convert([]string{"not", "an", "object"}, 1); err == nil {
+		t.Fatal("Convert of a non-object succeeded, want an error")
+	}
+}
+
+func TestVersion(t *testing.T) {
+	valid := []struct {
+		raw  any
+		want int
+	}{
+		{nil, 1},
+		{float64(2), 2},
+		{3, 3},
+		{int32(4), 4},
+		{int64(5), 5},
+		{json.Number("6"), 6},
+		{"7", 7},
+	}
+	for _, tt := range valid {
+		got, err := Version(map[string]any{Field: tt.raw})
+		if err != nil || got != tt.want {
+			t.Errorf("Version(%#v) = %d, %v; want %d", tt.raw, got, err, tt.want)
+		}
+	}
+
+	if got, err := Version(map[string]any{}); err != nil || got != 1 {
+		t.Errorf("Version of an unversioned payload = %d, %v; want 1", got, err)
+	}
+
+	for _, raw := range []any{float64(1.5), 0, -1, "two", json.Number("x"), true} {
+		if _, err := Version(map[string]any{Field: raw}); err == nil {
+			t.Errorf("Version(%#v) succeeded, want an error", raw)
+		}
+	}
+}
+
+func TestPayloadVersion(t *testing.T) {
+	tests := []struct {
+		payload string
+		want    int
+	}{
+		{`{"name":"Ada"}`, 1},
+		{`{"version":2}`, 2},
+		{`{"version":"3"}`, 3},
+		{`{"version":null}`, 1},
+	}
+	for _, tt := range tests {
+		got, err := PayloadVersion([]byte(tt.payload))
+		if err != nil || got != tt.want {
+			t.Errorf("PayloadVersion(%s) = %d, %v; want %d", tt.payload, got, err, tt.want)
+		}
+	}
+
+	for _, payload := range []string{`[1]`, `{"version":`, `{"version":0}`} {
+		if _, err := PayloadVersion([]byte(payload)); err == nil {
+			t.Errorf("PayloadVersion(%s) succeeded, want an error", payload)
+		}
+	}
+}